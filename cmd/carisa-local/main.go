@@ -0,0 +1,69 @@
+/*
+ *   Copyright (c) 2021 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/carisa/internal/local"
+	"github.com/carisa/internal/master"
+	"github.com/carisa/pkg/algorithm"
+)
+
+func main() {
+	var cnf local.Config
+	flag.IntVar(&cnf.Workers, "workers", 1, "the number of workers")
+	flag.StringVar(&cnf.GraphID, "graph-id", "local", "the graph id of the workers")
+	flag.StringVar(&cnf.MasterConfig, "master-config", "", "the master config file (json, yaml or toml)")
+	flag.StringVar(&cnf.WorkerConfig, "worker-config", "", "the worker config file (json, yaml or toml)")
+	flag.IntVar(&cnf.Port, "port", master.MasterPort, "the first port of the nodes")
+	flag.StringVar(&cnf.DataDir, "data-dir", ".", "the data directory of the master. The input and the output are relative to it")
+	flag.StringVar(&cnf.Job.ID, "job-id", "", "the id of the job. It is generated when it is empty")
+	flag.StringVar(&cnf.Job.Algorithm, "algorithm", "", "the algorithm of the job. The cluster serves until it is interrupted when it is empty")
+	flag.StringVar(&cnf.Job.Input, "input", "", "the edge list file of the job under the data directory")
+	flag.StringVar(&cnf.Job.Output, "output", "", "the file under the data directory where the vertex values are written")
+	flag.BoolVar(&cnf.Job.Undirected, "undirected", false, "adds the reverse of every input edge")
+	cnf.Job.Params = algorithm.Params{}
+	flag.Var(algorithm.ParamsFlag(cnf.Job.Params), "param", "a parameter of the algorithm: name=value. It can be repeated")
+
+	flag.Parse()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt)
+	stop := make(chan struct{})
+	go func() {
+		<-quit
+		close(stop)
+	}()
+
+	job, err := local.Run(cnf, stop)
+	if len(cnf.Job.Algorithm) == 0 {
+		return
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(job); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
@@ -19,15 +19,28 @@ package main
 
 import (
 	"flag"
+	"os"
 
 	"github.com/carisa/internal/master"
+	configp "github.com/carisa/pkg/config"
 )
 
 func main() {
 	var confgFile string
-	flag.StringVar(&confgFile, "config", "", "the master config json file")
+	var printConfig bool
+	flag.StringVar(&confgFile, "config", "", "the master config file (json, yaml or toml)")
+	flag.BoolVar(&printConfig, "print-config", false, "prints the effective config with the source of each value")
+	flags := configp.NewFlags(flag.CommandLine, &master.Config{})
 
 	flag.Parse()
 
-	master.Start(master.FactoryBuild(confgFile))
+	if printConfig {
+		cnf, sources := master.LoadConfig(confgFile, flags.Values())
+		if err := configp.Print(os.Stdout, &cnf, sources); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	master.Start(master.FactoryBuild(confgFile, flags.Values()))
 }
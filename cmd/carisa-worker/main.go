@@ -19,15 +19,28 @@ package main
 
 import (
 	"flag"
+	"os"
 
 	"github.com/carisa/internal/worker"
+	configp "github.com/carisa/pkg/config"
 )
 
 func main() {
 	var confgFile string
-	flag.StringVar(&confgFile, "config", "", "the worker config json file")
+	var printConfig bool
+	flag.StringVar(&confgFile, "config", "", "the worker config file (json, yaml or toml)")
+	flag.BoolVar(&printConfig, "print-config", false, "prints the effective config with the source of each value")
+	flags := configp.NewFlags(flag.CommandLine, &worker.Config{})
 
 	flag.Parse()
 
-	worker.Start(worker.FactoryBuild(confgFile))
+	if printConfig {
+		cnf, sources := worker.LoadConfig(confgFile, flags.Values())
+		if err := configp.Print(os.Stdout, &cnf, sources); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	worker.Start(worker.FactoryBuild(confgFile, flags.Values()))
 }
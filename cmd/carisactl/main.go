@@ -0,0 +1,181 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/carisa/internal/master"
+	"github.com/carisa/internal/net"
+	"github.com/carisa/pkg/algorithm"
+)
+
+// waitInterval is the interval to check the state of the job that is waited
+const waitInterval = time.Second
+
+const usage = `carisactl controls the carisa nodes
+
+Usage:
+  carisactl log-level -node <address:port> [-logger <name>] [level]
+      Shows the log levels of a node or changes the level of a logger.
+      The root logger is changed when no logger is specified. The node is the admin address
+      of a master (localhost:52424 by default) or the api address of a worker
+
+  carisactl submit -master <address:port> -algorithm <name> -input <file> [-output <file>]
+                   [-graph-id <id>] [-id <job id>] [-undirected] [-param name=value ...] [-wait]
+      Submits a job to the leader master. The input is an edge list read by the master.
+      The input and the output are relative paths under the data directory of the master.
+      It waits until the job ends with -wait and fails when the job fails
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "log-level":
+		err = logLevel(os.Args[2:])
+	case "submit":
+		err = submit(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func logLevel(args []string) error {
+	fs := flag.NewFlagSet("log-level", flag.ExitOnError)
+	node := fs.String("node", "localhost:52424", "the admin address of a master or the address of a worker")
+	logger := fs.String("logger", "", "the subsystem logger. i.e: discovery, health, compute, transport")
+	_ = fs.Parse(args)
+
+	url := "http://" + *node + net.LogLevelPath
+	if len(*logger) > 0 {
+		url += "/" + *logger
+	}
+
+	if fs.NArg() == 0 {
+		if len(*logger) == 0 {
+			url = "http://" + *node + net.LogLevelsPath
+		}
+		return request(http.MethodGet, url, nil)
+	}
+
+	body, err := json.Marshal(map[string]string{"level": fs.Arg(0)})
+	if err != nil {
+		return err
+	}
+	return request(http.MethodPut, url, body)
+}
+
+func submit(args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	node := fs.String("master", "localhost:52422", "the leader master address")
+	wait := fs.Bool("wait", false, "waits until the job ends")
+	job := master.Job{Params: algorithm.Params{}}
+	fs.StringVar(&job.ID, "id", "", "the job id. It is generated when it is empty")
+	fs.StringVar(&job.GraphID, "graph-id", "local", "the graph id")
+	fs.StringVar(&job.Algorithm, "algorithm", "", "the algorithm. i.e: "+strings.Join(algorithm.Names(), ", "))
+	fs.StringVar(&job.Input, "input", "", "the edge list file under the data directory of the master")
+	fs.StringVar(&job.Output, "output", "", "the file under the data directory of the master where the vertex values are written")
+	fs.BoolVar(&job.Undirected, "undirected", false, "adds the reverse of every input edge")
+	fs.IntVar(&job.Partitions, "partitions", 0, "the partitions of the graph. The ones of the master config are used when it is 0")
+	fs.Var(algorithm.ParamsFlag(job.Params), "param", "a parameter of the algorithm: name=value. It can be repeated")
+	_ = fs.Parse(args)
+
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	r, err := call(http.MethodPost, "http://"+*node+"/jobs", body)
+	if err != nil {
+		return err
+	}
+	if !*wait {
+		fmt.Print(string(r))
+		return nil
+	}
+
+	if err := json.Unmarshal(r, &job); err != nil {
+		return err
+	}
+	for job.InFlight() {
+		time.Sleep(waitInterval)
+		if r, err = call(http.MethodGet, "http://"+*node+"/jobs/"+job.ID, nil); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(r, &job); err != nil {
+			return err
+		}
+	}
+	fmt.Print(string(r))
+	if job.Status == master.StatusFailed {
+		return fmt.Errorf("the job %s failed: %s", job.ID, job.Message)
+	}
+	return nil
+}
+
+func request(method string, url string, body []byte) error {
+	r, err := call(method, url, body)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(r))
+	return nil
+}
+
+// call sends the request and returns the response body. It fails when the status is not successful
+func call(method string, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	r, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(r))
+	}
+	return r, nil
+}
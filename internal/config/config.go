@@ -18,10 +18,37 @@
 package config
 
 import (
+	"regexp"
+
+	configp "github.com/carisa/pkg/config"
+	"github.com/carisa/pkg/strings"
 	"github.com/rs/xid"
 	"go.uber.org/zap/zapcore"
 )
 
+// EnvPrefix is the prefix of the environment variables of the config fields.
+// i.e: CARISA_SERVER_PORT
+const EnvPrefix = "CARISA"
+
+// Discovery backends
+const (
+	DiscoveryConsul = "consul"
+	DiscoveryStatic = "static"
+	DiscoveryDNS    = "dns"
+	DiscoveryEtcd   = "etcd"
+	DiscoveryMemory = "memory"
+)
+
+// LeaderKey is the default key of the leader election of the masters
+const LeaderKey = "carisa/master/leader"
+
+// Version is the version of carisa. It is set at build time:
+// -ldflags "-X github.com/carisa/internal/config.Version=1.0.0"
+var Version = "dev"
+
+// metaKey matches the valid keys of the discovery metadata
+var metaKey = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+
 type NodeType string
 
 const (
@@ -35,9 +62,46 @@ type Zap struct {
 	Development bool `json:",omitempty"`
 	// Level. See zapcore.Level.
 	Level zapcore.Level `json:",omitempty"`
+	// Levels are the initial levels of the subsystem loggers. i.e: discovery, health.
+	// The subsystems without level use the Level field
+	Levels map[string]zapcore.Level `json:",omitempty"`
 	// Encoding type. Common value: Depending of Development flag
 	// The values can be: json -> json format, console -> console format
 	Encoding string `json:",omitempty"`
+	// OutputPaths is a list of files or urls to write the logs. Common value: stderr
+	// The values stdout and stderr write in the standard output and error
+	OutputPaths []string `json:",omitempty"`
+	// Rotation defines the rotation of the output files
+	Rotation Rotation `json:",omitempty"`
+}
+
+// levelOf returns the level of the subsystem logger or the root level when it has not level
+func (z Zap) levelOf(name string) zapcore.Level {
+	if lv, ok := z.Levels[name]; ok {
+		return lv
+	}
+	return z.Level
+}
+
+// Rotation defines the rotation of the log files. The files are rotated
+// when any field is set. The urls of the output paths are not rotated
+type Rotation struct {
+	// MaxSize is the maximum size in megabytes of a log file before it gets rotated.
+	// The files are rotated at 100 megabytes when it is zero
+	MaxSize int `json:",omitempty"`
+	// MaxAge is the maximum number of days to retain the rotated files.
+	// The files are not removed by age when it is zero
+	MaxAge int `json:",omitempty"`
+	// MaxBackups is the maximum number of rotated files to retain.
+	// All files are retained when it is zero
+	MaxBackups int `json:",omitempty"`
+	// Compress determines if the rotated files are compressed using gzip
+	Compress bool `json:",omitempty"`
+}
+
+// Enabled returns true when any rotation field is set
+func (r Rotation) Enabled() bool {
+	return r.MaxSize != 0 || r.MaxAge != 0 || r.MaxBackups != 0 || r.Compress
 }
 
 // Server defines the server configuration
@@ -69,10 +133,68 @@ type Health struct {
 	Port int `json:",omitempty"`
 }
 
+// TLS defines the tls config of a client
+type TLS struct {
+	// CAFile is the path of the CA certificate used to verify the server
+	CAFile string `json:",omitempty"`
+	// CertFile is the path of the client certificate
+	CertFile string `json:",omitempty"`
+	// KeyFile is the path of the client private key
+	KeyFile string `json:",omitempty"`
+	// InsecureSkipVerify disables the verification of the server certificate
+	InsecureSkipVerify bool `json:",omitempty"`
+}
+
+// Peer is a service instance of the static discovery
+type Peer struct {
+	// ID is the service id. Common value: <Address>:<Port>
+	ID string `json:",omitempty"`
+	// Name is the service name: master or the graph id
+	Name string `json:",omitempty"`
+	// Address is the service address
+	Address string `json:",omitempty"`
+	// Port is the service port
+	Port int `json:",omitempty"`
+	// NodeType can be or 'master' or 'worker'
+	NodeType NodeType `json:",omitempty"`
+	// Tags are the service tags
+	Tags []string `json:",omitempty"`
+	// Meta are the service metadata
+	Meta map[string]string `json:",omitempty"`
+}
+
 // Discovery defines the discovery server
 type Discovery struct {
-	// Server is the server address
+	// Type is the discovery backend: consul, static, dns, etcd or memory. Common value: consul.
+	// The memory discovery is shared by the nodes running in the same process
+	Type string `json:",omitempty"`
+	// Server is the server address. The etcd endpoints are separated by commas and
+	// the dns server is the system resolver when it is empty
 	Server string `json:",omitempty"`
+	// Domain is the dns domain of the SRV records: <name>.<Domain>
+	Domain string `json:",omitempty"`
+	// Peers are the service instances of the static discovery
+	Peers []Peer `json:",omitempty"`
+	// Scheme is the uri scheme of the server: http or https. Common value: http
+	Scheme string `json:",omitempty"`
+	// Token is the acl token used to register the services
+	Token string `json:",omitempty" secret:"true"`
+	// Datacenter is the datacenter of the services. The agent datacenter is used when it is empty
+	Datacenter string `json:",omitempty"`
+	// Namespace is the namespace of the services (consul enterprise)
+	Namespace string `json:",omitempty"`
+	// TLS defines the tls config to connect to the server
+	TLS TLS `json:",omitempty"`
+	// ConfigKey is the consul kv key with the node config. The placeholders {<field path>}
+	// are replaced with the config values. i.e: carisa/workers/{graph-id} or carisa/nodes/{server.id}.
+	// The format is detected by the key extension (.yaml, .yml, .toml) and it is json
+	// by default. The key is watched to reload the config. The config is not read from consul when it is empty
+	ConfigKey string `json:",omitempty"`
+	// Tags are the custom tags published with the service. The node type is always published
+	Tags []string `json:",omitempty"`
+	// Meta are the custom metadata published with the service. i.e: zone, memory, data-port, algorithms.
+	// The version, node type and cores are always published
+	Meta map[string]string `json:",omitempty"`
 	// Ckeck checks the server heatlh
 	Health Health `json:",omitempty"`
 }
@@ -87,6 +209,50 @@ type Common struct {
 	Server `json:"server,omitempty"`
 }
 
+// Validate checks the common config adding the problems found into v
+func (c *Common) Validate(v *configp.Validator) {
+	v.Check(c.Zap.Encoding == "json" || c.Zap.Encoding == "console",
+		"log.encoding", "the encoding must be json or console")
+	v.Check(c.Zap.Rotation.MaxSize >= 0, "log.rotation.max-size", "the size cannot be negative")
+	v.Check(c.Zap.Rotation.MaxAge >= 0, "log.rotation.max-age", "the age cannot be negative")
+	v.Check(c.Zap.Rotation.MaxBackups >= 0, "log.rotation.max-backups", "the backups cannot be negative")
+
+	v.Check(len(c.Server.ID) > 0, "server.id", "the id cannot be empty")
+	v.Check(len(c.Server.Address) > 0, "server.address", "the address cannot be empty")
+	v.CheckPort(c.Server.Port, "server.port")
+
+	switch c.Discovery.Type {
+	case DiscoveryConsul, DiscoveryStatic, DiscoveryDNS, DiscoveryEtcd, DiscoveryMemory:
+	default:
+		v.Check(false, "discovery.type", "the type must be consul, static, dns, etcd or memory")
+	}
+	v.Check(len(c.Discovery.ConfigKey) == 0 || c.Discovery.Type == DiscoveryConsul,
+		"discovery.config-key", "the config key is only supported by consul")
+	for _, p := range c.Discovery.Peers {
+		v.Check(len(p.Name) > 0 && len(p.Address) > 0 && p.Port > 0 && p.Port <= 65535,
+			"discovery.peers", strings.Concat("the name, address and port of the peer are required: ", p.ID))
+	}
+	v.Check(len(c.Discovery.Scheme) == 0 || c.Discovery.Scheme == "http" || c.Discovery.Scheme == "https",
+		"discovery.scheme", "the scheme must be http or https")
+	v.Check(len(c.Discovery.TLS.CertFile) > 0 == (len(c.Discovery.TLS.KeyFile) > 0),
+		"discovery.tls.key-file", "the cert file and the key file must be set together")
+
+	for k := range c.Discovery.Meta {
+		v.Check(metaKey.MatchString(k), "discovery.meta", strings.Concat("the key is not valid: ", k))
+	}
+
+	h := c.Discovery.Health
+	v.CheckPort(h.Port, "discovery.health.port")
+	v.Check(h.Port != c.Server.Port, "discovery.health.port", "the health port must be distinct from the server port")
+	v.Check(h.Interval > 0, "discovery.health.interval", "the interval must be greater than zero")
+	v.Check(h.Timeout > 0, "discovery.health.timeout", "the timeout must be greater than zero")
+	v.Check(h.Timeout < h.Interval, "discovery.health.timeout", "the timeout must be less than the interval")
+	v.Check(h.FailuresBeforeCritical >= 0,
+		"discovery.health.failures-before-critical", "the failures cannot be negative")
+	v.Check(h.DeregisterCriticalServiceAfter > 0,
+		"discovery.health.deregister-critical-service-after", "the time must be greater than zero")
+}
+
 // Default defines the default common config
 func Default(typeNode NodeType, port int) Common {
 	if port == 0 {
@@ -98,6 +264,7 @@ func Default(typeNode NodeType, port int) Common {
 			Development: true,
 			Level:       zapcore.DebugLevel,
 			Encoding:    "console",
+			OutputPaths: []string{"stderr"},
 		},
 		Discovery: DefaultDiscovery(port + 1),
 		Server: Server{
@@ -111,6 +278,7 @@ func Default(typeNode NodeType, port int) Common {
 
 func DefaultDiscovery(port int) Discovery {
 	return Discovery{
+		Type: DiscoveryConsul,
 		Health: Health{
 			Interval:                       10,
 			Timeout:                        5,
@@ -20,6 +20,7 @@ package config
 import (
 	"testing"
 
+	configp "github.com/carisa/pkg/config"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap/zapcore"
 )
@@ -45,6 +46,7 @@ func TestDefault(t *testing.T) {
 					Development: true,
 					Level:       zapcore.DebugLevel,
 					Encoding:    "console",
+					OutputPaths: []string{"stderr"},
 				},
 				Discovery: DefaultDiscovery(62422 + 1),
 				Server: Server{
@@ -63,6 +65,7 @@ func TestDefault(t *testing.T) {
 					Development: true,
 					Level:       zapcore.DebugLevel,
 					Encoding:    "console",
+					OutputPaths: []string{"stderr"},
 				},
 				Discovery: DefaultDiscovery(3030 + 1),
 				Server: Server{
@@ -80,3 +83,89 @@ func TestDefault(t *testing.T) {
 		})
 	}
 }
+
+func TestCommon_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		common func() Common
+		fields []string
+	}{
+		{
+			name:   "Default config",
+			common: func() Common { return Default(Worker, 0) },
+		},
+		{
+			name: "Every field wrong",
+			common: func() Common {
+				c := Default(Worker, 0)
+				c.Zap.Encoding = "xml"
+				c.Zap.Rotation.MaxSize = -1
+				c.Discovery.Scheme = "ftp"
+				c.Discovery.Type = "zookeeper"
+				c.Discovery.Peers = []Peer{{ID: "p1"}}
+				c.Discovery.TLS.CertFile = "cert.pem"
+				c.Discovery.Meta = map[string]string{"data port": "8080"}
+				c.Server.ID = ""
+				c.Server.Address = ""
+				c.Server.Port = 0
+				c.Health.Port = 70000
+				c.Health.Interval = 5
+				c.Health.Timeout = 5
+				c.Health.DeregisterCriticalServiceAfter = 0
+				return c
+			},
+			fields: []string{
+				"log.encoding",
+				"log.rotation.max-size",
+				"server.id",
+				"server.address",
+				"server.port",
+				"discovery.type",
+				"discovery.peers",
+				"discovery.scheme",
+				"discovery.tls.key-file",
+				"discovery.meta",
+				"discovery.health.port",
+				"discovery.health.timeout",
+				"discovery.health.deregister-critical-service-after",
+			},
+		},
+		{
+			name: "Health port equal to server port",
+			common: func() Common {
+				c := Default(Worker, 0)
+				c.Health.Port = c.Server.Port
+				return c
+			},
+			fields: []string{"discovery.health.port"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v configp.Validator
+			c := tt.common()
+			c.Validate(&v)
+			err := v.Err()
+			if len(tt.fields) == 0 {
+				assert.NoError(t, err, "Valid")
+				return
+			}
+			var fields []string
+			for _, vl := range err.(*configp.ValidationError).Violations {
+				fields = append(fields, vl.Field)
+			}
+			assert.Equal(t, tt.fields, fields, "Fields")
+		})
+	}
+}
+
+func TestCommon_Redact(t *testing.T) {
+	cnf := Default(Worker, 0)
+	cnf.Discovery.Token = "acl-token"
+	cnf.Discovery.TLS.KeyFile = "/run/secrets/key.pem"
+
+	res := configp.Redact(&cnf)
+	assert.NotContains(t, res, "acl-token", "Token redacted")
+	assert.Contains(t, res, `"Token":"`+configp.Redacted+`"`, "Token placeholder")
+	assert.Contains(t, res, "/run/secrets/key.pem", "Key file path kept")
+}
@@ -18,23 +18,359 @@
 package config
 
 import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Names of the subsystem loggers
+const (
+	DiscoveryLogger = "discovery"
+	HealthLogger    = "health"
+	ComputeLogger   = "compute"
+	TransportLogger = "transport"
 )
 
-// NewLogger creates the zap logger
-func NewLogger(config Zap) *zap.Logger {
+// rotationScheme is the zap sink scheme for the rotated files
+const rotationScheme = "rotation"
+
+func init() {
+	if err := zap.RegisterSink(rotationScheme, newRotationSink); err != nil {
+		panic(strings.Concat("Error registering the zap rotation sink. Error: ", err.Error()))
+	}
+}
+
+// Logger is the zap logger whose levels and encoding can be changed at runtime.
+// Every subsystem has a named logger with its own level
+type Logger struct {
+	*zap.Logger
+	base   *zap.Logger
+	core   *atomic.Value
+	level  zap.AtomicLevel
+	config Zap
+	mu     sync.Mutex
+	named  map[string]*subsystem
+	// close closes the output files of the current core
+	close func()
+}
+
+type subsystem struct {
+	log   *zap.Logger
+	level zap.AtomicLevel
+}
+
+// NewLogger creates the zap logger with the subsystem loggers
+func NewLogger(config Zap) *Logger {
+	zlog, closeOut, skipped, err := build(config)
+	if err != nil {
+		panic(strings.Concat("Error creating zap logger. Error: ", err.Error()))
+	}
+
+	core := &atomic.Value{}
+	core.Store(coreHolder{Core: zlog.Core()})
+	base := zlog.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core {
+		return &swapCore{core: core}
+	}))
+
+	level := zap.NewAtomicLevelAt(config.Level)
+	l := &Logger{
+		Logger: withLevel(base, level),
+		base:   base,
+		core:   core,
+		level:  level,
+		config: config,
+		named:  make(map[string]*subsystem),
+		close:  closeOut,
+	}
+	for _, name := range []string{DiscoveryLogger, HealthLogger, ComputeLogger, TransportLogger} {
+		l.Named(name)
+	}
+	warnSkipped(l.Logger, skipped)
+	return l
+}
+
+// Apply changes the levels and the encoding of the loggers.
+// The subsystem loggers without level in config take the root level.
+// Only the levels that are different from the previous config are set,
+// so the levels changed at runtime are kept
+func (l *Logger) Apply(config Zap) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if config.Encoding != l.config.Encoding {
+		zlog, closeOut, skipped, err := build(config)
+		if err != nil {
+			return err
+		}
+		l.core.Store(coreHolder{Core: zlog.Core()})
+		l.close()
+		l.close = closeOut
+		warnSkipped(l.Logger, skipped)
+	}
+
+	if config.Level != l.config.Level {
+		l.level.SetLevel(config.Level)
+	}
+	for name, s := range l.named {
+		if lv := config.levelOf(name); lv != l.config.levelOf(name) {
+			s.level.SetLevel(lv)
+		}
+	}
+	l.config = config
+
+	return nil
+}
+
+// build creates the zap logger of the config. It returns the function that closes
+// the output files and the output urls that are not rotated
+func build(config Zap) (*zap.Logger, func(), []string, error) {
 	var logc zap.Config
 	if config.Development {
 		logc = zap.NewDevelopmentConfig()
 	} else {
 		logc = zap.NewProductionConfig()
 	}
-	logc.Level = zap.NewAtomicLevelAt(config.Level)
-	logc.Encoding = config.Encoding
-	log, err := logc.Build()
+	var skipped []string
+	if len(config.OutputPaths) > 0 {
+		logc.OutputPaths, skipped = outputPaths(config.OutputPaths, config.Rotation)
+	}
+
+	var enc zapcore.Encoder
+	switch config.Encoding {
+	case "json":
+		enc = zapcore.NewJSONEncoder(logc.EncoderConfig)
+	case "console":
+		enc = zapcore.NewConsoleEncoder(logc.EncoderConfig)
+	default:
+		return nil, nil, nil, errors.New(strings.Concat("the log encoding is not valid. Encoding: ", config.Encoding))
+	}
+
+	// The sinks are opened here instead of zap.Config.Build, so they can be closed when the core is replaced
+	out, closeOut, err := zap.Open(logc.OutputPaths...)
 	if err != nil {
-		panic(strings.Concat("Error creating zap logger. Error: ", err.Error()))
+		return nil, nil, nil, err
+	}
+	errOut, closeErr, err := zap.Open(logc.ErrorOutputPaths...)
+	if err != nil {
+		closeOut()
+		return nil, nil, nil, err
+	}
+
+	// The core writes every level and each logger filters by its own level
+	core := zapcore.NewCore(enc, out, zapcore.DebugLevel)
+	opts := []zap.Option{zap.ErrorOutput(errOut), zap.AddCaller()}
+	if config.Development {
+		opts = append(opts, zap.Development(), zap.AddStacktrace(zapcore.WarnLevel))
+	} else {
+		opts = append(opts, zap.AddStacktrace(zapcore.ErrorLevel))
+		core = zapcore.NewSamplerWithOptions(core, time.Second, logc.Sampling.Initial, logc.Sampling.Thereafter)
+	}
+
+	closeAll := func() {
+		closeOut()
+		closeErr()
+	}
+	return zap.New(core, opts...), closeAll, skipped, nil
+}
+
+// warnSkipped logs the output urls that are not rotated
+func warnSkipped(log *zap.Logger, skipped []string) {
+	for _, p := range skipped {
+		log.Warn("The log output is an url and it is not rotated", zap.String("Path", p))
+	}
+}
+
+// Named returns the logger of a subsystem creating it if it does not exist
+func (l *Logger) Named(name string) *zap.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s, ok := l.named[name]; ok {
+		return s.log
+	}
+
+	level := zap.NewAtomicLevelAt(l.config.levelOf(name))
+	s := &subsystem{
+		log:   withLevel(l.base.Named(name), level),
+		level: level,
+	}
+	l.named[name] = s
+	return s.log
+}
+
+// Level returns the level of the named logger.
+// The root level is returned when the name is empty
+func (l *Logger) Level(name string) (zap.AtomicLevel, bool) {
+	if len(name) == 0 {
+		return l.level, true
 	}
-	return log
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.named[name]
+	if !ok {
+		return zap.AtomicLevel{}, false
+	}
+	return s.level, true
+}
+
+// Names returns the sorted names of the subsystem loggers
+func (l *Logger) Names() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	names := make([]string, 0, len(l.named))
+	for name := range l.named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withLevel filters the logs of the logger by the level
+func withLevel(log *zap.Logger, level zap.AtomicLevel) *zap.Logger {
+	return log.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &levelCore{Core: c, level: level}
+	}))
+}
+
+// coreHolder keeps the same concrete type into the atomic value
+type coreHolder struct {
+	zapcore.Core
+}
+
+// swapCore delegates to a core that can be replaced at runtime
+type swapCore struct {
+	core   *atomic.Value
+	fields []zapcore.Field
+}
+
+func (c *swapCore) load() zapcore.Core {
+	core := c.core.Load().(coreHolder).Core
+	if len(c.fields) > 0 {
+		return core.With(c.fields)
+	}
+	return core
+}
+
+func (c *swapCore) Enabled(lvl zapcore.Level) bool {
+	return c.load().Enabled(lvl)
+}
+
+func (c *swapCore) With(fields []zapcore.Field) zapcore.Core {
+	fs := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	fs = append(fs, c.fields...)
+	return &swapCore{core: c.core, fields: append(fs, fields...)}
+}
+
+func (c *swapCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.load().Check(e, ce)
+}
+
+func (c *swapCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	return c.load().Write(e, fields)
+}
+
+func (c *swapCore) Sync() error {
+	return c.load().Sync()
+}
+
+// levelCore is a core that only writes the entries enabled by its level
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.level.Enabled(lvl)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *levelCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(e.Level) {
+		return ce
+	}
+	return c.Core.Check(e, ce)
+}
+
+// urlScheme matches the paths that start with an url scheme. The single letter
+// schemes are not matched because they are windows drives. i.e: C:\logs
+var urlScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]+:`)
+
+// outputPaths routes the files through the rotation sink when the rotation is enabled.
+// It returns the urls that are not rotated, so they can be reported
+func outputPaths(paths []string, rotation Rotation) ([]string, []string) {
+	if !rotation.Enabled() {
+		return paths, nil
+	}
+
+	q := url.Values{}
+	q.Set("maxSize", strconv.Itoa(rotation.MaxSize))
+	q.Set("maxAge", strconv.Itoa(rotation.MaxAge))
+	q.Set("maxBackups", strconv.Itoa(rotation.MaxBackups))
+	q.Set("compress", strconv.FormatBool(rotation.Compress))
+
+	res := make([]string, len(paths))
+	var skipped []string
+	for i, p := range paths {
+		if p == "stdout" || p == "stderr" {
+			res[i] = p
+			continue
+		}
+		if urlScheme.MatchString(p) {
+			res[i] = p
+			skipped = append(skipped, p)
+			continue
+		}
+		u := url.URL{Scheme: rotationScheme, Opaque: url.PathEscape(p), RawQuery: q.Encode()}
+		res[i] = u.String()
+	}
+	return res, skipped
+}
+
+// rotationSink writes the logs in a file rotated by lumberjack
+type rotationSink struct {
+	*lumberjack.Logger
+}
+
+// Sync does nothing because lumberjack does not buffer the writes
+func (rotationSink) Sync() error {
+	return nil
+}
+
+func newRotationSink(u *url.URL) (zap.Sink, error) {
+	q := u.Query()
+	maxSize, _ := strconv.Atoi(q.Get("maxSize"))
+	maxAge, _ := strconv.Atoi(q.Get("maxAge"))
+	maxBackups, _ := strconv.Atoi(q.Get("maxBackups"))
+	compress, _ := strconv.ParseBool(q.Get("compress"))
+
+	file, err := url.PathUnescape(u.Opaque)
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("the rotation file is not valid. File: ", u.Opaque))
+	}
+
+	return rotationSink{
+		Logger: &lumberjack.Logger{
+			Filename:   file,
+			MaxSize:    maxSize,
+			MaxAge:     maxAge,
+			MaxBackups: maxBackups,
+			Compress:   compress,
+		},
+	}, nil
 }
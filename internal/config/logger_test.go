@@ -18,10 +18,15 @@
 package config
 
 import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestNewLogger(t *testing.T) {
@@ -61,3 +66,150 @@ func TestNewLogger(t *testing.T) {
 		})
 	}
 }
+
+func TestNewLogger_Rotation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "carisa.log")
+	alog := NewLogger(Zap{
+		Level:       zap.InfoLevel,
+		Encoding:    "json",
+		OutputPaths: []string{"stderr", file},
+		Rotation: Rotation{
+			MaxBackups: 2,
+		},
+	})
+	alog.Info("Rotated log")
+
+	_, err := os.Stat(file)
+	assert.NoError(t, err, "Log file")
+
+	file = filepath.Join(t.TempDir(), "carisa?#%.log")
+	alog = NewLogger(Zap{
+		Level:       zap.InfoLevel,
+		Encoding:    "json",
+		OutputPaths: []string{file},
+		Rotation:    Rotation{MaxAge: 1},
+	})
+	alog.Info("Rotated log")
+	_, err = os.Stat(file)
+	assert.NoError(t, err, "Escaped log file")
+}
+
+func TestOutputPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		rotation Rotation
+		res      []string
+		skipped  []string
+	}{
+		{
+			name:  "Without rotation",
+			paths: []string{"stderr", "carisa.log"},
+			res:   []string{"stderr", "carisa.log"},
+		},
+		{
+			name:     "With rotation",
+			paths:    []string{"stdout", "/var/log/carisa.log", "file:///tmp/carisa.log"},
+			rotation: Rotation{MaxSize: 10, MaxAge: 7, MaxBackups: 3, Compress: true},
+			res: []string{
+				"stdout",
+				"rotation:%2Fvar%2Flog%2Fcarisa.log?compress=true&maxAge=7&maxBackups=3&maxSize=10",
+				"file:///tmp/carisa.log",
+			},
+			skipped: []string{"file:///tmp/carisa.log"},
+		},
+		{
+			name:     "Rotation by age",
+			paths:    []string{"carisa.log"},
+			rotation: Rotation{MaxAge: 7},
+			res:      []string{"rotation:carisa.log?compress=false&maxAge=7&maxBackups=0&maxSize=0"},
+		},
+		{
+			name:     "Escaped paths",
+			paths:    []string{`C:\logs\carisa.log`, "/var/log/carisa?#%.log"},
+			rotation: Rotation{Compress: true},
+			res: []string{
+				"rotation:C:%5Clogs%5Ccarisa.log?compress=true&maxAge=0&maxBackups=0&maxSize=0",
+				"rotation:%2Fvar%2Flog%2Fcarisa%3F%23%25.log?compress=true&maxAge=0&maxBackups=0&maxSize=0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, skipped := outputPaths(tt.paths, tt.rotation)
+			assert.Equal(t, tt.res, res, "Paths")
+			assert.Equal(t, tt.skipped, skipped, "Skipped")
+		})
+	}
+}
+
+func TestLogger_Named(t *testing.T) {
+	alog := NewLogger(Zap{
+		Level:    zap.InfoLevel,
+		Levels:   map[string]zapcore.Level{HealthLogger: zap.ErrorLevel},
+		Encoding: "console",
+	})
+
+	assert.Equal(t, alog.Named(DiscoveryLogger), alog.Named(DiscoveryLogger), "Same logger")
+	assert.Equal(t, []string{ComputeLogger, DiscoveryLogger, HealthLogger, TransportLogger}, alog.Names(), "Names")
+
+	assert.False(t, alog.Core().Enabled(zap.DebugLevel), "Root debug")
+	assert.True(t, alog.Named(DiscoveryLogger).Core().Enabled(zap.InfoLevel), "Discovery info")
+	assert.False(t, alog.Named(HealthLogger).Core().Enabled(zap.InfoLevel), "Health info")
+
+	lv, ok := alog.Level(DiscoveryLogger)
+	if assert.True(t, ok, "Discovery level") {
+		lv.SetLevel(zap.DebugLevel)
+	}
+	assert.True(t, alog.Named(DiscoveryLogger).Core().Enabled(zap.DebugLevel), "Discovery debug")
+	assert.False(t, alog.Core().Enabled(zap.DebugLevel), "Root remains info")
+
+	_, ok = alog.Level("unknown")
+	assert.False(t, ok, "Unknown logger")
+}
+
+func TestLogger_Apply(t *testing.T) {
+	alog := NewLogger(Zap{Level: zap.InfoLevel, Encoding: "console"})
+	named := alog.Named(DiscoveryLogger)
+
+	err := alog.Apply(Zap{
+		Level:    zap.WarnLevel,
+		Levels:   map[string]zapcore.Level{DiscoveryLogger: zap.DebugLevel},
+		Encoding: "json",
+	})
+	if assert.NoError(t, err, "Apply") {
+		assert.False(t, alog.Core().Enabled(zap.InfoLevel), "Root level")
+		assert.True(t, named.Core().Enabled(zap.DebugLevel), "Discovery level")
+		assert.False(t, alog.Named(HealthLogger).Core().Enabled(zap.InfoLevel), "Health takes the root level")
+		named.Debug("Logged with the json encoding")
+	}
+
+	assert.Error(t, alog.Apply(Zap{Encoding: "xml"}), "Bad encoding")
+}
+
+// closeSink counts the closed sinks
+type closeSink struct {
+	closed *int32
+}
+
+func (closeSink) Write(p []byte) (int, error) { return len(p), nil }
+func (closeSink) Sync() error                 { return nil }
+func (s closeSink) Close() error {
+	atomic.AddInt32(s.closed, 1)
+	return nil
+}
+
+func TestLogger_Apply_Closes_Sinks(t *testing.T) {
+	var closed int32
+	err := zap.RegisterSink("closetest", func(*url.URL) (zap.Sink, error) {
+		return closeSink{closed: &closed}, nil
+	})
+	assert.NoError(t, err, "Register sink")
+
+	alog := NewLogger(Zap{Level: zap.InfoLevel, Encoding: "console", OutputPaths: []string{"closetest:log"}})
+	assert.NoError(t, alog.Apply(Zap{Level: zap.InfoLevel, Encoding: "json", OutputPaths: []string{"closetest:log"}}))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&closed), "Previous sink closed")
+
+	assert.NoError(t, alog.Apply(Zap{Level: zap.WarnLevel, Encoding: "json", OutputPaths: []string{"closetest:log"}}))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&closed), "Sink kept without encoding changes")
+}
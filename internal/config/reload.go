@@ -0,0 +1,88 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ReloadInterval is the frequency to check if the config file has changed
+const ReloadInterval = 5 * time.Second
+
+// mutable are the fields that can be changed at runtime
+var mutable = map[string]bool{
+	"log.level":                 true,
+	"log.levels":                true,
+	"log.encoding":              true,
+	"discovery.tags":            true,
+	"discovery.meta":            true,
+	"discovery.health.interval": true,
+	"discovery.health.timeout":  true,
+	"discovery.health.failures-before-critical":          true,
+	"discovery.health.deregister-critical-service-after": true,
+}
+
+// Reload applies to current the mutable fields of changed: log levels and encoding,
+// discovery tags and metadata and health intervals. The diff are the paths of the fields changed and the
+// changes of immutable fields are rejected. It returns true when the
+// discovery registration must be applied again
+func Reload(log *Logger, current *Common, changed Common, diff []string) bool {
+	register := false
+	logChanged := false
+	for _, path := range diff {
+		if !mutable[path] {
+			log.Error(
+				"The config field cannot be changed at runtime. The change is rejected and it requires a restart",
+				zap.String("Field", path))
+			continue
+		}
+		log.Info("Reloading config field", zap.String("Field", path))
+		if strings.HasPrefix(path, "discovery.") {
+			register = true
+		}
+		if strings.HasPrefix(path, "log.") {
+			logChanged = true
+		}
+	}
+
+	// The logger is not applied when the log config has not changed,
+	// so the levels changed at runtime are kept
+	if logChanged {
+		z := current.Zap
+		z.Level = changed.Zap.Level
+		z.Levels = changed.Zap.Levels
+		z.Encoding = changed.Zap.Encoding
+		if err := log.Apply(z); err != nil {
+			log.Error("The log config cannot be reloaded", zap.String("Error", err.Error()))
+		} else {
+			current.Zap = z
+		}
+	}
+
+	current.Discovery.Tags = changed.Discovery.Tags
+	current.Discovery.Meta = changed.Discovery.Meta
+	current.Health.Interval = changed.Health.Interval
+	current.Health.Timeout = changed.Health.Timeout
+	current.Health.FailuresBeforeCritical = changed.Health.FailuresBeforeCritical
+	current.Health.DeregisterCriticalServiceAfter = changed.Health.DeregisterCriticalServiceAfter
+
+	return register
+}
@@ -0,0 +1,91 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	configp "github.com/carisa/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReload(t *testing.T) {
+	current := Default(Worker, 0)
+	log := NewLogger(current.Zap)
+
+	changed := current
+	changed.Server.ID = "other"
+	changed.Zap.Level = zap.ErrorLevel
+	changed.Zap.Encoding = "json"
+	changed.Health.Interval = 20
+	changed.Discovery.Meta = map[string]string{"zone": "eu-1"}
+
+	diff, _ := configp.Diff(&current, &changed)
+	register := Reload(log, &current, changed, diff)
+
+	assert.True(t, register, "Register")
+	assert.NotEqual(t, "other", current.Server.ID, "Server ID rejected")
+	assert.Equal(t, zap.ErrorLevel, current.Zap.Level, "Level")
+	assert.Equal(t, "json", current.Zap.Encoding, "Encoding")
+	assert.Equal(t, 20, current.Health.Interval, "Interval")
+	assert.Equal(t, "eu-1", current.Discovery.Meta["zone"], "Meta")
+	assert.False(t, log.Core().Enabled(zap.WarnLevel), "Logger level")
+}
+
+func TestReload_Only_Log(t *testing.T) {
+	current := Default(Worker, 0)
+	log := NewLogger(current.Zap)
+
+	changed := current
+	changed.Zap.Level = zap.InfoLevel
+
+	diff, _ := configp.Diff(&current, &changed)
+	assert.False(t, Reload(log, &current, changed, diff), "Register")
+	assert.Equal(t, zap.InfoLevel, current.Zap.Level, "Level")
+}
+
+func TestReload_Deregister_After(t *testing.T) {
+	current := Default(Worker, 0)
+	log := NewLogger(current.Zap)
+
+	changed := current
+	changed.Health.DeregisterCriticalServiceAfter = 30
+	diff, _ := configp.Diff(&current, &changed)
+	assert.True(t, Reload(log, &current, changed, diff), "Register")
+	assert.Equal(t, 30, current.Health.DeregisterCriticalServiceAfter, "Deregister after")
+}
+
+func TestReload_Keeps_Runtime_Levels(t *testing.T) {
+	current := Default(Worker, 0)
+	log := NewLogger(current.Zap)
+	lv, _ := log.Level(HealthLogger)
+	lv.SetLevel(zap.ErrorLevel)
+
+	changed := current
+	changed.Health.Interval = 20
+	diff, _ := configp.Diff(&current, &changed)
+	Reload(log, &current, changed, diff)
+	assert.Equal(t, zap.ErrorLevel, lv.Level(), "Health level kept without log changes")
+
+	changed = current
+	changed.Zap.Encoding = "json"
+	diff, _ = configp.Diff(&current, &changed)
+	Reload(log, &current, changed, diff)
+	assert.Equal(t, zap.ErrorLevel, lv.Level(), "Health level kept when its level has not changed")
+}
@@ -0,0 +1,165 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package local
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/master"
+	"github.com/carisa/internal/worker"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// pollInterval is the interval to check the leadership of the master and the state of the job
+const pollInterval = 50 * time.Millisecond
+
+// Config defines the local cluster
+type Config struct {
+	// Workers is the number of workers and the number of partitions of the jobs. Common value: 1
+	Workers int
+	// GraphID is the graph id of the workers
+	GraphID string
+	// MasterConfig is the master config file. The defaults are used when it is empty
+	MasterConfig string
+	// WorkerConfig is the config file of the workers. The defaults are used when it is empty
+	WorkerConfig string
+	// Port is the first port of the nodes. The master takes the first two ports (server and health),
+	// the workers the next ones and the admin api of the master the one after them. Common value: master.MasterPort
+	Port int
+	// DataDir is the data dir of the master. The input and the output of the job are relative to it.
+	// The one of the master config is used when it is empty. Common value: .
+	DataDir string
+	// Job is the job run over the workers. The cluster serves until stop is closed when it has no algorithm
+	Job master.Job
+}
+
+// Run runs a master and the workers in the process until stop is closed.
+// The nodes are registered into the memory discovery of the process and the leader
+// runs the partitions of the jobs in its engine through the loopback transport.
+// When the config has a job, it is submitted to the leader and the nodes are stopped
+// when it ends. The state of the job is returned
+func Run(cnf Config, stop <-chan struct{}) (master.Job, error) {
+	if cnf.Workers <= 0 {
+		cnf.Workers = 1
+	}
+	if cnf.Port == 0 {
+		cnf.Port = master.MasterPort
+	}
+
+	// The factories are built first, so a wrong config does not start any node
+	mflags := nodeFlags(cnf.Port)
+	mflags["partitions"] = strconv.Itoa(cnf.Workers)
+	mflags["admin.port"] = strconv.Itoa(cnf.Port + 2*(cnf.Workers+1))
+	if len(cnf.DataDir) > 0 {
+		mflags["data-dir"] = cnf.DataDir
+	}
+	mf := master.FactoryBuild(cnf.MasterConfig, mflags)
+	wfs := make([]*worker.Factory, cnf.Workers)
+	for i := range wfs {
+		flags := nodeFlags(cnf.Port + 2*(i+1))
+		flags["graph-id"] = cnf.GraphID
+		wfs[i] = worker.FactoryBuild(cnf.WorkerConfig, flags)
+	}
+
+	// The nodes are stopped when stop is closed or the job ends
+	nodes := make(chan struct{})
+	var once sync.Once
+	halt := func() { once.Do(func() { close(nodes) }) }
+	go func() {
+		select {
+		case <-stop:
+			halt()
+		case <-nodes:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(len(wfs) + 1)
+	go func() {
+		defer wg.Done()
+		master.Run(mf, nodes)
+	}()
+	for _, wf := range wfs {
+		go func(wf *worker.Factory) {
+			defer wg.Done()
+			worker.Run(wf, nodes)
+		}(wf)
+	}
+
+	var job master.Job
+	var err error
+	if len(cnf.Job.Algorithm) > 0 {
+		cnf.Job.GraphID = cnf.GraphID
+		job, err = runJob(mf, cnf.Job, nodes)
+		halt()
+	}
+	wg.Wait()
+	return job, err
+}
+
+// runJob submits the job when the master is the leader and waits until it ends or stop is closed
+func runJob(mf *master.Factory, job master.Job, stop <-chan struct{}) (master.Job, error) {
+	tick := time.NewTicker(pollInterval)
+	defer tick.Stop()
+
+	submitted := false
+	for {
+		select {
+		case <-stop:
+			return job, errors.New(strings.Concat("the local cluster has been stopped before the end of the job. Job: ", job.ID))
+		case <-tick.C:
+		}
+
+		if !submitted {
+			j, err := mf.Submit(job)
+			if errors.Is(err, master.ErrNotLeader) {
+				continue
+			}
+			if err != nil {
+				return job, err
+			}
+			job, submitted = j, true
+			continue
+		}
+
+		j, err := mf.Job(job.ID)
+		if err != nil {
+			return job, err
+		}
+		if job = j; job.InFlight() {
+			continue
+		}
+		if job.Status == master.StatusFailed {
+			return job, errors.New(strings.Concat("the job failed. Job: ", job.ID, ". Error: ", job.Message))
+		}
+		return job, nil
+	}
+}
+
+// nodeFlags returns the flags of a node that uses the port and the next one for health
+func nodeFlags(port int) map[string]string {
+	return map[string]string{
+		"discovery.type":        config.DiscoveryMemory,
+		"server.port":           strconv.Itoa(port),
+		"discovery.health.port": strconv.Itoa(port + 1),
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/master"
+	"github.com/carisa/internal/net"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	os.Unsetenv("CARISA_MASTER_CONFIG_JSON")
+	os.Unsetenv("CARISA_WORKER_CONFIG_JSON")
+
+	d := net.NewMemoryDiscovery(log.TestLogger(), net.ProcessRegistry)
+	watch := make(chan struct{})
+	defer close(watch)
+	workers := d.Watch("gi", watch)
+	masters := d.Watch(string(config.Master), watch)
+	<-workers
+	<-masters
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = Run(Config{Workers: 2, GraphID: "gi", Port: 55422}, stop)
+	}()
+
+	waitServices(t, workers, 2)
+	waitServices(t, masters, 1)
+	assert.Eventually(t, func() bool {
+		srvs, _ := d.Services(string(config.Master))
+		_, ok := net.Leader(srvs, "")
+		return ok
+	}, 10*time.Second, 10*time.Millisecond, "Master leader")
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "The local cluster has not been stopped")
+	}
+	srvs, _ := d.Services("gi")
+	assert.Empty(t, srvs, "Workers deregistered")
+}
+
+func TestRun_Job(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CARISA_MASTER_CONFIG_JSON", `{
+		"eventDir": "`+filepath.Join(dir, "events")+`",
+		"state": {"Dir": "`+filepath.Join(dir, "state")+`"},
+		"checkpoints": {"Dir": "`+filepath.Join(dir, "checkpoints")+`", "Interval": 1}
+	}`)
+	os.Unsetenv("CARISA_WORKER_CONFIG_JSON")
+	output := filepath.Join(dir, "wcc.txt")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "edges.txt"), []byte("a b\nb c\nd e\n"), 0600), "Input")
+
+	job, err := Run(Config{
+		Workers: 2,
+		GraphID: "job",
+		Port:    57422,
+		DataDir: dir,
+		Job:     master.Job{ID: "wcc", Algorithm: "wcc", Input: "edges.txt", Output: "wcc.txt", Undirected: true},
+	}, make(chan struct{}))
+	if assert.NoError(t, err, "Job") {
+		assert.Equal(t, master.StatusFinished, job.Status, "Finished")
+		assert.Equal(t, 2, job.Partitions, "A partition by worker")
+	}
+	out, err := os.ReadFile(output)
+	if assert.NoError(t, err, "Output") {
+		assert.Equal(t, "a\ta\nb\ta\nc\ta\nd\td\ne\td\n", string(out), "Components")
+	}
+
+	d := net.NewMemoryDiscovery(log.TestLogger(), net.ProcessRegistry)
+	srvs, _ := d.Services("job")
+	assert.Empty(t, srvs, "Workers stopped when the job ends")
+
+	_, err = Run(Config{
+		GraphID: "job",
+		Port:    57422,
+		Job:     master.Job{Algorithm: "unknown", Input: "edges.txt"},
+	}, make(chan struct{}))
+	assert.ErrorIs(t, err, master.ErrJobNotValid, "Job not valid")
+}
+
+func TestRun_Config_Error(t *testing.T) {
+	assert.Panics(t, func() { _, _ = Run(Config{Port: 56422}, make(chan struct{})) }, "Graph id empty")
+}
+
+func waitServices(t *testing.T, ch <-chan []net.Service, n int) {
+	for {
+		select {
+		case srvs := <-ch:
+			if len(srvs) == n {
+				return
+			}
+		case <-time.After(10 * time.Second):
+			assert.Fail(t, "The services have not been registered")
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const jobsPath = "/jobs/"
+
+// newAPIHandler creates the http routes of the master api
+func newAPIHandler(log *config.Logger, events EventLog, state StateStore, jobs *runner) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(strings.TrimSuffix(jobsPath, "/"), jobsHandler(log.Logger, state, jobs))
+	mux.HandleFunc(jobsPath, jobHandler(log.Logger, events, state))
+	return mux
+}
+
+// newAdminHandler creates the http routes of the admin api. It is served apart from the job api
+func newAdminHandler(log *config.Logger) http.Handler {
+	mux := http.NewServeMux()
+	net.AdminHandler(mux, log)
+	return mux
+}
+
+// jobsHandler returns the state of every job: GET /jobs
+// and submits a job: POST /jobs with the job definition
+func jobsHandler(log *zap.Logger, state StateStore, jobs *runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			submitJob(log, w, r, jobs)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		jobs, err := state.Jobs()
+		if err != nil {
+			log.Error("The jobs state cannot be read", zap.String("Error", err.Error()))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(log, w, jobs)
+	}
+}
+
+// jobHandler returns the state of a job: GET /jobs/{id}
+// and the events of a job: GET /jobs/{id}/events?type=...
+func jobHandler(log *zap.Logger, events EventLog, state StateStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		params := strings.Split(strings.TrimPrefix(r.URL.Path, jobsPath), "/")
+		if len(params[0]) == 0 || len(params) > 2 || (len(params) == 2 && params[1] != "events") {
+			http.NotFound(w, r)
+			return
+		}
+		if len(params) == 1 {
+			jobState(log, w, state, params[0])
+			return
+		}
+
+		types := make([]EventType, 0, len(r.URL.Query()["type"]))
+		for _, t := range r.URL.Query()["type"] {
+			types = append(types, EventType(t))
+		}
+
+		evs, err := events.Events(params[0], types...)
+		if err != nil {
+			if errors.Is(err, ErrJobEventsNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Error("The job events cannot be read", zap.String("JobID", params[0]), zap.String("Error", err.Error()))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(log, w, evs)
+	}
+}
+
+// submitJob runs the job of the request body and returns its state
+func submitJob(log *zap.Logger, w http.ResponseWriter, r *http.Request, jobs *runner) {
+	var job Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := jobs.submit(job)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrJobNotValid):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrJobExists):
+			status = http.StatusConflict
+		case errors.Is(err, ErrNotLeader):
+			status = http.StatusServiceUnavailable
+		default:
+			log.Error("The job cannot be submitted", zap.String("JobID", job.ID), zap.String("Error", err.Error()))
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(log, w, res)
+}
+
+func jobState(log *zap.Logger, w http.ResponseWriter, state StateStore, id string) {
+	job, err := state.Job(id)
+	if err != nil {
+		if errors.Is(err, ErrJobNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Error("The job state cannot be read", zap.String("JobID", id), zap.String("Error", err.Error()))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(log, w, job)
+}
+
+func writeJSON(log *zap.Logger, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("The response cannot be written", zap.String("Error", err.Error()))
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	stds "strings"
+	"testing"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_JobEvents(t *testing.T) {
+	events := NewFileEventLog(log.TestLogger(), t.TempDir())
+	_ = events.Append(Event{JobID: "job", Type: JobSubmitted})
+	_ = events.Append(Event{JobID: "job", Type: JobFinished})
+
+	h := newAPIHandler(config.NewLogger(config.Zap{Encoding: "console"}), events, nil, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+		len    int
+	}{
+		{
+			name:   "All job events",
+			method: http.MethodGet,
+			url:    "/jobs/job/events",
+			status: http.StatusOK,
+			len:    2,
+		},
+		{
+			name:   "Job events filtered by type",
+			method: http.MethodGet,
+			url:    "/jobs/job/events?type=jobFinished",
+			status: http.StatusOK,
+			len:    1,
+		},
+		{
+			name:   "Job not found",
+			method: http.MethodGet,
+			url:    "/jobs/unknown/events",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Bad route",
+			method: http.MethodGet,
+			url:    "/jobs/job/other",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Method not allowed",
+			method: http.MethodPost,
+			url:    "/jobs/job/events",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.url, nil))
+			assert.Equal(t, tt.status, rec.Code, "Status")
+			if tt.status == http.StatusOK {
+				var evs []Event
+				if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &evs), "Unmarshal") {
+					assert.Len(t, evs, tt.len, "Events")
+				}
+			}
+		})
+	}
+}
+
+func TestAPI_Jobs(t *testing.T) {
+	state := NewFileStateStore(log.TestLogger(), t.TempDir())
+	_ = state.Save(Job{ID: "job", Status: StatusRunning})
+
+	h := newAPIHandler(config.NewLogger(config.Zap{Encoding: "console"}), nil, state, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Jobs status")
+	var jobs []Job
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jobs), "Jobs") {
+		assert.Len(t, jobs, 1, "Jobs")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/job", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Job status")
+	var job Job
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job), "Job") {
+		assert.Equal(t, StatusRunning, job.Status, "Job")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "Job not found")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/jobs", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, "Method not allowed")
+}
+
+func TestAPI_Submit(t *testing.T) {
+	r, _ := testRunner(t)
+	h := newAPIHandler(config.NewLogger(config.Zap{Encoding: "console"}), r.events, r.state, r)
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs", stds.NewReader(body)))
+		return rec
+	}
+
+	rec := submit(`{"id": "wcc", "graphID": "graph", "algorithm": "wcc", "input": "edges.txt"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code, "Submitted")
+	var job Job
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job), "Job") {
+		assert.Equal(t, "wcc", job.ID, "Job id")
+	}
+	assert.Equal(t, StatusFinished, waitJob(t, r, "wcc").Status, "Finished")
+
+	assert.Equal(t, http.StatusConflict, submit(`{"id": "wcc", "graphID": "graph", "algorithm": "wcc", "input": "edges.txt"}`).Code, "Duplicated")
+	assert.Equal(t, http.StatusBadRequest, submit(`{"graphID": "graph", "algorithm": "unknown", "input": "edges.txt"}`).Code, "Not valid")
+	assert.Equal(t, http.StatusBadRequest, submit(`{"graphID": `).Code, "Bad body")
+
+	r.lead(false)
+	assert.Equal(t, http.StatusServiceUnavailable, submit(`{"graphID": "graph", "algorithm": "wcc", "input": "edges.txt"}`).Code, "Standby")
+}
+
+func TestAPI_Admin(t *testing.T) {
+	log := config.NewLogger(config.Zap{Encoding: "console"})
+	rec := httptest.NewRecorder()
+	newAdminHandler(log).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, net.LogLevelsPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Status")
+
+	rec = httptest.NewRecorder()
+	newAPIHandler(log, nil, nil, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPut, net.LogLevelPath, stds.NewReader(`{"level": "error"}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "Not in the job api")
+}
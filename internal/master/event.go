@@ -0,0 +1,183 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// EventType is the kind of a job event
+type EventType string
+
+const (
+	JobSubmitted       EventType = "jobSubmitted"
+	SuperstepStarted   EventType = "superstepStarted"
+	SuperstepCompleted EventType = "superstepCompleted"
+	CheckpointTaken    EventType = "checkpointTaken"
+	Recovery           EventType = "recovery"
+	JobFinished        EventType = "jobFinished"
+)
+
+// ErrJobEventsNotFound is returned when a job has no events
+var ErrJobEventsNotFound = errors.New("the job has no events")
+
+// Event is a structured record of something happened in a job
+type Event struct {
+	// Time is when the event happened. It is set on append if it is empty
+	Time time.Time `json:"time"`
+	// JobID identifies the job
+	JobID string `json:"jobID"`
+	// Type is the kind of event
+	Type EventType `json:"type"`
+	// Superstep is the superstep number of the event
+	Superstep int `json:"superstep,omitempty"`
+	// Counts are the counters of the event. i.e: active vertices, messages sent
+	Counts map[string]int64 `json:"counts,omitempty"`
+	// Checkpoint is the checkpoint reference
+	Checkpoint string `json:"checkpoint,omitempty"`
+	// Message describes the event. i.e: the error of a failed job
+	Message string `json:"message,omitempty"`
+}
+
+// EventLog defines an append-only log of job events
+type EventLog interface {
+	// Append writes the event at the end of the job log
+	Append(e Event) error
+	// Events returns the job events filtered by type.
+	// All events are returned when no type is specified
+	Events(jobID string, types ...EventType) ([]Event, error)
+}
+
+// FileEventLog writes the events of every job in a json lines file
+type FileEventLog struct {
+	log *zap.Logger
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileEventLog creates an event log into the dir directory
+func NewFileEventLog(log *zap.Logger, dir string) *FileEventLog {
+	return &FileEventLog{
+		log: log,
+		dir: dir,
+	}
+}
+
+// Append writes the event at the end of the job file
+func (l *FileEventLog) Append(e Event) error {
+	name, err := l.file(e.JobID)
+	if err != nil {
+		return err
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	r, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot marshal the event. Job: ", e.JobID))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(l.dir, 0750); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot create the event directory. Dir: ", l.dir))
+	}
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot open the event file. File: ", name))
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(r, '\n')); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot write the event. File: ", name))
+	}
+
+	l.log.Debug(
+		"Job event appended",
+		zap.String("JobID", e.JobID),
+		zap.String("Type", string(e.Type)),
+		zap.Int("Superstep", e.Superstep))
+
+	return nil
+}
+
+// Events reads the job file and returns the events filtered by type
+func (l *FileEventLog) Events(jobID string, types ...EventType) ([]Event, error) {
+	name, err := l.file(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrap(ErrJobEventsNotFound, strings.Concat("Job: ", jobID))
+		}
+		return nil, errors.Wrap(err, strings.Concat("cannot open the event file. File: ", name))
+	}
+	defer f.Close()
+
+	events := []Event{}
+	dec := json.NewDecoder(f)
+	for {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, strings.Concat("cannot unmarshal the event. File: ", name))
+		}
+		if matchEvent(e, types) {
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
+
+func (l *FileEventLog) file(jobID string) (string, error) {
+	if !validID(jobID) {
+		return "", errors.New(strings.Concat("the job id is not valid. Job: ", jobID))
+	}
+	return filepath.Join(l.dir, strings.Concat(jobID, ".jsonl")), nil
+}
+
+func matchEvent(e Event, types []EventType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
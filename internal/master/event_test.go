@@ -0,0 +1,89 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"testing"
+
+	"github.com/carisa/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileEventLog_Events(t *testing.T) {
+	l := NewFileEventLog(log.TestLogger(), t.TempDir())
+
+	evs := []Event{
+		{JobID: "job", Type: JobSubmitted},
+		{JobID: "job", Type: SuperstepStarted, Superstep: 1},
+		{JobID: "job", Type: SuperstepCompleted, Superstep: 1, Counts: map[string]int64{"messages": 10}},
+		{JobID: "job", Type: CheckpointTaken, Superstep: 1, Checkpoint: "checkpoints/job/2.json"},
+		{JobID: "other", Type: JobSubmitted},
+	}
+	for _, e := range evs {
+		assert.NoError(t, l.Append(e), "Append")
+	}
+
+	tests := []struct {
+		name  string
+		jobID string
+		types []EventType
+		len   int
+		err   error
+	}{
+		{
+			name:  "All events of the job",
+			jobID: "job",
+			len:   4,
+		},
+		{
+			name:  "Events filtered by type",
+			jobID: "job",
+			types: []EventType{SuperstepStarted, SuperstepCompleted},
+			len:   2,
+		},
+		{
+			name:  "Job without events",
+			jobID: "unknown",
+			err:   ErrJobEventsNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := l.Events(tt.jobID, tt.types...)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "Error")
+				return
+			}
+			if assert.NoError(t, err, "Error") {
+				assert.Len(t, res, tt.len, "Events")
+				for _, e := range res {
+					assert.Equal(t, tt.jobID, e.JobID, "JobID")
+					assert.False(t, e.Time.IsZero(), "Time")
+				}
+			}
+		})
+	}
+}
+
+func TestFileEventLog_Append_Bad_JobID(t *testing.T) {
+	l := NewFileEventLog(log.TestLogger(), t.TempDir())
+	assert.Error(t, l.Append(Event{JobID: "../job"}), "Path job")
+	assert.Error(t, l.Append(Event{JobID: "."}), "Dot job")
+	assert.Error(t, l.Append(Event{}), "Empty job")
+}
@@ -18,7 +18,7 @@
 package master
 
 import (
-	"encoding/json"
+	"path/filepath"
 
 	"github.com/carisa/internal/config"
 	"github.com/carisa/internal/net"
@@ -28,49 +28,185 @@ import (
 )
 
 type Config struct {
+	// DataDir is the directory of the files of the master. The relative directories of the config
+	// and the input and the output of the jobs are resolved under it. Common value: /var/lib/carisa
+	DataDir string `json:"dataDir,omitempty"`
+	// EventDir is the directory where the job event logs are written. Common value: events
+	EventDir string `json:"eventDir,omitempty"`
+	// State defines the store of the job state
+	State State `json:"state,omitempty"`
+	// Checkpoints defines the checkpoints of the jobs
+	Checkpoints Checkpoints `json:"checkpoints,omitempty"`
+	// Partitions is the number of partitions of the jobs that do not set them. Common value: 4
+	Partitions int `json:"partitions,omitempty"`
+	// LeaderKey is the key of the leader election of the masters
+	LeaderKey string `json:"leaderKey,omitempty"`
+	// Admin defines the admin api, so it is not exposed with the job api
+	Admin Admin `json:"admin,omitempty"`
 	config.Common
 }
 
+// Validate checks every field of the config and reports all problems at once
+func (c *Config) Validate() error {
+	var v configp.Validator
+	v.Check(len(c.DataDir) > 0, "data-dir", "the data directory cannot be empty")
+	v.Check(len(c.EventDir) > 0, "event-dir", "the event directory cannot be empty")
+	v.Check(len(c.Checkpoints.Dir) > 0, "checkpoints.dir", "the checkpoint directory cannot be empty")
+	v.Check(c.Checkpoints.Interval >= 0, "checkpoints.interval", "the checkpoint interval cannot be negative")
+	v.Check(c.Partitions > 0, "partitions", "the partitions must be positive")
+	v.Check(len(c.LeaderKey) > 0, "leader-key", "the leader key cannot be empty")
+	v.Check(c.Admin.Port >= 0, "admin.port", "the admin port cannot be negative")
+	v.Check(c.Admin.Port == 0 || len(c.Admin.Address) > 0, "admin.address", "the admin address cannot be empty")
+	switch c.State.Type {
+	case StateFile:
+		v.Check(len(c.State.Dir) > 0, "state.dir", "the state directory cannot be empty")
+	case StateConsul:
+		v.Check(len(c.State.Prefix) > 0, "state.prefix", "the state prefix cannot be empty")
+		v.Check(c.Discovery.Type == config.DiscoveryConsul, "state.type", "the consul state store requires the consul discovery")
+	default:
+		v.Check(false, "state.type", "the type must be file or consul")
+	}
+	c.Common.Validate(&v)
+	return v.Err()
+}
+
+// dir resolves the directory under the data dir when it is relative
+func (c *Config) dir(dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(c.DataDir, dir)
+}
+
+// ToString returns the config in json with the secret fields redacted
 func (c *Config) ToString() string {
-	r, _ := json.Marshal(c)
-	return string(r)
+	return configp.Redact(c)
+}
+
+// Admin defines the admin api of the master: the log levels
+type Admin struct {
+	// Address is the address of the admin api. Common value: localhost
+	Address string `json:",omitempty"`
+	// Port is the port of the admin api. 0 disables it. Common value: 52424
+	Port int `json:",omitempty"`
 }
 
 // Factory is the master controller
 type Factory struct {
 	config    Config
 	discovery net.Discovery
+	election  net.Election
 	health    netp.Health
-	log       *zap.Logger
+	api       netp.API
+	// admin is nil when the admin api is disabled
+	admin   netp.API
+	watcher *configp.Watcher
+	events  EventLog
+	state   StateStore
+	jobs    *runner
+	log     *config.Logger
+	// leader is true when the master is the leader. It is changed by the server loop
+	leader bool
+	// configFile and flags are kept to reload the config at runtime
+	configFile string
+	flags      map[string]string
 }
 
 const MasterPort int = 52422
 
-// Build builds master factory
-func FactoryBuild(configFile string) *Factory {
-	file := false
-	ref := "CARISA_MASTER_CONFIG_JSON"
-
-	if len(configFile) > 0 {
-		file = true
-		ref = configFile
+// LoadConfig resolves the master configuration overriding the defaults
+// with the config file, the environment variables and the flags
+func LoadConfig(configFile string, flags map[string]string) (Config, configp.Sources) {
+	cnf := defaultConfig()
+	sources, err := resolveConfig(&cnf, configFile, flags)
+	if err != nil {
+		panic(err)
 	}
 
-	cnf := Config{
+	return cnf, sources
+}
+
+func defaultConfig() Config {
+	return Config{
+		DataDir:  "/var/lib/carisa",
+		EventDir: "events",
+		State: State{
+			Type:   StateFile,
+			Dir:    "state",
+			Prefix: "carisa/jobs",
+		},
+		Checkpoints: Checkpoints{
+			Dir:      "checkpoints",
+			Interval: 10,
+		},
+		Partitions: 4,
+		LeaderKey:  config.LeaderKey,
+		Admin: Admin{
+			Address: "localhost",
+			Port:    MasterPort + 2,
+		},
 		Common: config.Default(config.Master, MasterPort),
 	}
-	if err := configp.Read(file, ref, &cnf); err != nil {
+}
+
+func resolveConfig(cnf *Config, configFile string, flags map[string]string) (configp.Sources, error) {
+	return configp.Resolve(configp.Layers{
+		File:      configFile,
+		EnvJSON:   "CARISA_MASTER_CONFIG_JSON",
+		EnvPrefix: config.EnvPrefix,
+		Flags:     flags,
+		KV:        net.KVLayer(&cnf.Discovery),
+	}, cnf)
+}
+
+// Build builds master factory
+func FactoryBuild(configFile string, flags map[string]string) *Factory {
+	cnf, _ := LoadConfig(configFile, flags)
+	if err := cnf.Validate(); err != nil {
 		panic(err)
 	}
 
 	log := config.NewLogger(cnf.Common.Zap)
 
-	log.Info("Loading master configuration", zap.String("Source", ref), zap.String("Config", cnf.ToString()))
+	log.Info("Loading master configuration", zap.String("File", configFile), zap.String("Config", cnf.ToString()))
+
+	watcher := configp.NewWatcher(configFile, config.ReloadInterval)
+	if err := net.WatchKV(watcher, cnf.Discovery, &cnf); err != nil {
+		log.Panic("The config key cannot be watched", zap.String("Error", err.Error()))
+	}
+
+	events := NewFileEventLog(log.Logger, cnf.dir(cnf.EventDir))
+	state := NewStateStore(log.Logger, cnf)
+	discovery := net.NewDiscovery(log.Named(config.DiscoveryLogger), cnf.Discovery)
+	jobs := newRunner(log.Logger, cnf, state, events)
+	var admin netp.API
+	if cnf.Admin.Port > 0 {
+		admin = netp.NewHTTPAPI(log.Logger, net.ServerAddress(config.Server{Address: cnf.Admin.Address, Port: cnf.Admin.Port}), newAdminHandler(log))
+	}
 
 	return &Factory{
-		config:    cnf,
-		discovery: net.NewConsulDiscovery(log, cnf.Discovery.Server),
-		health:    netp.NewTCPHealth(log, net.HealthAddress(cnf.Server, cnf.Health)),
-		log:       log,
+		config:     cnf,
+		discovery:  discovery,
+		election:   net.NewElection(log.Named(config.DiscoveryLogger), cnf.Discovery, cnf.LeaderKey, cnf.Server.ID),
+		health:     netp.NewTCPHealth(log.Named(config.HealthLogger), net.HealthAddress(cnf.Server, cnf.Health)),
+		api:        netp.NewHTTPAPI(log.Logger, net.ServerAddress(cnf.Server), newAPIHandler(log, events, state, jobs)),
+		admin:      admin,
+		events:     events,
+		state:      state,
+		jobs:       jobs,
+		watcher:    watcher,
+		log:        log,
+		configFile: configFile,
+		flags:      flags,
 	}
 }
+
+// Submit runs the job when the master is the leader. It is the POST /jobs of the api
+func (f *Factory) Submit(job Job) (Job, error) {
+	return f.jobs.submit(job)
+}
+
+// Job returns the state of the job
+func (f *Factory) Job(id string) (Job, error) {
+	return f.state.Job(id)
+}
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/carisa/internal/config"
+	configp "github.com/carisa/pkg/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,7 +44,18 @@ func TestFactoryBuild(t *testing.T) {
 				}`)
 			},
 			ec: Config{
-				Common: config.Default(config.Master, MasterPort),
+				DataDir:  "/var/lib/carisa",
+				EventDir: "events",
+				State: State{
+					Type:   StateFile,
+					Dir:    "state",
+					Prefix: "carisa/jobs",
+				},
+				Checkpoints: Checkpoints{Dir: "checkpoints", Interval: 10},
+				Partitions:  4,
+				LeaderKey:   "carisa/master/leader",
+				Admin:       Admin{Address: "localhost", Port: MasterPort + 2},
+				Common:      config.Default(config.Master, MasterPort),
 			},
 			panic: false,
 		},
@@ -64,16 +76,78 @@ func TestFactoryBuild(t *testing.T) {
 			t.Parallel()
 			tt.action()
 			if tt.panic {
-				assert.Panics(t, func() { FactoryBuild("") })
+				assert.Panics(t, func() { FactoryBuild("", nil) })
 				return
 			}
-			f := FactoryBuild("")
+			f := FactoryBuild("", nil)
 			tt.ec.Common.ID = f.config.Common.ID
 			assert.Equal(t, tt.ec.Common, f.config.Common, "Common")
 			assert.Equal(t, "id", f.config.Server.ID, "Server ID")
 			assert.NotNil(t, f.discovery, "Discovery")
+			assert.NotNil(t, f.election, "Election")
+			assert.Equal(t, tt.ec.EventDir, f.config.EventDir, "EventDir")
 			assert.NotNil(t, f.health, "Discovery")
+			assert.NotNil(t, f.api, "API")
+			assert.NotNil(t, f.events, "Events")
+			assert.IsType(t, &FileStateStore{}, f.state, "State")
+			assert.Equal(t, tt.ec.Checkpoints, f.config.Checkpoints, "Checkpoints")
+			assert.NotNil(t, f.jobs, "Jobs")
 			assert.NotNil(t, f.log, "Logger")
 		})
 	}
 }
+
+func TestLoadConfig(t *testing.T) {
+	os.Unsetenv("CARISA_MASTER_CONFIG_JSON")
+
+	cnf, sources := LoadConfig("", map[string]string{"server.port": "5000"})
+	assert.Equal(t, 5000, cnf.Server.Port, "Port")
+	assert.Equal(t, configp.Flag, sources["server.port"], "Port source")
+	assert.Equal(t, configp.Default, sources["event-dir"], "EventDir source")
+	assert.Panics(t, func() { LoadConfig("", map[string]string{"server.port": "port"}) }, "Bad flag")
+}
+
+func TestConfig_Dir(t *testing.T) {
+	cnf := Config{DataDir: "/var/lib/carisa"}
+	assert.Equal(t, "/var/lib/carisa/events", cnf.dir("events"), "Relative")
+	assert.Equal(t, "/tmp/events", cnf.dir("/tmp/events"), "Absolute")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cnf := Config{Common: config.Default(config.Master, MasterPort)}
+	cnf.Server.Port = 0
+
+	err := cnf.Validate()
+	if assert.Error(t, err, "Invalid config") {
+		assert.Len(t, err.(*configp.ValidationError).Violations, 7, "Violations")
+	}
+
+	cnf.DataDir = "data"
+	cnf.EventDir = "events"
+	cnf.State = State{Type: StateConsul, Prefix: "carisa/jobs"}
+	cnf.Checkpoints = Checkpoints{Dir: "checkpoints"}
+	cnf.Partitions = 1
+	cnf.LeaderKey = "carisa/master/leader"
+	cnf.Server.Port = MasterPort
+	assert.NoError(t, cnf.Validate(), "Valid config")
+
+	cnf.Checkpoints.Interval = -1
+	err = cnf.Validate()
+	if assert.Error(t, err, "Negative checkpoint interval") {
+		assert.Equal(t, "checkpoints.interval", err.(*configp.ValidationError).Violations[0].Field, "Interval")
+	}
+
+	cnf.Checkpoints.Interval = 0
+	cnf.Admin.Port = 52424
+	err = cnf.Validate()
+	if assert.Error(t, err, "Admin without address") {
+		assert.Equal(t, "admin.address", err.(*configp.ValidationError).Violations[0].Field, "Admin address")
+	}
+
+	cnf.Admin.Port = 0
+	cnf.Discovery.Type = config.DiscoveryEtcd
+	err = cnf.Validate()
+	if assert.Error(t, err, "Consul state without consul discovery") {
+		assert.Equal(t, "state.type", err.(*configp.ValidationError).Violations[0].Field, "State type")
+	}
+}
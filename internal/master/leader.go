@@ -0,0 +1,87 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+	"github.com/carisa/pkg/strings"
+	"go.uber.org/zap"
+)
+
+// register registers the master into discovery. The leader publishes the leader tag,
+// so the workers can find it
+func (f *Factory) register() {
+	disc := f.config.Discovery
+	if f.leader {
+		disc.Tags = append(append([]string{}, disc.Tags...), net.TagLeader)
+	}
+	f.discovery.Register(f.config.Server, disc, string(config.Master))
+}
+
+// lead changes the leadership of the master and publishes it
+func (f *Factory) lead(leader bool) {
+	if f.leader == leader {
+		return
+	}
+	f.leader = leader
+	f.jobs.lead(leader)
+	if leader {
+		f.log.Info("The master is the leader", zap.String("ID", f.config.Server.ID))
+		f.resume()
+	} else {
+		f.log.Warn("The master is a standby", zap.String("ID", f.config.Server.ID))
+	}
+	f.register()
+}
+
+// resume takes over the jobs that have not finished from the state store and runs them again
+func (f *Factory) resume() {
+	if err := f.state.Compact(); err != nil {
+		f.log.Error("The job state cannot be compacted", zap.String("Error", err.Error()))
+	}
+
+	jobs, err := f.state.Jobs()
+	if err != nil {
+		f.log.Error("The job state cannot be loaded", zap.String("Error", err.Error()))
+		return
+	}
+	for _, job := range jobs {
+		if !job.InFlight() {
+			continue
+		}
+		f.log.Info(
+			"Resuming job",
+			zap.String("JobID", job.ID),
+			zap.String("Status", string(job.Status)),
+			zap.Int("Superstep", job.Superstep),
+			zap.String("Checkpoint", job.Checkpoint))
+
+		err := f.events.Append(Event{
+			JobID:      job.ID,
+			Type:       Recovery,
+			Superstep:  job.Superstep,
+			Checkpoint: job.Checkpoint,
+			Message:    strings.Concat("The job is taken over by the master ", f.config.Server.ID),
+		})
+		if err != nil {
+			f.log.Error("The recovery event cannot be appended", zap.String("JobID", job.ID), zap.String("Error", err.Error()))
+		}
+		f.jobs.resume(job)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"testing"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFactory_Lead(t *testing.T) {
+	d := net.NewMemoryDiscovery(log.TestLogger(), net.NewMemoryRegistry())
+	cnf := defaultConfig()
+	cnf.Discovery.Tags = []string{"eu"}
+	state := NewFileStateStore(log.TestLogger(), t.TempDir())
+	_ = state.Save(Job{ID: "running", Status: StatusRunning, Superstep: 3})
+	_ = state.Save(Job{ID: "finished", Status: StatusFinished})
+	events := NewFileEventLog(log.TestLogger(), t.TempDir())
+	f := &Factory{
+		config:    cnf,
+		discovery: d,
+		state:     state,
+		events:    events,
+		jobs:      newRunner(log.TestLogger(), cnf, state, events),
+		log:       config.NewLogger(cnf.Zap),
+	}
+
+	f.register()
+	srvs, _ := d.Services(string(config.Master))
+	_, ok := net.Leader(srvs, "")
+	assert.False(t, ok, "Standby")
+
+	f.lead(true)
+	srvs, _ = d.Services(string(config.Master))
+	leader, ok := net.Leader(srvs, "")
+	if assert.True(t, ok, "Leader") {
+		assert.Equal(t, cnf.Server.ID, leader.ID, "Leader")
+		assert.Equal(t, []string{"eu"}, f.config.Discovery.Tags, "Config tags unchanged")
+	}
+	evs, err := events.Events("running", Recovery)
+	if assert.NoError(t, err, "Recovery events") {
+		assert.Len(t, evs, 1, "Running job resumed")
+		assert.Equal(t, 3, evs[0].Superstep, "Superstep")
+	}
+	job := waitJob(t, f.jobs, "running")
+	assert.Equal(t, StatusFailed, job.Status, "Running job without algorithm")
+	_, err = events.Events("finished")
+	assert.ErrorIs(t, err, ErrJobEventsNotFound, "Finished job not resumed")
+
+	f.lead(false)
+	srvs, _ = d.Services(string(config.Master))
+	_, ok = net.Leader(srvs, "")
+	assert.False(t, ok, "Leadership lost")
+}
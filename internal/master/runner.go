@@ -0,0 +1,510 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	stds "strings"
+	"sync"
+	"time"
+
+	"github.com/carisa/pkg/algorithm"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Submission errors
+var (
+	// ErrJobNotValid is returned when the job definition is not valid
+	ErrJobNotValid = errors.New("the job is not valid")
+	// ErrJobExists is returned when there is a job with the same id
+	ErrJobExists = errors.New("the job already exists")
+	// ErrNotLeader is returned when the master is a standby
+	ErrNotLeader = errors.New("the master is not the leader")
+)
+
+// Checkpoints defines the checkpoints of the jobs
+type Checkpoints struct {
+	// Dir is the directory where the checkpoints are written. Common value: checkpoints
+	Dir string `json:",omitempty"`
+	// Interval takes a checkpoint every the supersteps. 0 takes no checkpoint. Common value: 10
+	Interval int `json:",omitempty"`
+}
+
+// runner runs the jobs of the leader. The partitions of a job run in the engine of the leader
+// and they exchange the messages through the loopback transport. The workers do not compute
+// the partitions: there is no network transport between the nodes yet.
+// The state of the job is saved on every change, so a new leader resumes the jobs in flight
+// from their last checkpoint.
+// Every change of the leadership starts a new epoch. The state, the events and the checkpoints
+// of a run are only written in the epoch that started it, so a stopped run cannot overwrite
+// the state of the run that resumes the job
+type runner struct {
+	log     *zap.Logger
+	config  Config
+	state   StateStore
+	events  EventLog
+	mu      sync.Mutex
+	leading bool
+	// runs are the runs of the jobs by job id until they exit
+	runs map[string]*execution
+	// epoch is changed holding mu and fence, so it can be read holding any of them
+	epoch uint64
+	// fence is held by the writes of the runs, so the epoch does not change in the middle of a write
+	fence sync.RWMutex
+	wg    sync.WaitGroup
+}
+
+// execution is a run of a job
+type execution struct {
+	epoch uint64
+	stop  chan struct{}
+	once  sync.Once
+	// done is closed when the run exits
+	done chan struct{}
+}
+
+func (x *execution) halt() {
+	x.once.Do(func() { close(x.stop) })
+}
+
+func newRunner(log *zap.Logger, cnf Config, state StateStore, events EventLog) *runner {
+	return &runner{
+		log:    log,
+		config: cnf,
+		state:  state,
+		events: events,
+		runs:   make(map[string]*execution),
+	}
+}
+
+// lead changes the leadership and starts a new epoch. The running jobs are stopped when
+// the leadership is lost. They keep the running state, so the next leader resumes them
+func (r *runner) lead(leader bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.leading == leader {
+		return
+	}
+	r.fence.Lock()
+	r.leading = leader
+	r.epoch++
+	r.fence.Unlock()
+	if leader {
+		return
+	}
+	for _, x := range r.runs {
+		x.halt()
+	}
+}
+
+// stop stops the running jobs and waits for them
+func (r *runner) stop() {
+	r.lead(false)
+	r.wg.Wait()
+}
+
+// submit validates the job, saves it as pending and runs it. The id is generated when it is empty
+// and the partitions are the ones of the config when they are not set
+func (r *runner) submit(job Job) (Job, error) {
+	if len(job.ID) == 0 {
+		job.ID = strings.Concat(job.Algorithm, "-", strconv.FormatInt(time.Now().UnixNano(), 36))
+	}
+	if job.Partitions <= 0 {
+		job.Partitions = r.config.Partitions
+	}
+	if err := validJob(r.config, job); err != nil {
+		return Job{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.leading {
+		return Job{}, ErrNotLeader
+	}
+	if _, ok := r.runs[job.ID]; ok {
+		return Job{}, errors.Wrap(ErrJobExists, strings.Concat("Job: ", job.ID))
+	}
+	if _, err := r.state.Job(job.ID); err == nil {
+		return Job{}, errors.Wrap(ErrJobExists, strings.Concat("Job: ", job.ID))
+	} else if !errors.Is(err, ErrJobNotFound) {
+		return Job{}, err
+	}
+
+	job = Job{
+		ID:         job.ID,
+		GraphID:    job.GraphID,
+		Algorithm:  job.Algorithm,
+		Params:     job.Params,
+		Input:      job.Input,
+		Output:     job.Output,
+		Undirected: job.Undirected,
+		Partitions: job.Partitions,
+		Status:     StatusPending,
+		Submitted:  time.Now().UTC(),
+	}
+	if err := r.state.Save(job); err != nil {
+		return Job{}, err
+	}
+	r.event(r.epoch, Event{JobID: job.ID, Type: JobSubmitted, Message: strings.Concat("The job runs the algorithm ", job.Algorithm, " over the graph ", job.GraphID)})
+	r.start(job)
+	return job, nil
+}
+
+// resume runs the job in flight from its last checkpoint or from the beginning when there is no checkpoint.
+// The run of a previous epoch is waited before, so the job never runs twice
+func (r *runner) resume(job Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resumeIn(r.epoch, job)
+}
+
+// resumeIn resumes the job when the epoch is the current one. It must be called with the lock held
+func (r *runner) resumeIn(epoch uint64, job Job) {
+	if !r.leading || r.epoch != epoch {
+		return
+	}
+	x, ok := r.runs[job.ID]
+	switch {
+	case !ok:
+		r.start(job)
+	case x.epoch != epoch:
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			<-x.done
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.resumeIn(epoch, job)
+		}()
+	}
+}
+
+// start runs the job in background in the current epoch. It must be called with the lock held
+func (r *runner) start(job Job) {
+	x := &execution{epoch: r.epoch, stop: make(chan struct{}), done: make(chan struct{})}
+	r.runs[job.ID] = x
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(x.done)
+		r.run(x, job)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.runs[job.ID] == x {
+			delete(r.runs, job.ID)
+		}
+	}()
+}
+
+// run runs the job in the engine from its last checkpoint or from the input
+func (r *runner) run(x *execution, job Job) {
+	alg, err := algorithm.New(job.Algorithm, job.Params)
+	if err != nil {
+		r.fail(x.epoch, job, err)
+		return
+	}
+
+	if job.Partitions <= 0 {
+		job.Partitions = r.config.Partitions
+	}
+	job.Status = StatusRunning
+	job.Message = ""
+	r.save(x.epoch, job)
+	r.log.Info(
+		"Running job",
+		zap.String("JobID", job.ID),
+		zap.String("Algorithm", job.Algorithm),
+		zap.Int("Partitions", job.Partitions),
+		zap.String("Checkpoint", job.Checkpoint))
+
+	e := engine.New(r.log, job.Partitions, engine.NewLoopback())
+	ej := alg.Job()
+	ej.Observer = &progress{r: r, epoch: x.epoch, job: &job, program: ej.Program}
+	ej.CheckpointInterval = r.config.Checkpoints.Interval
+
+	var res engine.Result
+	if len(job.Checkpoint) > 0 {
+		var c engine.Checkpoint
+		if c, err = readCheckpoint(ej.Program, job.Checkpoint); err == nil {
+			res, err = e.Resume(x.stop, ej, c)
+		}
+	} else {
+		var vs []engine.Vertex
+		if vs, err = readVertices(alg, r.config.DataDir, job.Input, job.Undirected); err == nil {
+			res, err = e.Run(x.stop, ej, vs)
+		}
+	}
+
+	switch {
+	case err == nil:
+		r.finish(x.epoch, job, alg, res)
+	case errors.Is(err, engine.ErrStopped), errors.Is(err, ErrNotLeader):
+		r.log.Warn("The job is stopped", zap.String("JobID", job.ID), zap.Int("Superstep", job.Superstep))
+	default:
+		r.fail(x.epoch, job, err)
+	}
+}
+
+// finish writes the output of the job and saves it as finished with the summary of the algorithm
+func (r *runner) finish(epoch uint64, job Job, alg algorithm.Algorithm, res engine.Result) {
+	err := r.fenced(epoch, func() error { return writeOutput(r.config.DataDir, job.Output, alg, res) })
+	switch {
+	case errors.Is(err, ErrNotLeader):
+		r.log.Warn("The job is stopped", zap.String("JobID", job.ID), zap.Int("Superstep", job.Superstep))
+		return
+	case err != nil:
+		r.fail(epoch, job, err)
+		return
+	}
+	if job.Summary, err = alg.Summary(res.Aggregated); err != nil {
+		r.fail(epoch, job, err)
+		return
+	}
+	job.Status = StatusFinished
+	r.save(epoch, job)
+	r.event(epoch, Event{
+		JobID:     job.ID,
+		Type:      JobFinished,
+		Superstep: job.Superstep,
+		Counts:    map[string]int64{"supersteps": int64(res.Supersteps)},
+		Message:   "The job has finished",
+	})
+
+	r.log.Info("Job finished", zap.String("JobID", job.ID), zap.Int("Supersteps", res.Supersteps))
+}
+
+// fail saves the job as failed with the error
+func (r *runner) fail(epoch uint64, job Job, err error) {
+	r.log.Error("The job failed", zap.String("JobID", job.ID), zap.String("Error", err.Error()))
+	job.Status = StatusFailed
+	job.Message = err.Error()
+	r.save(epoch, job)
+	r.event(epoch, Event{JobID: job.ID, Type: JobFinished, Superstep: job.Superstep, Message: job.Message})
+}
+
+// fenced runs the write of a run of the epoch. It returns ErrNotLeader when the epoch has changed
+func (r *runner) fenced(epoch uint64, write func() error) error {
+	r.fence.RLock()
+	defer r.fence.RUnlock()
+
+	if r.epoch != epoch {
+		return ErrNotLeader
+	}
+	return write()
+}
+
+// save saves the job state. The job goes on when the state cannot be saved
+func (r *runner) save(epoch uint64, job Job) {
+	err := r.fenced(epoch, func() error { return r.state.Save(job) })
+	switch {
+	case errors.Is(err, ErrNotLeader):
+		r.log.Warn("The job state of a previous leadership is not saved", zap.String("JobID", job.ID))
+	case err != nil:
+		r.log.Error("The job state cannot be saved", zap.String("JobID", job.ID), zap.String("Error", err.Error()))
+	}
+}
+
+// event appends the job event. The job goes on when the event cannot be appended
+func (r *runner) event(epoch uint64, e Event) {
+	err := r.fenced(epoch, func() error { return r.events.Append(e) })
+	switch {
+	case errors.Is(err, ErrNotLeader):
+		r.log.Warn("The job event of a previous leadership is not appended", zap.String("JobID", e.JobID))
+	case err != nil:
+		r.log.Error("The job event cannot be appended", zap.String("JobID", e.JobID), zap.String("Error", err.Error()))
+	}
+}
+
+// checkpoint writes the checkpoint of the job program and returns its file
+func (r *runner) checkpoint(epoch uint64, jobID string, p compute.RawProgram, c engine.Checkpoint) (string, error) {
+	dir := filepath.Join(r.config.dir(r.config.Checkpoints.Dir), jobID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", errors.Wrap(err, strings.Concat("cannot create the checkpoint directory. Job: ", jobID))
+	}
+	raw := engine.EncodeCheckpoint(p, c)
+
+	// The file is renamed when it is complete, so a checkpoint is never partial
+	name := filepath.Join(dir, strings.Concat(strconv.Itoa(c.Superstep), ".ckp"))
+	tmp := strings.Concat(name, ".tmp")
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return "", errors.Wrap(err, strings.Concat("cannot write the checkpoint. Job: ", jobID))
+	}
+	err := r.fenced(epoch, func() error { return os.Rename(tmp, name) })
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", errors.Wrap(err, strings.Concat("cannot write the checkpoint. Job: ", jobID))
+	}
+	return name, nil
+}
+
+// progress saves the progress of a job notified by the engine and appends its events
+type progress struct {
+	r       *runner
+	epoch   uint64
+	job     *Job
+	program compute.RawProgram
+}
+
+func (p *progress) Started(superstep int) {
+	p.job.Superstep = superstep
+	p.r.save(p.epoch, *p.job)
+	p.r.event(p.epoch, Event{JobID: p.job.ID, Type: SuperstepStarted, Superstep: superstep})
+}
+
+func (p *progress) Completed(s engine.Stats) {
+	p.r.event(p.epoch, Event{
+		JobID:     p.job.ID,
+		Type:      SuperstepCompleted,
+		Superstep: s.Superstep,
+		Counts: map[string]int64{
+			"computed":  s.Computed,
+			"active":    s.Active,
+			"messages":  s.Messages,
+			"dropped":   s.Dropped,
+			"mutations": s.Mutations,
+		},
+	})
+}
+
+func (p *progress) Checkpoint(c engine.Checkpoint) error {
+	name, err := p.r.checkpoint(p.epoch, p.job.ID, p.program, c)
+	if err != nil {
+		return err
+	}
+	p.job.Checkpoint = name
+	p.r.save(p.epoch, *p.job)
+	p.r.event(p.epoch, Event{JobID: p.job.ID, Type: CheckpointTaken, Superstep: c.Superstep, Checkpoint: name})
+	return nil
+}
+
+// validJob checks the definition of a submitted job
+func validJob(cnf Config, job Job) error {
+	if !validID(job.ID) {
+		return errors.Wrap(ErrJobNotValid, strings.Concat("the id is not valid. Job: ", job.ID))
+	}
+	if job.Partitions <= 0 {
+		return errors.Wrap(ErrJobNotValid, "the partitions must be positive")
+	}
+	if len(job.GraphID) == 0 {
+		return errors.Wrap(ErrJobNotValid, "the graph id cannot be empty")
+	}
+	if len(job.Input) == 0 {
+		return errors.Wrap(ErrJobNotValid, "the input cannot be empty")
+	}
+	if err := jobFile(cnf, job.Input); err != nil {
+		return errors.Wrap(ErrJobNotValid, err.Error())
+	}
+	if err := jobFile(cnf, job.Output); len(job.Output) > 0 && err != nil {
+		return errors.Wrap(ErrJobNotValid, err.Error())
+	}
+	if _, err := algorithm.New(job.Algorithm, job.Params); err != nil {
+		return errors.Wrap(ErrJobNotValid, err.Error())
+	}
+	return nil
+}
+
+// jobFile checks that the file of a job is under the data dir and out of the directories of the master
+func jobFile(cnf Config, name string) error {
+	file, err := dataFile(cnf.DataDir, name)
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{cnf.EventDir, cnf.State.Dir, cnf.Checkpoints.Dir} {
+		if rel, err := filepath.Rel(cnf.dir(dir), file); err == nil && local(rel) {
+			return errors.New(strings.Concat("the file cannot be in a directory of the master. File: ", name))
+		}
+	}
+	return nil
+}
+
+// dataFile resolves the file of a job under the data dir. It fails when the path is absolute or it leaves the data dir
+func dataFile(dir, name string) (string, error) {
+	if !local(name) {
+		return "", errors.New(strings.Concat("the file must be a relative path under the data directory. File: ", name))
+	}
+	return filepath.Join(dir, filepath.Clean(name)), nil
+}
+
+// local returns true when the path is relative and it does not leave its directory
+func local(name string) bool {
+	name = filepath.Clean(name)
+	return !filepath.IsAbs(name) && name != ".." && !stds.HasPrefix(name, strings.Concat("..", string(filepath.Separator)))
+}
+
+// readVertices reads the edge list of the input under the data dir and builds the vertices of the algorithm
+func readVertices(alg algorithm.Algorithm, dir, input string, undirected bool) ([]engine.Vertex, error) {
+	name, err := dataFile(dir, input)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("cannot open the input. Input: ", input))
+	}
+	defer f.Close()
+
+	edges, err := algorithm.ReadEdges(f)
+	if err != nil {
+		return nil, err
+	}
+	return alg.Vertices(edges, undirected)
+}
+
+// readCheckpoint reads the checkpoint of the program. It fails when it was taken by another program
+func readCheckpoint(p compute.RawProgram, name string) (engine.Checkpoint, error) {
+	r, err := os.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return engine.Checkpoint{}, errors.Wrap(err, strings.Concat("cannot read the checkpoint. Checkpoint: ", name))
+	}
+	c, err := engine.DecodeCheckpoint(p, r)
+	if err != nil {
+		return engine.Checkpoint{}, errors.Wrap(err, strings.Concat("cannot decode the checkpoint. Checkpoint: ", name))
+	}
+	return c, nil
+}
+
+// writeOutput writes the vertex values into the output under the data dir
+func writeOutput(dir, output string, alg algorithm.Algorithm, res engine.Result) error {
+	if len(output) == 0 {
+		return nil
+	}
+	name, err := dataFile(dir, output)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot create the output. Output: ", output))
+	}
+	if err := algorithm.Write(f, alg, res); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, strings.Concat("cannot write the output. Output: ", output))
+	}
+	return f.Close()
+}
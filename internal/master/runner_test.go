@@ -0,0 +1,221 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/carisa/pkg/algorithm"
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const components = "a\ta\nb\ta\nc\ta\nd\td\ne\td\n"
+
+// The vertex a of the gated algorithm counts its computes and waits for the gate
+var (
+	gate    chan struct{}
+	entered int32
+)
+
+func init() {
+	algorithm.Register("test-gated", gated)
+}
+
+func gated(algorithm.Params) (algorithm.Algorithm, error) {
+	return &algorithm.Definition[int64, float64, int64]{
+		Name: "test-gated",
+		Program: compute.Compute[int64, float64, int64](func(ctx compute.Context[int64, float64, int64], _ []int64) error {
+			if ctx.ID() == "a" {
+				atomic.AddInt32(&entered, 1)
+				<-gate
+			}
+			ctx.VoteToHalt()
+			return nil
+		}),
+		Codecs: compute.Codecs[int64, float64, int64]{Vertex: codec.Int64{}, Edge: codec.Float64{}, Message: codec.Int64{}},
+		Init:   func(string) int64 { return 0 },
+		Edge:   func(w float64) float64 { return w },
+		Output: func(v int64) string { return strconv.FormatInt(v, 10) },
+	}, nil
+}
+
+// testRunner creates a leading runner of jobs of two partitions
+func testRunner(t *testing.T) (*runner, string) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "edges.txt")
+	require.NoError(t, os.WriteFile(input, []byte("a b\nb c\nd e\n"), 0600), "Input")
+
+	cnf := defaultConfig()
+	cnf.DataDir = dir
+	cnf.Partitions = 2
+	cnf.Checkpoints = Checkpoints{Dir: filepath.Join(dir, "checkpoints"), Interval: 1}
+	r := newRunner(log.TestLogger(), cnf, NewFileStateStore(log.TestLogger(), dir), NewFileEventLog(log.TestLogger(), dir))
+	r.lead(true)
+	t.Cleanup(r.stop)
+	return r, dir
+}
+
+// waitJob waits until the job is not in flight
+func waitJob(t *testing.T, r *runner, id string) Job {
+	var job Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = r.state.Job(id)
+		return err == nil && !job.InFlight()
+	}, 5*time.Second, 10*time.Millisecond, "Job not finished")
+	return job
+}
+
+func TestRunner_Submit(t *testing.T) {
+	r, dir := testRunner(t)
+	job, err := r.submit(Job{ID: "wcc", GraphID: "graph", Algorithm: "wcc", Input: "edges.txt", Output: "wcc.txt", Undirected: true})
+	if assert.NoError(t, err, "Submit") {
+		assert.Equal(t, StatusPending, job.Status, "Pending")
+	}
+	job = waitJob(t, r, "wcc")
+	assert.Equal(t, StatusFinished, job.Status, job.Message)
+	assert.Equal(t, 2, job.Partitions, "Partitions of the config")
+	assert.FileExists(t, job.Checkpoint, "Checkpoint")
+	out, err := os.ReadFile(filepath.Join(dir, "wcc.txt"))
+	if assert.NoError(t, err, "Output") {
+		assert.Equal(t, components, string(out), "Components")
+	}
+
+	_, err = r.submit(Job{ID: "wcc", GraphID: "graph", Algorithm: "wcc", Input: "edges.txt"})
+	assert.ErrorIs(t, err, ErrJobExists, "Duplicated")
+	for _, id := range []string{".", "..", "a/b", "a b", "a\\b"} {
+		_, err = r.submit(Job{ID: id, GraphID: "graph", Algorithm: "wcc", Input: "edges.txt"})
+		assert.ErrorIs(t, err, ErrJobNotValid, id)
+	}
+	_, err = r.submit(Job{GraphID: "graph", Algorithm: "unknown", Input: "edges.txt"})
+	assert.ErrorIs(t, err, ErrJobNotValid, "Unknown algorithm")
+	_, err = r.submit(Job{Algorithm: "wcc", Input: "edges.txt"})
+	assert.ErrorIs(t, err, ErrJobNotValid, "Without graph")
+	_, err = r.submit(Job{GraphID: "graph", Algorithm: "wcc", Input: filepath.Join(dir, "edges.txt")})
+	assert.ErrorIs(t, err, ErrJobNotValid, "Absolute input")
+	_, err = r.submit(Job{GraphID: "graph", Algorithm: "wcc", Input: "edges.txt", Output: "../wcc.txt"})
+	assert.ErrorIs(t, err, ErrJobNotValid, "Output out of the data dir")
+	_, err = r.submit(Job{GraphID: "graph", Algorithm: "wcc", Input: "edges.txt", Output: "state/jobs.jsonl"})
+	assert.ErrorIs(t, err, ErrJobNotValid, "Output in the state dir")
+	_, err = r.submit(Job{GraphID: "graph", Algorithm: "wcc", Input: "checkpoints/wcc/1.ckp"})
+	assert.ErrorIs(t, err, ErrJobNotValid, "Input in the checkpoint dir")
+
+	job, err = r.submit(Job{GraphID: "graph", Algorithm: "wcc", Input: "missing.txt", Partitions: 3})
+	if assert.NoError(t, err, "Submit without input file") {
+		assert.Equal(t, 3, job.Partitions, "Partitions of the job")
+		job = waitJob(t, r, job.ID)
+		assert.Equal(t, StatusFailed, job.Status, "Without input file")
+		assert.NotEmpty(t, job.Message, "Failure message")
+	}
+
+	r.lead(false)
+	_, err = r.submit(Job{GraphID: "graph", Algorithm: "wcc", Input: "edges.txt"})
+	assert.ErrorIs(t, err, ErrNotLeader, "Standby")
+}
+
+func TestRunner_Events(t *testing.T) {
+	r, _ := testRunner(t)
+	_, err := r.submit(Job{ID: "wcc", GraphID: "graph", Algorithm: "wcc", Input: "edges.txt", Undirected: true})
+	require.NoError(t, err, "Submit")
+	waitJob(t, r, "wcc")
+
+	evs, err := r.events.Events("wcc")
+	require.NoError(t, err, "Events")
+	types := make([]EventType, len(evs))
+	for i, e := range evs {
+		types[i] = e.Type
+	}
+	assert.Equal(t, []EventType{
+		JobSubmitted,
+		SuperstepStarted, SuperstepCompleted, CheckpointTaken,
+		SuperstepStarted, SuperstepCompleted, CheckpointTaken,
+		SuperstepStarted, SuperstepCompleted, CheckpointTaken,
+		SuperstepStarted, SuperstepCompleted,
+		JobFinished,
+	}, types, "Event types")
+	assert.Equal(t, int64(5), evs[2].Counts["computed"], "Computed vertices")
+	assert.Equal(t, int64(6), evs[2].Counts["messages"], "Messages sent")
+	assert.NotEmpty(t, evs[3].Checkpoint, "Checkpoint reference")
+	assert.Equal(t, int64(4), evs[12].Counts["supersteps"], "Supersteps")
+}
+
+func TestRunner_Resume(t *testing.T) {
+	r, dir := testRunner(t)
+	_, err := r.submit(Job{ID: "wcc", GraphID: "graph", Algorithm: "wcc", Input: "edges.txt", Undirected: true})
+	require.NoError(t, err, "Submit")
+	done := waitJob(t, r, "wcc")
+
+	// The job is resumed from its first checkpoint without the input and with other partitions
+	first := filepath.Join(filepath.Dir(done.Checkpoint), "1.ckp")
+	r.resume(Job{ID: "resumed", GraphID: "graph", Algorithm: "wcc", Output: "resumed.txt", Partitions: 3, Status: StatusRunning, Superstep: 1, Checkpoint: first})
+	job := waitJob(t, r, "resumed")
+	assert.Equal(t, StatusFinished, job.Status, job.Message)
+	assert.Equal(t, done.Superstep, job.Superstep, "Supersteps")
+	out, err := os.ReadFile(filepath.Join(dir, "resumed.txt"))
+	if assert.NoError(t, err, "Output") {
+		assert.Equal(t, components, string(out), "Components")
+	}
+
+	// The checkpoint of another algorithm is not resumed
+	r.resume(Job{ID: "other", GraphID: "graph", Algorithm: "lpa", Partitions: 3, Status: StatusRunning, Superstep: 1, Checkpoint: first})
+	job = waitJob(t, r, "other")
+	assert.Equal(t, StatusFailed, job.Status, "Other algorithm")
+	assert.Contains(t, job.Message, "does not match", "Other algorithm")
+}
+
+func TestRunner_Lead(t *testing.T) {
+	r, _ := testRunner(t)
+	gate = make(chan struct{})
+	atomic.StoreInt32(&entered, 0)
+	var once sync.Once
+	open := func() { once.Do(func() { close(gate) }) }
+	t.Cleanup(open)
+
+	_, err := r.submit(Job{ID: "gated", GraphID: "graph", Algorithm: "test-gated", Input: "edges.txt"})
+	require.NoError(t, err, "Submit")
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&entered) == 1 }, 5*time.Second, 10*time.Millisecond, "Running")
+
+	// The leadership is lost and taken again while the first run is computing
+	r.lead(false)
+	r.lead(true)
+	job, err := r.state.Job("gated")
+	require.NoError(t, err, "State")
+	r.resume(job)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&entered), "The first run is waited")
+
+	open()
+	job = waitJob(t, r, "gated")
+	assert.Equal(t, StatusFinished, job.Status, job.Message)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&entered), "Resumed")
+
+	completed, err := r.events.Events("gated", SuperstepCompleted, JobFinished)
+	if assert.NoError(t, err, "Events") {
+		assert.Len(t, completed, 2, "The writes of the first run are fenced")
+	}
+}
@@ -21,14 +21,28 @@ import (
 	"os"
 	"os/signal"
 
-	"github.com/carisa/internal/config"
 	"go.uber.org/zap"
 )
 
-// Start starts the master server
+// Start starts the master server and waits for interrupt signal to gracefully shutdown the server
 func Start(factory *Factory) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt)
+	stop := make(chan struct{})
+	go func() {
+		<-quit
+		close(stop)
+	}()
+
+	Run(factory, stop)
+}
+
+// Run runs the master server until stop is closed
+func Run(factory *Factory, stop <-chan struct{}) {
 	// Start server
+	started := make(chan struct{})
 	go func() {
+		defer close(started)
 		factory.log.Info(
 			"Starting master server ...",
 			zap.String("ID", factory.config.Server.ID),
@@ -36,15 +50,42 @@ func Start(factory *Factory) {
 			zap.Int("Port", factory.config.Server.Port))
 
 		factory.health.Run()
-		factory.discovery.Register(factory.config.Server, factory.config.Health, string(config.Master))
+		factory.api.Run()
+		if factory.admin != nil {
+			factory.admin.Run()
+		}
+		factory.register()
 
 		factory.log.Info("Master server started")
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	// Reload the config when it changes and campaign for the leadership until the server is stopped.
+	// The election starts when the server is registered
+	factory.watcher.Run()
+	registered := started
+	var leading <-chan bool
+wait:
+	for {
+		select {
+		case <-registered:
+			registered = nil
+			leading = factory.election.Run(stop)
+		case leader, ok := <-leading:
+			if !ok {
+				leading = nil
+				continue
+			}
+			factory.lead(leader)
+		case <-factory.watcher.Changes():
+			factory.reload()
+		case <-stop:
+			break wait
+		}
+	}
+	factory.watcher.Stop()
+	factory.jobs.stop()
+	// The server is registered before it is deregistered
+	<-started
 
 	factory.log.Info(
 		"Stopping master server ...",
@@ -52,6 +93,10 @@ func Start(factory *Factory) {
 		zap.String("Address", factory.config.Server.Address))
 
 	factory.discovery.Deregister(factory.config.Server.ID)
+	factory.api.Stop()
+	if factory.admin != nil {
+		factory.admin.Stop()
+	}
 	factory.health.Stop()
 
 	factory.log.Info("Master server stopped")
@@ -0,0 +1,482 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/carisa/internal/net"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// JobStatus is the status of a job
+type JobStatus string
+
+const (
+	StatusPending  JobStatus = "pending"
+	StatusRunning  JobStatus = "running"
+	StatusFinished JobStatus = "finished"
+	StatusFailed   JobStatus = "failed"
+)
+
+// State store types
+const (
+	StateFile   = "file"
+	StateConsul = "consul"
+)
+
+// ErrJobNotFound is returned when the job is not in the state store
+var ErrJobNotFound = errors.New("the job does not exist")
+
+// Job is the state of a job kept by the master
+type Job struct {
+	// ID identifies the job
+	ID string `json:"id"`
+	// GraphID identifies the graph of the job
+	GraphID string `json:"graphID,omitempty"`
+	// Algorithm is the vertex program of the job
+	Algorithm string `json:"algorithm,omitempty"`
+	// Params are the parameters of the algorithm
+	Params map[string]string `json:"params,omitempty"`
+	// Input is the edge list file of the graph
+	Input string `json:"input,omitempty"`
+	// Output is the file where the vertex values are written. Nothing is written when it is empty
+	Output string `json:"output,omitempty"`
+	// Undirected adds the reverse of every input edge
+	Undirected bool `json:"undirected,omitempty"`
+	// Status is the status of the job
+	Status JobStatus `json:"status"`
+	// Partitions is the number of partitions of the graph. The one of the master config is used when it is not set
+	Partitions int `json:"partitions,omitempty"`
+	// Superstep is the last superstep started
+	Superstep int `json:"superstep"`
+	// Checkpoint is the reference of the last checkpoint taken
+	Checkpoint string `json:"checkpoint,omitempty"`
+	// Submitted is when the job was submitted
+	Submitted time.Time `json:"submitted"`
+	// Updated is when the state was saved. It is set on save
+	Updated time.Time `json:"updated"`
+	// Message describes the status. i.e: the error of a failed job
+	Message string `json:"message,omitempty"`
+	// Summary are the aggregated values reported by the algorithm when the job finishes
+	Summary map[string]string `json:"summary,omitempty"`
+}
+
+// maxIDLen is the max length of a job id
+const maxIDLen = 128
+
+// validID returns true when the job id is a safe file name and consul key: letters, digits,
+// '.', '-' and '_'. The ids "." and ".." are not valid
+func validID(id string) bool {
+	if len(id) == 0 || len(id) > maxIDLen || id == "." || id == ".." {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// InFlight returns true when the job has not finished
+func (j Job) InFlight() bool {
+	return j.Status == StatusPending || j.Status == StatusRunning
+}
+
+// StateStore defines the persistent state of the jobs, so a restarted master
+// or a new leader can resume or report on the jobs
+type StateStore interface {
+	// Save writes the job state replacing the previous one
+	Save(job Job) error
+	// Job returns the job state
+	Job(id string) (Job, error)
+	// Jobs returns the state of every job sorted by submission time
+	Jobs() ([]Job, error)
+	// Delete removes the job state
+	Delete(id string) error
+	// Compact reduces the storage of the state keeping the last state of every job.
+	// It is called when the master takes the leadership
+	Compact() error
+}
+
+// State defines the job state store
+type State struct {
+	// Type is the state store: file or consul. Common value: file
+	Type string `json:",omitempty"`
+	// Dir is the directory of the file state store. Common value: state
+	Dir string `json:",omitempty"`
+	// Prefix is the consul kv prefix of the jobs
+	Prefix string `json:",omitempty"`
+}
+
+// NewStateStore creates the state store defined by the config type
+func NewStateStore(log *zap.Logger, cnf Config) StateStore {
+	if cnf.State.Type == StateConsul {
+		kv, err := net.NewConsulKV(cnf.Discovery)
+		if err != nil {
+			log.Panic("The consul state store cannot be created", zap.String("Error", err.Error()))
+		}
+		return NewConsulStateStore(kv, cnf.State.Prefix)
+	}
+	return NewFileStateStore(log, cnf.dir(cnf.State.Dir))
+}
+
+// stateOp is a record of the file state store
+type stateOp struct {
+	Delete bool `json:"delete,omitempty"`
+	Job    Job  `json:"job"`
+}
+
+// The file state store is compacted when it has compactRatio records by job
+// and compactMin records at least
+const (
+	compactRatio = 4
+	compactMin   = 1024
+)
+
+// FileStateStore keeps the state of the jobs in an append-only json lines file.
+// The last state of every job is indexed in memory, so the file is only replayed on the
+// first use, and the file is compacted when it has several records by job. The partial
+// record of a crash is removed on the first use. It is only guarded in process, so it
+// supports a single master. Use the consul store when the masters are replicated
+type FileStateStore struct {
+	log  *zap.Logger
+	file string
+	mu   sync.Mutex
+	// jobs is the last state of every job. It is nil until the file is replayed
+	jobs map[string]Job
+	// records is the number of records of the file
+	records int
+	// compactMin is the min number of records of a compaction
+	compactMin int
+}
+
+// NewFileStateStore creates a state store into the dir directory
+func NewFileStateStore(log *zap.Logger, dir string) *FileStateStore {
+	return &FileStateStore{
+		log:        log,
+		file:       filepath.Join(dir, "jobs.jsonl"),
+		compactMin: compactMin,
+	}
+}
+
+// Save appends the job state to the file
+func (s *FileStateStore) Save(job Job) error {
+	if len(job.ID) == 0 {
+		return errors.New("the job id cannot be empty")
+	}
+	job.Updated = time.Now().UTC()
+	return s.append(stateOp{Job: job})
+}
+
+// Delete appends the removal of the job to the file
+func (s *FileStateStore) Delete(id string) error {
+	return s.append(stateOp{Delete: true, Job: Job{ID: id}})
+}
+
+// Job returns the last state of the job
+func (s *FileStateStore) Job(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return Job{}, err
+	}
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, errors.Wrap(ErrJobNotFound, strings.Concat("Job: ", id))
+	}
+	return job, nil
+}
+
+// Jobs returns the last state of every job
+func (s *FileStateStore) Jobs() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return sortJobs(s.jobs), nil
+}
+
+// Compact rewrites the file with the last state of every job
+func (s *FileStateStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	return s.compact()
+}
+
+// compact rewrites the file with the jobs of the index. The store must be locked
+func (s *FileStateStore) compact() error {
+	if s.records == len(s.jobs) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0750); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot create the state directory. File: ", s.file))
+	}
+
+	tmp := s.file + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot create the state file. File: ", tmp))
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, job := range sortJobs(s.jobs) {
+		if err = enc.Encode(stateOp{Job: job}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, strings.Concat("cannot write the state file. File: ", tmp))
+	}
+	if err := os.Rename(tmp, s.file); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot replace the state file. File: ", s.file))
+	}
+
+	s.log.Debug("Job state compacted", zap.String("File", s.file), zap.Int("Records", s.records), zap.Int("Jobs", len(s.jobs)))
+	s.records = len(s.jobs)
+	return nil
+}
+
+func (s *FileStateStore) append(op stateOp) error {
+	r, err := json.Marshal(op)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot marshal the job state. Job: ", op.Job.ID))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0750); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot create the state directory. File: ", s.file))
+	}
+	f, err := os.OpenFile(s.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot open the state file. File: ", s.file))
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(r, '\n')); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot write the job state. File: ", s.file))
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot sync the state file. File: ", s.file))
+	}
+
+	s.records++
+	if op.Delete {
+		delete(s.jobs, op.Job.ID)
+	} else {
+		s.jobs[op.Job.ID] = op.Job
+	}
+	s.log.Debug(
+		"Job state saved",
+		zap.String("JobID", op.Job.ID),
+		zap.String("Status", string(op.Job.Status)),
+		zap.Bool("Delete", op.Delete))
+
+	// The state is saved even if the file cannot be compacted. It is compacted on the next save
+	if s.records >= s.compactMin && s.records >= compactRatio*len(s.jobs) {
+		if err := s.compact(); err != nil {
+			s.log.Error("The job state cannot be compacted", zap.String("File", s.file), zap.String("Error", err.Error()))
+		}
+	}
+	return nil
+}
+
+// load replays the file into the index on the first use. The file is compacted when it
+// has a partial record, so the next record is not appended to it. The store must be locked
+func (s *FileStateStore) load() error {
+	if s.jobs != nil {
+		return nil
+	}
+	jobs, records, partial, err := s.replay()
+	if err != nil {
+		return err
+	}
+	s.jobs, s.records = jobs, records
+	if partial {
+		// The partial record is counted, so the file is rewritten
+		s.records++
+		return s.compact()
+	}
+	return nil
+}
+
+// replay reads the file applying every record. It returns the number of valid records
+// and if there are partial records. The store must be locked
+func (s *FileStateStore) replay() (map[string]Job, int, bool, error) {
+	jobs := make(map[string]Job)
+	f, err := os.Open(filepath.Clean(s.file))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return jobs, 0, false, nil
+		}
+		return nil, 0, false, errors.Wrap(err, strings.Concat("cannot open the state file. File: ", s.file))
+	}
+	defer f.Close()
+
+	records := 0
+	partial := false
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var op stateOp
+		if err := json.Unmarshal(sc.Bytes(), &op); err != nil {
+			// The last record is partial when the master stops while writing it
+			s.log.Warn("The job state record is not valid and it is skipped",
+				zap.String("File", s.file), zap.String("Error", err.Error()))
+			partial = true
+			continue
+		}
+		records++
+		if op.Delete {
+			delete(jobs, op.Job.ID)
+		} else {
+			jobs[op.Job.ID] = op.Job
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, 0, false, errors.Wrap(err, strings.Concat("cannot read the state file. File: ", s.file))
+	}
+	return jobs, records, partial, nil
+}
+
+// ConsulStateStore keeps the state of every job in a consul kv key: <prefix>/<jobID>
+type ConsulStateStore struct {
+	kv     *net.ConsulKV
+	prefix string
+}
+
+// NewConsulStateStore creates a state store into the consul kv prefix
+func NewConsulStateStore(kv *net.ConsulKV, prefix string) *ConsulStateStore {
+	return &ConsulStateStore{
+		kv:     kv,
+		prefix: prefix,
+	}
+}
+
+// Save writes the job state into its key
+func (s *ConsulStateStore) Save(job Job) error {
+	if len(job.ID) == 0 {
+		return errors.New("the job id cannot be empty")
+	}
+	job.Updated = time.Now().UTC()
+	r, err := json.Marshal(job)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot marshal the job state. Job: ", job.ID))
+	}
+	if err := s.kv.Put(s.key(job.ID), r); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot write the job state. Job: ", job.ID))
+	}
+	return nil
+}
+
+// Job reads the job state from its key
+func (s *ConsulStateStore) Job(id string) (Job, error) {
+	r, err := s.kv.Get(s.key(id))
+	if err != nil {
+		return Job{}, errors.Wrap(err, strings.Concat("cannot read the job state. Job: ", id))
+	}
+	if r == nil {
+		return Job{}, errors.Wrap(ErrJobNotFound, strings.Concat("Job: ", id))
+	}
+	var job Job
+	if err := json.Unmarshal(r, &job); err != nil {
+		return Job{}, errors.Wrap(err, strings.Concat("cannot unmarshal the job state. Job: ", id))
+	}
+	return job, nil
+}
+
+// Jobs reads the state of every job under the prefix
+func (s *ConsulStateStore) Jobs() ([]Job, error) {
+	values, err := s.kv.List(s.key(""))
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("cannot read the jobs state. Prefix: ", s.prefix))
+	}
+	jobs := make(map[string]Job, len(values))
+	for key, r := range values {
+		var job Job
+		if err := json.Unmarshal(r, &job); err != nil {
+			return nil, errors.Wrap(err, strings.Concat("cannot unmarshal the job state. Key: ", key))
+		}
+		jobs[job.ID] = job
+	}
+	return sortJobs(jobs), nil
+}
+
+// Delete removes the key of the job
+func (s *ConsulStateStore) Delete(id string) error {
+	if err := s.kv.Delete(s.key(id)); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot delete the job state. Job: ", id))
+	}
+	return nil
+}
+
+// Compact does nothing because every job is a single key
+func (s *ConsulStateStore) Compact() error {
+	return nil
+}
+
+func (s *ConsulStateStore) key(id string) string {
+	return strings.Concat(s.prefix, "/", id)
+}
+
+func sortJobs(jobs map[string]Job) []Job {
+	res := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		res = append(res, job)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Submitted.Equal(res[j].Submitted) {
+			return res[i].ID < res[j].ID
+		}
+		return res[i].Submitted.Before(res[j].Submitted)
+	})
+	return res
+}
@@ -0,0 +1,129 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package master
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStateStore(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStateStore(log.TestLogger(), dir)
+
+	jobs, err := s.Jobs()
+	if assert.NoError(t, err, "Empty store") {
+		assert.Empty(t, jobs, "Empty store")
+	}
+	assert.Error(t, s.Save(Job{}), "Empty id")
+
+	t0 := time.Now().UTC()
+	assert.NoError(t, s.Save(Job{ID: "b", Status: StatusPending, Submitted: t0.Add(time.Second)}))
+	assert.NoError(t, s.Save(Job{ID: "a", Status: StatusPending, Submitted: t0}))
+	assert.NoError(t, s.Save(Job{ID: "a", Status: StatusRunning, Submitted: t0, Superstep: 2, Partitions: 2}))
+	assert.NoError(t, s.Save(Job{ID: "c", Status: StatusFailed, Submitted: t0}))
+	assert.NoError(t, s.Delete("c"))
+
+	job, err := s.Job("a")
+	if assert.NoError(t, err, "Job") {
+		assert.Equal(t, StatusRunning, job.Status, "Status")
+		assert.Equal(t, 2, job.Superstep, "Superstep")
+		assert.Equal(t, 2, job.Partitions, "Partitions")
+		assert.False(t, job.Updated.IsZero(), "Updated")
+	}
+	_, err = s.Job("c")
+	assert.ErrorIs(t, err, ErrJobNotFound, "Deleted")
+
+	// A restarted master reads the same state
+	s = NewFileStateStore(log.TestLogger(), dir)
+	jobs, err = s.Jobs()
+	if assert.NoError(t, err, "Jobs") {
+		assert.Len(t, jobs, 2, "Jobs")
+		assert.Equal(t, "a", jobs[0].ID, "Sorted by submission")
+	}
+}
+
+func TestFileStateStore_Compact(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStateStore(log.TestLogger(), dir)
+	assert.NoError(t, s.Compact(), "Empty store")
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Save(Job{ID: "a", Superstep: i}))
+	}
+	assert.NoError(t, s.Save(Job{ID: "b"}))
+	assert.NoError(t, s.Delete("b"))
+
+	assert.NoError(t, s.Compact(), "Compact")
+	file := filepath.Join(dir, "jobs.jsonl")
+	r, _ := ioutil.ReadFile(file)
+	assert.Equal(t, 1, len(splitLines(r)), "Records")
+
+	// The partial record of a crash is removed when the store is restarted
+	assert.NoError(t, ioutil.WriteFile(file, append(r, []byte(`{"job": {"id"`)...), 0600))
+	s = NewFileStateStore(log.TestLogger(), dir)
+	assert.NoError(t, s.Save(Job{ID: "b"}))
+	r, _ = ioutil.ReadFile(file)
+	assert.Equal(t, 2, len(splitLines(r)), "Records after the crash")
+	job, err := s.Job("a")
+	if assert.NoError(t, err, "Job") {
+		assert.Equal(t, 2, job.Superstep, "Last state")
+	}
+}
+
+func TestFileStateStore_Compact_Save(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStateStore(log.TestLogger(), dir)
+	s.compactMin = 8
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, s.Save(Job{ID: "a", Superstep: i}))
+	}
+	r, _ := ioutil.ReadFile(filepath.Join(dir, "jobs.jsonl"))
+	assert.Less(t, len(splitLines(r)), 8, "Compacted on save")
+
+	s = NewFileStateStore(log.TestLogger(), dir)
+	job, err := s.Job("a")
+	if assert.NoError(t, err, "Job") {
+		assert.Equal(t, 99, job.Superstep, "Last state")
+	}
+}
+
+func TestJob_InFlight(t *testing.T) {
+	assert.True(t, Job{Status: StatusPending}.InFlight())
+	assert.True(t, Job{Status: StatusRunning}.InFlight())
+	assert.False(t, Job{Status: StatusFinished}.InFlight())
+	assert.False(t, Job{Status: StatusFailed}.InFlight())
+}
+
+func splitLines(r []byte) []string {
+	var lines []string
+	start := 0
+	for i, b := range r {
+		if b == '\n' {
+			lines = append(lines, string(r[start:i]))
+			start = i + 1
+		}
+	}
+	return lines
+}
@@ -0,0 +1,92 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/carisa/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// LogLevelPath is the admin path to get or change a logger level.
+	// The root logger is /admin/log/level and a subsystem logger is /admin/log/level/{name}
+	LogLevelPath = "/admin/log/level"
+	// LogLevelsPath is the admin path to get the levels of every logger
+	LogLevelsPath = "/admin/log/levels"
+)
+
+// LogLevels are the levels of the root and subsystem loggers
+type LogLevels struct {
+	Level   zapcore.Level            `json:"level"`
+	Loggers map[string]zapcore.Level `json:"loggers"`
+}
+
+// AdminHandler registers the admin routes of a node into mux
+func AdminHandler(mux *http.ServeMux, log *config.Logger) {
+	mux.HandleFunc(LogLevelsPath, logLevelsHandler(log))
+	mux.HandleFunc(LogLevelPath, logLevelHandler(log))
+	mux.HandleFunc(LogLevelPath+"/", logLevelHandler(log))
+}
+
+// logLevelsHandler returns the levels of every logger: GET /admin/log/levels
+func logLevelsHandler(log *config.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		root, _ := log.Level("")
+		res := LogLevels{
+			Level:   root.Level(),
+			Loggers: make(map[string]zapcore.Level),
+		}
+		for _, name := range log.Names() {
+			if lv, ok := log.Level(name); ok {
+				res.Loggers[name] = lv.Level()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			log.Error("The log levels cannot be written", zap.String("Error", err.Error()))
+		}
+	}
+}
+
+// logLevelHandler gets or changes a logger level: GET|PUT /admin/log/level[/{name}].
+// The body of PUT is {"level": "debug"}
+func logLevelHandler(log *config.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, LogLevelPath), "/")
+		lv, ok := log.Level(name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodPut {
+			log.Info("Changing log level", zap.String("Logger", name))
+		}
+		lv.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/carisa/internal/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestAdminHandler_LogLevel(t *testing.T) {
+	log := config.NewLogger(config.Zap{Level: zap.InfoLevel, Encoding: "console"})
+	mux := http.NewServeMux()
+	AdminHandler(mux, log)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+		logger string
+		level  zap.AtomicLevel
+	}{
+		{
+			name:   "Change root level",
+			method: http.MethodPut,
+			url:    LogLevelPath,
+			body:   `{"level": "error"}`,
+			status: http.StatusOK,
+			logger: "",
+			level:  zap.NewAtomicLevelAt(zap.ErrorLevel),
+		},
+		{
+			name:   "Change subsystem level",
+			method: http.MethodPut,
+			url:    LogLevelPath + "/" + config.DiscoveryLogger,
+			body:   `{"level": "debug"}`,
+			status: http.StatusOK,
+			logger: config.DiscoveryLogger,
+			level:  zap.NewAtomicLevelAt(zap.DebugLevel),
+		},
+		{
+			name:   "Unknown subsystem",
+			method: http.MethodPut,
+			url:    LogLevelPath + "/unknown",
+			body:   `{"level": "debug"}`,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Bad level",
+			method: http.MethodPut,
+			url:    LogLevelPath + "/" + config.HealthLogger,
+			body:   `{"level": "bad"}`,
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.status, rec.Code, "Status")
+			if tt.status == http.StatusOK {
+				lv, _ := log.Level(tt.logger)
+				assert.Equal(t, tt.level.Level(), lv.Level(), "Level")
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, LogLevelsPath, nil))
+	var levels LogLevels
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &levels), "Levels") {
+		assert.Equal(t, zap.ErrorLevel, levels.Level, "Root level")
+		assert.Equal(t, zap.DebugLevel, levels.Loggers[config.DiscoveryLogger], "Discovery level")
+		assert.Equal(t, zap.InfoLevel, levels.Loggers[config.HealthLogger], "Health level")
+	}
+}
@@ -18,11 +18,17 @@
 package net
 
 import (
+	"context"
 	"log"
+	"reflect"
+	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/carisa/internal/config"
+	"github.com/carisa/pkg/strings"
 	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -35,12 +41,99 @@ func HealthAddress(srv config.Server, health config.Health) string {
 	return srv.Address + ":" + strconv.Itoa(health.Port)
 }
 
+// ServerAddress returns the server address
+func ServerAddress(srv config.Server) string {
+	if len(srv.Address) == 0 || srv.Port == 0 {
+		log.Panic("The server and port cannot be empty")
+	}
+
+	return srv.Address + ":" + strconv.Itoa(srv.Port)
+}
+
+const (
+	// watchWait is the maximum time of a blocking query
+	watchWait = time.Minute
+	// watchRetry is the time to wait when a watch query fails
+	watchRetry = time.Second
+)
+
+// Metadata keys published with the services
+const (
+	MetaVersion    = "version"
+	MetaNodeType   = "node-type"
+	MetaCores      = "cores"
+	MetaMemory     = "memory"
+	MetaZone       = "zone"
+	MetaDataPort   = "data-port"
+	MetaAlgorithms = "algorithms"
+)
+
+// Service is a service instance registered into discovery service
+type Service struct {
+	ID       string
+	Name     string
+	Address  string
+	Port     int
+	NodeType config.NodeType
+	Tags     []string
+	Meta     map[string]string
+}
+
 // Discovery is the general register service
 type Discovery interface {
 	// Register registers a service into discovery service
-	Register(srv config.Server, health config.Health, name string)
+	Register(srv config.Server, disc config.Discovery, name string)
 	// DeRegister deregisters a service into discovery service
 	Deregister(id string)
+	// Services returns the healthy instances of the service
+	Services(name string) ([]Service, error)
+	// Watch sends the healthy instances of the service when they change
+	// until stop is closed. The current instances are sent first
+	Watch(name string, stop <-chan struct{}) <-chan []Service
+}
+
+// NewDiscovery creates the discovery service of the backend defined by the config type
+func NewDiscovery(log *zap.Logger, cnf config.Discovery) Discovery {
+	switch cnf.Type {
+	case config.DiscoveryConsul, "":
+		return NewConsulDiscovery(log, cnf)
+	case config.DiscoveryStatic:
+		return NewStaticDiscovery(log, cnf.Peers)
+	case config.DiscoveryDNS:
+		return NewDNSDiscovery(log, cnf)
+	case config.DiscoveryEtcd:
+		return NewEtcdDiscovery(log, cnf)
+	case config.DiscoveryMemory:
+		return NewMemoryDiscovery(log, ProcessRegistry)
+	}
+	log.Panic("The discovery type is not supported", zap.String("Type", cnf.Type))
+	return nil
+}
+
+// ServiceTags returns the tags published with the service: the node type and the custom tags
+func ServiceTags(srv config.Server, disc config.Discovery) []string {
+	tags := []string{string(srv.NodeType)}
+	for _, t := range disc.Tags {
+		if t != string(srv.NodeType) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// ServiceMeta returns the metadata published with the service: the custom metadata,
+// the version, the node type and the cores
+func ServiceMeta(srv config.Server, disc config.Discovery) map[string]string {
+	meta := make(map[string]string, len(disc.Meta)+3)
+	for k, v := range disc.Meta {
+		meta[k] = v
+	}
+	meta[MetaVersion] = config.Version
+	meta[MetaNodeType] = string(srv.NodeType)
+	if _, ok := meta[MetaCores]; !ok {
+		meta[MetaCores] = strconv.Itoa(runtime.NumCPU())
+	}
+	return meta
 }
 
 type ConsulDiscovery struct {
@@ -49,12 +142,8 @@ type ConsulDiscovery struct {
 }
 
 // NewConsulDiscovery creates the consul discovery service
-func NewConsulDiscovery(log *zap.Logger, srv string) *ConsulDiscovery {
-	cConsul := api.DefaultConfig()
-	if len(srv) > 0 {
-		cConsul.Address = srv
-	}
-	client, err := api.NewClient(cConsul)
+func NewConsulDiscovery(log *zap.Logger, cnf config.Discovery) *ConsulDiscovery {
+	client, err := newConsulClient(cnf)
 	if err != nil {
 		log.Panic("The consul discovery client cannot be created", zap.String("Error", err.Error()))
 	}
@@ -64,8 +153,44 @@ func NewConsulDiscovery(log *zap.Logger, srv string) *ConsulDiscovery {
 	}
 }
 
+// newConsulClient creates the consul client from the discovery config.
+// The empty fields take the consul defaults and environment variables
+func newConsulClient(cnf config.Discovery) (*api.Client, error) {
+	return api.NewClient(consulConfig(cnf))
+}
+
+func consulConfig(cnf config.Discovery) *api.Config {
+	cConsul := api.DefaultConfig()
+	if len(cnf.Server) > 0 {
+		cConsul.Address = cnf.Server
+	}
+	if len(cnf.Scheme) > 0 {
+		cConsul.Scheme = cnf.Scheme
+	}
+	if len(cnf.Token) > 0 {
+		cConsul.Token = cnf.Token
+	}
+	if len(cnf.Datacenter) > 0 {
+		cConsul.Datacenter = cnf.Datacenter
+	}
+	if len(cnf.Namespace) > 0 {
+		cConsul.Namespace = cnf.Namespace
+	}
+	if len(cnf.TLS.CAFile) > 0 {
+		cConsul.TLSConfig.CAFile = cnf.TLS.CAFile
+	}
+	if len(cnf.TLS.CertFile) > 0 {
+		cConsul.TLSConfig.CertFile = cnf.TLS.CertFile
+		cConsul.TLSConfig.KeyFile = cnf.TLS.KeyFile
+	}
+	if cnf.TLS.InsecureSkipVerify {
+		cConsul.TLSConfig.InsecureSkipVerify = true
+	}
+	return cConsul
+}
+
 // Register registers a service into consul
-func (d *ConsulDiscovery) Register(srv config.Server, health config.Health, name string) {
+func (d *ConsulDiscovery) Register(srv config.Server, disc config.Discovery, name string) {
 	d.log.Info("Registering server in consul ...", zap.String("ID", srv.ID))
 
 	if len(name) == 0 {
@@ -82,21 +207,14 @@ func (d *ConsulDiscovery) Register(srv config.Server, health config.Health, name
 			zap.Int("Port", srv.Port))
 	}
 
-	check := &api.AgentServiceCheck{
-		Name:                           srv.ID,
-		Interval:                       strconv.Itoa(health.Interval) + "s",
-		Timeout:                        strconv.Itoa(health.Timeout) + "s",
-		TCP:                            HealthAddress(srv, health),
-		FailuresBeforeCritical:         health.FailuresBeforeCritical,
-		DeregisterCriticalServiceAfter: strconv.Itoa(health.Timeout) + "m",
-	}
 	sr := &api.AgentServiceRegistration{
 		ID:      srv.ID,
 		Name:    name,
-		Tags:    []string{string(srv.NodeType)},
+		Tags:    ServiceTags(srv, disc),
+		Meta:    ServiceMeta(srv, disc),
 		Port:    srv.Port,
 		Address: srv.Address,
-		Check:   check,
+		Check:   consulCheck(srv, disc.Health),
 	}
 	if err := d.client.Agent().ServiceRegister(sr); err != nil {
 		d.log.Panic(
@@ -115,6 +233,18 @@ func (d *ConsulDiscovery) Register(srv config.Server, health config.Health, name
 		zap.Int("Port", srv.Port))
 }
 
+// consulCheck returns the tcp health check of the server
+func consulCheck(srv config.Server, health config.Health) *api.AgentServiceCheck {
+	return &api.AgentServiceCheck{
+		Name:                           srv.ID,
+		Interval:                       strconv.Itoa(health.Interval) + "s",
+		Timeout:                        strconv.Itoa(health.Timeout) + "s",
+		TCP:                            HealthAddress(srv, health),
+		FailuresBeforeCritical:         health.FailuresBeforeCritical,
+		DeregisterCriticalServiceAfter: strconv.Itoa(health.DeregisterCriticalServiceAfter) + "m",
+	}
+}
+
 // Deregister unregister the worker agent
 func (d *ConsulDiscovery) Deregister(id string) {
 	d.log.Info("Deregistering server in consul ...", zap.String("ID", id))
@@ -127,3 +257,146 @@ func (d *ConsulDiscovery) Deregister(id string) {
 
 	d.log.Info("Service de-registered in consul", zap.String("ID", id))
 }
+
+// Services returns the instances of the service with the health checks passing
+func (d *ConsulDiscovery) Services(name string) ([]Service, error) {
+	entries, _, err := d.client.Health().Service(name, "", true, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("the consul services cannot be found. Name: ", name))
+	}
+
+	return consulServices(entries), nil
+}
+
+func consulServices(entries []*api.ServiceEntry) []Service {
+	srvs := make([]Service, 0, len(entries))
+	for _, e := range entries {
+		address := e.Service.Address
+		if len(address) == 0 {
+			address = e.Node.Address
+		}
+		srvs = append(srvs, Service{
+			ID:       e.Service.ID,
+			Name:     e.Service.Service,
+			Address:  address,
+			Port:     e.Service.Port,
+			NodeType: config.NodeType(e.Service.Meta[MetaNodeType]),
+			Tags:     e.Service.Tags,
+			Meta:     e.Service.Meta,
+		})
+	}
+	return srvs
+}
+
+// Watch sends the healthy instances of the service using consul blocking queries
+func (d *ConsulDiscovery) Watch(name string, stop <-chan struct{}) <-chan []Service {
+	ch := make(chan []Service)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer close(ch)
+		defer cancel()
+		// The blocking query is canceled when stop is closed
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		var index uint64
+		for {
+			opts := (&api.QueryOptions{WaitIndex: index, WaitTime: watchWait}).WithContext(ctx)
+			entries, meta, err := d.client.Health().Service(name, "", true, opts)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				d.log.Error("The consul services cannot be watched", zap.String("Name", name), zap.String("Error", err.Error()))
+				if !sleep(watchRetry, stop) {
+					return
+				}
+				continue
+			}
+			next, changed := nextIndex(index, meta.LastIndex)
+			index = next
+			if !changed {
+				continue
+			}
+			if !send(ch, consulServices(entries), stop) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// nextIndex returns the wait index of the next blocking query and true when the
+// services have changed. As consul recommends, the index is reset to 0 when it goes
+// backwards, so the services are read again, and it is at least 1 otherwise
+func nextIndex(index uint64, last uint64) (uint64, bool) {
+	switch {
+	case last < index:
+		return 0, false
+	case last == index && index > 0:
+		// The wait time has expired without changes
+		return index, false
+	case last < 1:
+		return 1, true
+	default:
+		return last, true
+	}
+}
+
+// pollServices sends the services returned by query each interval when they change
+func pollServices(log *zap.Logger, name string, query func(string) ([]Service, error),
+	interval time.Duration, stop <-chan struct{}) <-chan []Service {
+	ch := make(chan []Service)
+	go func() {
+		defer close(ch)
+		var last []Service
+		first := true
+		for {
+			srvs, err := query(name)
+			if err != nil {
+				log.Error("The services cannot be watched", zap.String("Name", name), zap.String("Error", err.Error()))
+			} else if first || !equalServices(last, srvs) {
+				if !send(ch, srvs, stop) {
+					return
+				}
+				last = srvs
+				first = false
+			}
+			if !sleep(interval, stop) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func equalServices(a []Service, b []Service) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// send sends the services to ch. It returns false if stop is closed before
+func send(ch chan<- []Service, srvs []Service, stop <-chan struct{}) bool {
+	select {
+	case ch <- srvs:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// sleep waits for d. It returns false if stop is closed before
+func sleep(d time.Duration, stop <-chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
@@ -18,7 +18,10 @@
 package net
 
 import (
+	"errors"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/carisa/internal/config"
 	"github.com/carisa/pkg/log"
@@ -83,24 +86,65 @@ func TestHealthAddress(t *testing.T) {
 	}
 }
 
+func TestServerAddress(t *testing.T) {
+	assert.Equal(t, "srv:8080", ServerAddress(config.Server{Address: "srv", Port: 8080}), "Server address")
+	assert.Panics(t, func() { ServerAddress(config.Server{Address: "srv"}) }, "Port is equal Zero")
+}
+
 func TestNewConsulDiscovery(t *testing.T) {
-	d := NewConsulDiscovery(log.TestLogger(), "")
+	d := NewConsulDiscovery(log.TestLogger(), config.Discovery{})
 	assert.NotNil(t, d.log, "Logger")
 	assert.NotNil(t, d.client, "Consul client")
 }
 
+func TestConsulConfig(t *testing.T) {
+	c := consulConfig(config.Discovery{
+		Server:     "consul:8501",
+		Scheme:     "https",
+		Token:      "token",
+		Datacenter: "dc2",
+		Namespace:  "carisa",
+		TLS: config.TLS{
+			CAFile:   "ca.pem",
+			CertFile: "cert.pem",
+			KeyFile:  "key.pem",
+		},
+	})
+	assert.Equal(t, "consul:8501", c.Address, "Address")
+	assert.Equal(t, "https", c.Scheme, "Scheme")
+	assert.Equal(t, "token", c.Token, "Token")
+	assert.Equal(t, "dc2", c.Datacenter, "Datacenter")
+	assert.Equal(t, "carisa", c.Namespace, "Namespace")
+	assert.Equal(t, "ca.pem", c.TLSConfig.CAFile, "CA file")
+	assert.Equal(t, "cert.pem", c.TLSConfig.CertFile, "Cert file")
+	assert.Equal(t, "key.pem", c.TLSConfig.KeyFile, "Key file")
+	assert.False(t, c.TLSConfig.InsecureSkipVerify, "Insecure")
+}
+
+func TestConsulCheck(t *testing.T) {
+	check := consulCheck(
+		config.Server{ID: "id", Address: "localhost", Port: 8080},
+		config.Health{Interval: 10, Timeout: 5, FailuresBeforeCritical: 2, DeregisterCriticalServiceAfter: 30, Port: 8081})
+
+	assert.Equal(t, "10s", check.Interval, "Interval")
+	assert.Equal(t, "5s", check.Timeout, "Timeout")
+	assert.Equal(t, "localhost:8081", check.TCP, "TCP")
+	assert.Equal(t, 2, check.FailuresBeforeCritical, "Failures")
+	assert.Equal(t, "30m", check.DeregisterCriticalServiceAfter, "Deregister after")
+}
+
 func TestConsulDiscovery_Register(t *testing.T) {
 	t.Parallel()
 
-	ch := newConfigHealth()
+	ch := config.Discovery{Health: newConfigHealth(), Tags: []string{"gpu"}, Meta: map[string]string{MetaZone: "eu-1"}}
 	c, s := testConsulServer(t)
 	defer closecs(s)
 	d := testNewConsulDiscovery(c)
 
 	type args struct {
-		srv   config.Server
-		healh config.Health
-		name  string
+		srv  config.Server
+		disc config.Discovery
+		name string
 	}
 	tests := []struct {
 		name  string
@@ -116,26 +160,26 @@ func TestConsulDiscovery_Register(t *testing.T) {
 					Port:     8080,
 					NodeType: config.Worker,
 				},
-				healh: ch,
-				name:  "ns",
+				disc: ch,
+				name: "ns",
 			},
 			panic: false,
 		},
 		{
 			name: "GraphID empty",
 			args: args{
-				srv:   config.Server{},
-				healh: newConfigHealth(),
-				name:  "",
+				srv:  config.Server{},
+				disc: config.Discovery{Health: newConfigHealth()},
+				name: "",
 			},
 			panic: true,
 		},
 		{
 			name: "Address equal to empty",
 			args: args{
-				srv:   config.Server{},
-				healh: newConfigHealth(),
-				name:  "",
+				srv:  config.Server{},
+				disc: config.Discovery{Health: newConfigHealth()},
+				name: "",
 			},
 			panic: true,
 		},
@@ -148,8 +192,8 @@ func TestConsulDiscovery_Register(t *testing.T) {
 					Port:     0,
 					NodeType: config.Worker,
 				},
-				healh: ch,
-				name:  "gi",
+				disc: ch,
+				name: "gi",
 			},
 			panic: true,
 		},
@@ -157,22 +201,118 @@ func TestConsulDiscovery_Register(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.panic {
-				assert.Panics(t, func() { d.Register(tt.args.srv, tt.args.healh, tt.args.name) }, "Panics")
+				assert.Panics(t, func() { d.Register(tt.args.srv, tt.args.disc, tt.args.name) }, "Panics")
 				return
 			}
 
-			d.Register(tt.args.srv, tt.args.healh, tt.args.name)
+			d.Register(tt.args.srv, tt.args.disc, tt.args.name)
 			rs, _, err := c.Agent().Service(tt.args.srv.ID, &api.QueryOptions{})
 			if assert.NoError(t, err, "Error getting service info") {
 				assert.Equal(t, tt.args.srv.ID, rs.ID, "ID")
 				assert.Equal(t, tt.args.srv.Port, rs.Port, "Port")
 				assert.Equal(t, tt.args.srv.NodeType, config.NodeType(rs.Tags[0]), "TypeNode")
 				assert.Equal(t, tt.args.name, rs.Service, "GraphID")
+				assert.Equal(t, []string{"worker", "gpu"}, rs.Tags, "Tags")
+				assert.Equal(t, "eu-1", rs.Meta[MetaZone], "Zone")
 			}
 		})
 	}
 }
 
+func TestConsulDiscovery_Services(t *testing.T) {
+	t.Parallel()
+
+	c, s := testConsulServer(t)
+	defer closecs(s)
+	d := testNewConsulDiscovery(c)
+
+	srv := config.Server{
+		ID:       "123",
+		Address:  "127.0.0.1",
+		Port:     8080,
+		NodeType: config.Worker,
+	}
+	d.Register(srv, config.Discovery{Health: newConfigHealth(), Meta: map[string]string{MetaMemory: "16G"}}, "ns")
+
+	srvs, err := d.Services("unknown")
+	if assert.NoError(t, err, "Unknown service") {
+		assert.Empty(t, srvs, "Unknown service")
+	}
+	// The health check is critical until it passes
+	srvs, err = d.Services("ns")
+	if assert.NoError(t, err, "Services") {
+		for _, e := range srvs {
+			assert.Equal(t, config.Worker, e.NodeType, "NodeType")
+			assert.Equal(t, "16G", e.Meta[MetaMemory], "Memory")
+		}
+	}
+}
+
+func TestNewDiscovery(t *testing.T) {
+	assert.IsType(t, &ConsulDiscovery{}, NewDiscovery(log.TestLogger(), config.Discovery{}), "Consul")
+	assert.IsType(t, &StaticDiscovery{}, NewDiscovery(log.TestLogger(), config.Discovery{Type: config.DiscoveryStatic}), "Static")
+	assert.IsType(t, &DNSDiscovery{}, NewDiscovery(log.TestLogger(), config.Discovery{Type: config.DiscoveryDNS}), "DNS")
+	assert.IsType(t, &MemoryDiscovery{}, NewDiscovery(log.TestLogger(), config.Discovery{Type: config.DiscoveryMemory}), "Memory")
+	assert.Panics(t, func() { NewDiscovery(log.TestLogger(), config.Discovery{Type: "zookeeper"}) }, "Unknown")
+}
+
+func TestNextIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   uint64
+		last    uint64
+		next    uint64
+		changed bool
+	}{
+		{name: "First query", index: 0, last: 10, next: 10, changed: true},
+		{name: "Changed", index: 10, last: 12, next: 12, changed: true},
+		{name: "Wait expired", index: 12, last: 12, next: 12},
+		{name: "Index reset", index: 12, last: 5, next: 0},
+		{name: "Zero index", index: 0, last: 0, next: 1, changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, changed := nextIndex(tt.index, tt.last)
+			assert.Equal(t, tt.next, next, "Next")
+			assert.Equal(t, tt.changed, changed, "Changed")
+		})
+	}
+}
+
+func TestPollServices(t *testing.T) {
+	calls := 0
+	query := func(name string) ([]Service, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("query")
+		}
+		return []Service{{ID: strconv.Itoa(calls / 3)}}, nil
+	}
+	stop := make(chan struct{})
+	ch := pollServices(log.TestLogger(), "gi", query, time.Millisecond, stop)
+	assert.Equal(t, "0", receive(t, ch)[0].ID, "First")
+	assert.Equal(t, "1", receive(t, ch)[0].ID, "Changed")
+	close(stop)
+}
+
+func TestServiceTags(t *testing.T) {
+	srv := config.Server{NodeType: config.Worker}
+	assert.Equal(t, []string{"worker"}, ServiceTags(srv, config.Discovery{}))
+	assert.Equal(t, []string{"worker", "gpu"}, ServiceTags(srv, config.Discovery{Tags: []string{"worker", "gpu"}}))
+}
+
+func TestServiceMeta(t *testing.T) {
+	srv := config.Server{NodeType: config.Master}
+	meta := ServiceMeta(srv, config.Discovery{Meta: map[string]string{MetaZone: "eu-1", MetaCores: "2"}})
+	assert.Equal(t, map[string]string{
+		MetaZone:     "eu-1",
+		MetaCores:    "2",
+		MetaVersion:  config.Version,
+		MetaNodeType: "master",
+	}, meta)
+	assert.NotEmpty(t, ServiceMeta(srv, config.Discovery{})[MetaCores], "Cores")
+}
+
 func TestConsulDiscovery_Deregister(t *testing.T) {
 	t.Parallel()
 
@@ -187,7 +327,7 @@ func TestConsulDiscovery_Deregister(t *testing.T) {
 		NodeType: config.Worker,
 	}
 
-	d.Register(srv, newConfigHealth(), "ns")
+	d.Register(srv, config.Discovery{Health: newConfigHealth()}, "ns")
 	d.Deregister(srv.ID)
 	_, _, err := c.Agent().Service(srv.ID, &api.QueryOptions{})
 	assert.Contains(t, err.Error(), "404")
@@ -0,0 +1,132 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"context"
+	"net"
+	"strconv"
+	stds "strings"
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// dnsTimeout is the maximum time of a SRV lookup
+	dnsTimeout = 5 * time.Second
+	// dnsInterval is the frequency of the SRV lookups of the watches
+	dnsInterval = 10 * time.Second
+)
+
+// DNSDiscovery is the discovery service of the DNS SRV records.
+// The records are managed outside carisa, so the services are not registered
+type DNSDiscovery struct {
+	log      *zap.Logger
+	domain   string
+	resolver *net.Resolver
+}
+
+// NewDNSDiscovery creates the dns discovery service. The discovery server is the
+// dns server address and the system resolver is used when it is empty
+func NewDNSDiscovery(log *zap.Logger, cnf config.Discovery) *DNSDiscovery {
+	resolver := net.DefaultResolver
+	if len(cnf.Server) > 0 {
+		srv := cnf.Server
+		if _, _, err := net.SplitHostPort(srv); err != nil {
+			srv = net.JoinHostPort(srv, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, srv)
+			},
+		}
+	}
+	return &DNSDiscovery{
+		log:      log,
+		domain:   cnf.Domain,
+		resolver: resolver,
+	}
+}
+
+// Register does nothing because the SRV records are managed outside carisa
+func (d *DNSDiscovery) Register(srv config.Server, disc config.Discovery, name string) {
+	d.log.Info(
+		"The dns discovery does not register services",
+		zap.String("ID", srv.ID),
+		zap.String("Name", name))
+}
+
+// Deregister does nothing because the SRV records are managed outside carisa
+func (d *DNSDiscovery) Deregister(id string) {
+	d.log.Info("The dns discovery does not de-register services", zap.String("ID", id))
+}
+
+// Services returns the targets of the SRV records of <name>.<domain>
+func (d *DNSDiscovery) Services(name string) ([]Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+
+	record := d.record(name)
+	_, addrs, err := d.resolver.LookupSRV(ctx, "", "", record)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, strings.Concat("the dns services cannot be found. Record: ", record))
+	}
+	return srvServices(name, addrs), nil
+}
+
+// Watch sends the targets of the SRV records when they change. The records are polled
+func (d *DNSDiscovery) Watch(name string, stop <-chan struct{}) <-chan []Service {
+	return pollServices(d.log, name, d.Services, dnsInterval, stop)
+}
+
+func (d *DNSDiscovery) record(name string) string {
+	if len(d.domain) == 0 {
+		return name
+	}
+	return strings.Concat(name, ".", d.domain)
+}
+
+// srvServices converts the SRV records to services. The master service is named
+// master and the workers services are named by the graph id
+func srvServices(name string, addrs []*net.SRV) []Service {
+	nodeType := config.Worker
+	if name == string(config.Master) {
+		nodeType = config.Master
+	}
+	srvs := make([]Service, 0, len(addrs))
+	for _, a := range addrs {
+		address := stds.TrimSuffix(a.Target, ".")
+		srvs = append(srvs, Service{
+			ID:       address + ":" + strconv.Itoa(int(a.Port)),
+			Name:     name,
+			Address:  address,
+			Port:     int(a.Port),
+			NodeType: nodeType,
+		})
+	}
+	return srvs
+}
@@ -0,0 +1,44 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSDiscovery_Record(t *testing.T) {
+	d := NewDNSDiscovery(log.TestLogger(), config.Discovery{Domain: "carisa.svc.cluster.local"})
+	assert.Equal(t, "gi.carisa.svc.cluster.local", d.record("gi"))
+
+	d = NewDNSDiscovery(log.TestLogger(), config.Discovery{Server: "127.0.0.1"})
+	assert.Equal(t, "gi", d.record("gi"))
+	assert.NotEqual(t, net.DefaultResolver, d.resolver, "Custom resolver")
+}
+
+func TestSrvServices(t *testing.T) {
+	srvs := srvServices("master", []*net.SRV{{Target: "m1.carisa.", Port: 52422}})
+	assert.Equal(t, []Service{
+		{ID: "m1.carisa:52422", Name: "master", Address: "m1.carisa", Port: 52422, NodeType: config.Master},
+	}, srvs)
+	assert.Equal(t, config.Worker, srvServices("gi", []*net.SRV{{Target: "w1", Port: 1}})[0].NodeType)
+}
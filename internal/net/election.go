@@ -0,0 +1,230 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// TagLeader is the tag published by the leader
+const TagLeader = "leader"
+
+// leaderTTL is the time to live of the leadership when the leader does not renew it
+const leaderTTL = 15 * time.Second
+
+// Election elects the leader of the nodes that campaign for the same key
+type Election interface {
+	// Run campaigns for the leadership until stop is closed. It sends true when
+	// the node becomes the leader and false when the node loses the leadership.
+	// The leadership is released when stop is closed
+	Run(stop <-chan struct{}) <-chan bool
+	// Holder returns the id of the node that holds the leadership of the key.
+	// It is empty when there is no leader or the backend does not know it
+	Holder() (string, error)
+}
+
+// NewElection creates the election of the discovery backend. The id is the service id
+// of the node. The static and dns backends do not support elections, so the node
+// is always the leader
+func NewElection(log *zap.Logger, cnf config.Discovery, key string, id string) Election {
+	switch cnf.Type {
+	case config.DiscoveryConsul, "":
+		return NewConsulElection(log, cnf, key, id)
+	case config.DiscoveryEtcd:
+		return NewEtcdElection(log, cnf, key, id)
+	case config.DiscoveryMemory:
+		return NewMemoryElection(log, ProcessRegistry, key, id)
+	}
+	log.Warn("The discovery type does not support elections. The node is always the leader", zap.String("Type", cnf.Type))
+	return SingleElection{}
+}
+
+// Leader returns the leader service. The holder of the election is preferred over the leader tag,
+// because two services can publish the tag while the leadership is handed over.
+// The tag is only used when the holder is empty
+func Leader(srvs []Service, holder string) (Service, bool) {
+	if len(holder) > 0 {
+		for _, s := range srvs {
+			if s.ID == holder {
+				return s, true
+			}
+		}
+		return Service{}, false
+	}
+	for _, s := range srvs {
+		for _, t := range s.Tags {
+			if t == TagLeader {
+				return s, true
+			}
+		}
+	}
+	return Service{}, false
+}
+
+// SingleElection is the election of a single node, which is always the leader
+type SingleElection struct{}
+
+// Run sends true
+func (SingleElection) Run(stop <-chan struct{}) <-chan bool {
+	ch := make(chan bool)
+	go func() {
+		defer close(ch)
+		if sendLeader(ch, true, stop) {
+			<-stop
+		}
+	}()
+	return ch
+}
+
+// Holder returns empty because every node is the leader
+func (SingleElection) Holder() (string, error) {
+	return "", nil
+}
+
+// ConsulElection is the election of a consul lock. The lock session is bound to
+// the health check of the service, so the leadership is lost when the check fails
+type ConsulElection struct {
+	log    *zap.Logger
+	client *api.Client
+	key    string
+	id     string
+}
+
+// NewConsulElection creates the consul election of the key
+func NewConsulElection(log *zap.Logger, cnf config.Discovery, key string, id string) *ConsulElection {
+	client, err := newConsulClient(cnf)
+	if err != nil {
+		log.Panic("The consul election client cannot be created", zap.String("Error", err.Error()))
+	}
+	return &ConsulElection{
+		log:    log,
+		client: client,
+		key:    key,
+		id:     id,
+	}
+}
+
+// Run campaigns for the consul lock
+func (e *ConsulElection) Run(stop <-chan struct{}) <-chan bool {
+	ch := make(chan bool)
+	go func() {
+		defer close(ch)
+		for {
+			if !e.waitPassing(stop) {
+				return
+			}
+			lock, err := e.client.LockOpts(&api.LockOptions{
+				Key:   e.key,
+				Value: []byte(e.id),
+				SessionOpts: &api.SessionEntry{
+					Name:     e.key,
+					TTL:      leaderTTL.String(),
+					Behavior: api.SessionBehaviorDelete,
+					Checks:   []string{"serfHealth", "service:" + e.id},
+				},
+				MonitorRetries: 3,
+			})
+			var lost <-chan struct{}
+			if err == nil {
+				lost, err = lock.Lock(stop)
+			}
+			if err != nil {
+				e.log.Error("The consul lock cannot be acquired", zap.String("Key", e.key), zap.String("Error", err.Error()))
+				if !sleep(watchRetry, stop) {
+					return
+				}
+				continue
+			}
+			if lost == nil {
+				// Stopped while waiting for the lock
+				return
+			}
+
+			e.log.Info("The leadership has been acquired", zap.String("Key", e.key), zap.String("ID", e.id))
+			if !sendLeader(ch, true, stop) {
+				e.unlock(lock)
+				return
+			}
+			select {
+			case <-lost:
+				e.log.Warn("The leadership has been lost", zap.String("Key", e.key), zap.String("ID", e.id))
+				e.unlock(lock)
+				if !sendLeader(ch, false, stop) {
+					return
+				}
+			case <-stop:
+				e.unlock(lock)
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// waitPassing waits until the health check of the service is passing, because
+// the lock session is bound to the check and it cannot be created while the check is critical.
+// It returns false if stop is closed before
+func (e *ConsulElection) waitPassing(stop <-chan struct{}) bool {
+	waiting := false
+	for {
+		status, _, err := e.client.Agent().AgentHealthServiceByID(e.id)
+		if err == nil && status == api.HealthPassing {
+			return true
+		}
+		if !waiting {
+			waiting = true
+			e.log.Info("Waiting for the service health check to pass before campaigning",
+				zap.String("Key", e.key), zap.String("ID", e.id))
+		}
+		if !sleep(watchRetry, stop) {
+			return false
+		}
+	}
+}
+
+// Holder returns the value of the lock key when it is held by a session
+func (e *ConsulElection) Holder() (string, error) {
+	pair, _, err := e.client.KV().Get(e.key, nil)
+	if err != nil {
+		return "", err
+	}
+	if pair == nil || len(pair.Session) == 0 {
+		return "", nil
+	}
+	return string(pair.Value), nil
+}
+
+func (e *ConsulElection) unlock(lock *api.Lock) {
+	if err := lock.Unlock(); err != nil && err != api.ErrLockNotHeld {
+		e.log.Error("The consul lock cannot be released", zap.String("Key", e.key), zap.String("Error", err.Error()))
+	}
+}
+
+// sendLeader sends the leadership to ch. It returns false if stop is closed before
+func sendLeader(ch chan<- bool, leader bool, stop <-chan struct{}) bool {
+	select {
+	case ch <- leader:
+		return true
+	case <-stop:
+		return false
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewElection(t *testing.T) {
+	assert.IsType(t, &ConsulElection{}, NewElection(log.TestLogger(), config.Discovery{}, "k", "id"), "Consul")
+	assert.IsType(t, &MemoryElection{}, NewElection(log.TestLogger(), config.Discovery{Type: config.DiscoveryMemory}, "k", "id"), "Memory")
+	assert.IsType(t, SingleElection{}, NewElection(log.TestLogger(), config.Discovery{Type: config.DiscoveryStatic}, "k", "id"), "Static")
+}
+
+func TestLeader(t *testing.T) {
+	_, ok := Leader([]Service{{ID: "m1", Tags: []string{"master"}}}, "")
+	assert.False(t, ok, "No leader")
+
+	srvs := []Service{{ID: "m1", Tags: []string{"master", TagLeader}}, {ID: "m2", Tags: []string{"master", TagLeader}}}
+	leader, ok := Leader(srvs[1:], "")
+	assert.True(t, ok, "Leader by tag")
+	assert.Equal(t, "m2", leader.ID, "Leader by tag")
+
+	leader, ok = Leader(srvs, "m2")
+	assert.True(t, ok, "Holder preferred while both have the tag")
+	assert.Equal(t, "m2", leader.ID, "Holder preferred while both have the tag")
+
+	_, ok = Leader(srvs, "m3")
+	assert.False(t, ok, "Holder not passing")
+}
+
+func TestSingleElection(t *testing.T) {
+	stop := make(chan struct{})
+	ch := SingleElection{}.Run(stop)
+	assert.True(t, receiveLeader(t, ch), "Leader")
+	close(stop)
+	_, ok := <-ch
+	assert.False(t, ok, "Closed")
+}
+
+func TestMemoryElection(t *testing.T) {
+	r := NewMemoryRegistry()
+	d := NewMemoryDiscovery(log.TestLogger(), r)
+	d.Register(testMemoryServer("m1", 1), config.Discovery{}, "master")
+	d.Register(testMemoryServer("m2", 2), config.Discovery{}, "master")
+
+	stop1 := make(chan struct{})
+	me1 := NewMemoryElection(log.TestLogger(), r, "leader", "m1")
+	e1 := me1.Run(stop1)
+	assert.True(t, receiveLeader(t, e1), "m1 leader")
+	holder, _ := me1.Holder()
+	assert.Equal(t, "m1", holder, "m1 holder")
+
+	stop2 := make(chan struct{})
+	defer close(stop2)
+	e2 := NewMemoryElection(log.TestLogger(), r, "leader", "m2").Run(stop2)
+
+	r.SetPassing("m1", false)
+	assert.False(t, receiveLeader(t, e1), "m1 lost")
+	assert.True(t, receiveLeader(t, e2), "m2 leader")
+
+	r.SetPassing("m1", true)
+	close(stop1)
+	_, ok := <-e1
+	assert.False(t, ok, "Closed")
+	assert.Equal(t, "m2", r.leader("leader"), "m2 keeps the leadership")
+
+	d.Deregister("m2")
+	assert.False(t, receiveLeader(t, e2), "m2 lost")
+	assert.Empty(t, r.leader("leader"), "No leader")
+}
+
+func receiveLeader(t *testing.T, ch <-chan bool) bool {
+	select {
+	case leader := <-ch:
+		return leader
+	case <-time.After(time.Second):
+		assert.Fail(t, "The leadership has not been sent")
+		return false
+	}
+}
@@ -0,0 +1,438 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"context"
+	"encoding/json"
+	stds "strings"
+	"sync"
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"go.uber.org/zap"
+)
+
+const (
+	// etcdPrefix is the prefix of the service keys: carisa/services/<name>/<id>
+	etcdPrefix = "carisa/services/"
+	// etcdTimeout is the maximum time of an etcd request
+	etcdTimeout = 5 * time.Second
+)
+
+// EtcdDiscovery is the discovery service of etcd. The services are stored
+// with a lease that is kept alive while the service is registered, so the
+// services are removed when they stop
+type EtcdDiscovery struct {
+	log    *zap.Logger
+	client *clientv3.Client
+	// leaseKV is the part of the client that registers the services
+	leaseKV etcdLeaseKV
+	mu      sync.Mutex
+	leases  map[string]*etcdLease
+}
+
+// etcdLeaseKV stores the keys with leases
+type etcdLeaseKV interface {
+	clientv3.KV
+	clientv3.Lease
+}
+
+// etcdLease is the lease of a registered service. The lease is granted again
+// when the keep alive stops, so the id changes
+type etcdLease struct {
+	key    string
+	value  string
+	ttl    int64
+	cancel context.CancelFunc
+	// done is closed when the lease is not kept alive anymore
+	done chan struct{}
+	mu   sync.Mutex
+	id   clientv3.LeaseID
+}
+
+func (l *etcdLease) leaseID() clientv3.LeaseID {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.id
+}
+
+func (l *etcdLease) setLeaseID(id clientv3.LeaseID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.id = id
+}
+
+// NewEtcdDiscovery creates the etcd discovery service. The discovery server are
+// the etcd endpoints separated by commas
+func NewEtcdDiscovery(log *zap.Logger, cnf config.Discovery) *EtcdDiscovery {
+	client, err := newEtcdClient(log, cnf)
+	if err != nil {
+		log.Panic("The etcd discovery client cannot be created", zap.String("Error", err.Error()))
+	}
+	return &EtcdDiscovery{
+		log:     log,
+		client:  client,
+		leaseKV: client,
+		leases:  make(map[string]*etcdLease),
+	}
+}
+
+func newEtcdClient(log *zap.Logger, cnf config.Discovery) (*clientv3.Client, error) {
+	endpoints := []string{"localhost:2379"}
+	if len(cnf.Server) > 0 {
+		endpoints = stds.Split(cnf.Server, ",")
+	}
+	ecnf := clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdTimeout,
+		Logger:      log,
+	}
+	if cnf.Scheme == "https" || len(cnf.TLS.CAFile) > 0 || len(cnf.TLS.CertFile) > 0 {
+		tls, err := transport.TLSInfo{
+			CertFile:           cnf.TLS.CertFile,
+			KeyFile:            cnf.TLS.KeyFile,
+			TrustedCAFile:      cnf.TLS.CAFile,
+			InsecureSkipVerify: cnf.TLS.InsecureSkipVerify,
+		}.ClientConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "the etcd tls config cannot be created")
+		}
+		ecnf.TLS = tls
+	}
+	return clientv3.New(ecnf)
+}
+
+// Register stores the service into etcd with a lease of the health interval plus timeout
+func (d *EtcdDiscovery) Register(srv config.Server, disc config.Discovery, name string) {
+	d.log.Info("Registering server in etcd ...", zap.String("ID", srv.ID))
+
+	if len(name) == 0 {
+		d.log.Panic(
+			"The name cannot be empty",
+			zap.String("ID", srv.ID),
+			zap.String("Address", srv.Address))
+	}
+	if len(srv.Address) == 0 || srv.Port == 0 {
+		d.log.Panic(
+			"The address and port cannot be empty",
+			zap.String("ID", srv.ID),
+			zap.String("Address", srv.Address),
+			zap.Int("Port", srv.Port))
+	}
+
+	// The service is registered again when the config is reloaded
+	d.revoke(srv.ID)
+
+	value, err := json.Marshal(Service{
+		ID:       srv.ID,
+		Name:     name,
+		Address:  srv.Address,
+		Port:     srv.Port,
+		NodeType: srv.NodeType,
+		Tags:     ServiceTags(srv, disc),
+		Meta:     ServiceMeta(srv, disc),
+	})
+	if err != nil {
+		d.log.Panic("The service cannot be encoded", zap.String("ID", srv.ID), zap.String("Error", err.Error()))
+	}
+
+	lease := &etcdLease{
+		key:   etcdKey(name, srv.ID),
+		value: string(value),
+		ttl:   int64(disc.Health.Interval + disc.Health.Timeout),
+		done:  make(chan struct{}),
+	}
+	id, err := d.put(lease)
+	if err != nil {
+		d.log.Panic(
+			"The etcd discovery client cannot register the service",
+			zap.String("Namespace", name),
+			zap.String("ID", srv.ID),
+			zap.String("Address", srv.Address),
+			zap.Int("Port", srv.Port),
+			zap.String("Error", err.Error()))
+	}
+	lease.setLeaseID(id)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lease.cancel = cancel
+	go d.keepAlive(ctx, lease)
+
+	d.mu.Lock()
+	d.leases[srv.ID] = lease
+	d.mu.Unlock()
+
+	d.log.Info(
+		"Service registered in etcd",
+		zap.String("ID", srv.ID),
+		zap.String("Address", srv.Address),
+		zap.Int("Port", srv.Port))
+}
+
+// put stores the key of the lease with a new lease id
+func (d *EtcdDiscovery) put(lease *etcdLease) (clientv3.LeaseID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+
+	grant, err := d.leaseKV.Grant(ctx, lease.ttl)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := d.leaseKV.Put(ctx, lease.key, lease.value, clientv3.WithLease(grant.ID)); err != nil {
+		return 0, err
+	}
+	return grant.ID, nil
+}
+
+// keepAlive keeps the lease alive until ctx is canceled. The keep alive stops when
+// the lease expires or etcd cannot be reached, so the key is stored again with a new lease
+func (d *EtcdDiscovery) keepAlive(ctx context.Context, lease *etcdLease) {
+	defer close(lease.done)
+	for {
+		alive, err := d.leaseKV.KeepAlive(ctx, lease.leaseID())
+		if err == nil {
+			for range alive {
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("the keep alive channel has been closed")
+		}
+		d.log.Warn(
+			"The etcd lease is not kept alive and the service is registered again",
+			zap.String("Key", lease.key),
+			zap.String("Error", err.Error()))
+
+		for {
+			if !sleep(watchRetry, ctx.Done()) {
+				return
+			}
+			id, err := d.put(lease)
+			if err == nil {
+				lease.setLeaseID(id)
+				d.log.Info("Service registered again in etcd", zap.String("Key", lease.key))
+				break
+			}
+			d.log.Error(
+				"The service cannot be registered again in etcd",
+				zap.String("Key", lease.key),
+				zap.String("Error", err.Error()))
+		}
+	}
+}
+
+// Deregister revokes the lease of the service removing it from etcd
+func (d *EtcdDiscovery) Deregister(id string) {
+	d.log.Info("Deregistering server in etcd ...", zap.String("ID", id))
+
+	if err := d.revoke(id); err != nil {
+		d.log.Panic("The etcd discovery client cannot de-register the service",
+			zap.String("ID", id),
+			zap.String("Error", err.Error()))
+	}
+
+	d.log.Info("Service de-registered in etcd", zap.String("ID", id))
+}
+
+func (d *EtcdDiscovery) revoke(id string) error {
+	d.mu.Lock()
+	lease, ok := d.leases[id]
+	delete(d.leases, id)
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	// The lease is revoked when it is not granted again
+	lease.cancel()
+	<-lease.done
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+	_, err := d.leaseKV.Revoke(ctx, lease.leaseID())
+	return err
+}
+
+// Services returns the instances of the service with the lease alive
+func (d *EtcdDiscovery) Services(name string) ([]Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+
+	resp, err := d.client.Get(ctx, etcdKey(name, ""), clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("the etcd services cannot be found. Name: ", name))
+	}
+	srvs := make([]Service, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var srv Service
+		if err := json.Unmarshal(kv.Value, &srv); err != nil {
+			return nil, errors.Wrap(err, strings.Concat("the etcd service cannot be decoded. Key: ", string(kv.Key)))
+		}
+		srvs = append(srvs, srv)
+	}
+	return srvs, nil
+}
+
+// Watch sends the instances of the service when the keys of the service change
+func (d *EtcdDiscovery) Watch(name string, stop <-chan struct{}) <-chan []Service {
+	ch := make(chan []Service)
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(context.Background()))
+	go func() {
+		defer close(ch)
+		defer cancel()
+
+		changes := d.client.Watch(ctx, etcdKey(name, ""), clientv3.WithPrefix())
+		var last []Service
+		first := true
+		for {
+			srvs, err := d.Services(name)
+			if err != nil {
+				d.log.Error("The etcd services cannot be watched", zap.String("Name", name), zap.String("Error", err.Error()))
+			} else if first || !equalServices(last, srvs) {
+				if !send(ch, srvs, stop) {
+					return
+				}
+				last = srvs
+				first = false
+			}
+
+			select {
+			case resp, ok := <-changes:
+				if !ok || resp.Err() != nil {
+					// The watch is created again when it is canceled by the server
+					if !sleep(watchRetry, stop) {
+						return
+					}
+					changes = d.client.Watch(ctx, etcdKey(name, ""), clientv3.WithPrefix())
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func etcdKey(name string, id string) string {
+	return strings.Concat(etcdPrefix, name, "/", id)
+}
+
+// EtcdElection is the election of etcd. The leadership is bound to a session
+// lease, so it is lost when the node stops renewing it
+type EtcdElection struct {
+	log    *zap.Logger
+	client *clientv3.Client
+	key    string
+	id     string
+}
+
+// NewEtcdElection creates the etcd election of the key
+func NewEtcdElection(log *zap.Logger, cnf config.Discovery, key string, id string) *EtcdElection {
+	client, err := newEtcdClient(log, cnf)
+	if err != nil {
+		log.Panic("The etcd election client cannot be created", zap.String("Error", err.Error()))
+	}
+	return &EtcdElection{
+		log:    log,
+		client: client,
+		key:    key,
+		id:     id,
+	}
+}
+
+// Run campaigns for the etcd election
+func (e *EtcdElection) Run(stop <-chan struct{}) <-chan bool {
+	ch := make(chan bool)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	go func() {
+		defer close(ch)
+		for {
+			session, err := concurrency.NewSession(e.client, concurrency.WithTTL(int(leaderTTL.Seconds())),
+				concurrency.WithContext(ctx))
+			if err == nil {
+				err = concurrency.NewElection(session, e.key).Campaign(ctx, e.id)
+				if err != nil {
+					_ = session.Close()
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				e.log.Error("The etcd election cannot be won", zap.String("Key", e.key), zap.String("Error", err.Error()))
+				if !sleep(watchRetry, stop) {
+					return
+				}
+				continue
+			}
+
+			e.log.Info("The leadership has been acquired", zap.String("Key", e.key), zap.String("ID", e.id))
+			if !sendLeader(ch, true, stop) {
+				e.resign(session)
+				return
+			}
+			select {
+			case <-session.Done():
+				e.log.Warn("The leadership has been lost", zap.String("Key", e.key), zap.String("ID", e.id))
+				if !sendLeader(ch, false, stop) {
+					return
+				}
+			case <-stop:
+				e.resign(session)
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Holder returns the value of the oldest key of the election, which is the leader
+func (e *EtcdElection) Holder() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, e.key+"/", clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// resign releases the leadership revoking the session
+func (e *EtcdElection) resign(session *concurrency.Session) {
+	sctx, scancel := context.WithTimeout(context.Background(), etcdTimeout)
+	defer scancel()
+	if _, err := e.client.Revoke(sctx, session.Lease()); err != nil {
+		e.log.Error("The etcd leadership cannot be released", zap.String("Key", e.key), zap.String("Error", err.Error()))
+	}
+}
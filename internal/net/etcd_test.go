@@ -0,0 +1,109 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestNewEtcdDiscovery(t *testing.T) {
+	d := NewEtcdDiscovery(log.TestLogger(), config.Discovery{Server: "etcd1:2379,etcd2:2379"})
+	assert.Equal(t, []string{"etcd1:2379", "etcd2:2379"}, d.client.Endpoints(), "Endpoints")
+	assert.NoError(t, d.revoke("unknown"), "Revoke unknown service")
+	_ = d.client.Close()
+
+	assert.Panics(t, func() {
+		NewEtcdDiscovery(log.TestLogger(), config.Discovery{TLS: config.TLS{CAFile: "./ca.pem"}})
+	}, "CA file not found")
+}
+
+func TestEtcdKey(t *testing.T) {
+	assert.Equal(t, "carisa/services/gi/123", etcdKey("gi", "123"))
+	assert.Equal(t, "carisa/services/gi/", etcdKey("gi", ""))
+}
+
+// fakeLeaseKV grants the leases and keeps them alive until expire receives a value
+type fakeLeaseKV struct {
+	clientv3.KV
+	clientv3.Lease
+	expire  chan struct{}
+	mu      sync.Mutex
+	puts    []clientv3.LeaseID
+	revoked []clientv3.LeaseID
+}
+
+func (f *fakeLeaseKV) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &clientv3.LeaseGrantResponse{ID: clientv3.LeaseID(len(f.puts) + 1), TTL: ttl}, nil
+}
+
+func (f *fakeLeaseKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.puts = append(f.puts, clientv3.LeaseID(len(f.puts)+1))
+	return &clientv3.PutResponse{}, nil
+}
+
+func (f *fakeLeaseKV) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		defer close(ch)
+		select {
+		case <-ctx.Done():
+		case <-f.expire:
+		}
+	}()
+	return ch, nil
+}
+
+func (f *fakeLeaseKV) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked = append(f.revoked, id)
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+func (f *fakeLeaseKV) putCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.puts)
+}
+
+func TestEtcdDiscovery_KeepAlive(t *testing.T) {
+	f := &fakeLeaseKV{expire: make(chan struct{})}
+	d := &EtcdDiscovery{log: log.TestLogger(), leaseKV: f, leases: make(map[string]*etcdLease)}
+
+	d.Register(config.Server{ID: "id", Address: "localhost", Port: 8080}, config.DefaultDiscovery(8081), "gi")
+	assert.Equal(t, 1, f.putCount(), "Registered")
+
+	f.expire <- struct{}{}
+	assert.Eventually(t, func() bool { return f.putCount() == 2 }, 5*time.Second, 10*time.Millisecond,
+		"Registered again with a new lease")
+
+	d.Deregister("id")
+	assert.Equal(t, []clientv3.LeaseID{2}, f.revoked, "New lease revoked")
+}
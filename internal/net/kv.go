@@ -0,0 +1,106 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"github.com/carisa/internal/config"
+	configp "github.com/carisa/pkg/config"
+	"github.com/hashicorp/consul/api"
+)
+
+// ConsulKV reads the configuration from the consul key/value store
+type ConsulKV struct {
+	client *api.Client
+}
+
+// NewConsulKV creates the consul kv reader with the discovery client settings
+func NewConsulKV(cnf config.Discovery) (*ConsulKV, error) {
+	client, err := newConsulClient(cnf)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulKV{client: client}, nil
+}
+
+// Get returns the value of the key or nil if the key does not exist
+func (kv *ConsulKV) Get(key string) ([]byte, error) {
+	pair, _, err := kv.client.KV().Get(key, nil)
+	if err != nil || pair == nil {
+		return nil, err
+	}
+	return pair.Value, nil
+}
+
+// Put writes the value of the key
+func (kv *ConsulKV) Put(key string, value []byte) error {
+	_, err := kv.client.KV().Put(&api.KVPair{Key: key, Value: value}, nil)
+	return err
+}
+
+// Delete removes the key
+func (kv *ConsulKV) Delete(key string) error {
+	_, err := kv.client.KV().Delete(key, nil)
+	return err
+}
+
+// List returns the values of the keys with the prefix by key
+func (kv *ConsulKV) List(prefix string) (map[string][]byte, error) {
+	pairs, _, err := kv.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(pairs))
+	for _, p := range pairs {
+		values[p.Key] = p.Value
+	}
+	return values, nil
+}
+
+// KVLayer returns the configuration layer of the consul kv store.
+// The discovery config is read when the layer is resolved, so it must
+// point to the config being resolved
+func KVLayer(cnf *config.Discovery) func() (configp.KVReader, string, error) {
+	return func() (configp.KVReader, string, error) {
+		if len(cnf.ConfigKey) == 0 {
+			return nil, "", nil
+		}
+		kv, err := NewConsulKV(*cnf)
+		if err != nil {
+			return nil, "", err
+		}
+		return kv, cnf.ConfigKey, nil
+	}
+}
+
+// WatchKV makes the watcher notify the changes of the config key of the discovery.
+// The confg is the config resolved, whose fields fill the key placeholders
+func WatchKV(w *configp.Watcher, cnf config.Discovery, confg interface{}) error {
+	if len(cnf.ConfigKey) == 0 {
+		return nil
+	}
+	key, err := configp.ExpandKey(cnf.ConfigKey, confg)
+	if err != nil {
+		return err
+	}
+	kv, err := NewConsulKV(cnf)
+	if err != nil {
+		return err
+	}
+	w.WatchKV(kv, key)
+	return nil
+}
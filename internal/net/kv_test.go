@@ -0,0 +1,92 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carisa/internal/config"
+	configp "github.com/carisa/pkg/config"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsulKV_Get(t *testing.T) {
+	t.Parallel()
+
+	c, s := testConsulServer(t)
+	defer closecs(s)
+	kv := &ConsulKV{client: c}
+
+	_, err := c.KV().Put(&api.KVPair{Key: "carisa/workers/gi", Value: []byte(`{"graphID": "gi"}`)}, nil)
+	if assert.NoError(t, err, "Put") {
+		v, err := kv.Get("carisa/workers/gi")
+		assert.NoError(t, err, "Get")
+		assert.Equal(t, `{"graphID": "gi"}`, string(v), "Value")
+	}
+
+	v, err := kv.Get("carisa/workers/unknown")
+	assert.NoError(t, err, "Get unknown")
+	assert.Nil(t, v, "Unknown value")
+}
+
+func TestConsulKV_Put(t *testing.T) {
+	t.Parallel()
+
+	c, s := testConsulServer(t)
+	defer closecs(s)
+	kv := &ConsulKV{client: c}
+
+	assert.NoError(t, kv.Put("carisa/jobs/a", []byte("a")), "Put a")
+	assert.NoError(t, kv.Put("carisa/jobs/b", []byte("b")), "Put b")
+	assert.NoError(t, kv.Delete("carisa/jobs/b"), "Delete b")
+
+	values, err := kv.List("carisa/jobs/")
+	if assert.NoError(t, err, "List") {
+		assert.Equal(t, map[string][]byte{"carisa/jobs/a": []byte("a")}, values, "Values")
+	}
+}
+
+func TestKVLayer(t *testing.T) {
+	cnf := config.Discovery{}
+	layer := KVLayer(&cnf)
+
+	kv, _, err := layer()
+	assert.NoError(t, err, "Without key")
+	assert.Nil(t, kv, "Without key")
+
+	cnf.ConfigKey = "carisa/master"
+	kv, key, err := layer()
+	assert.NoError(t, err, "With key")
+	assert.NotNil(t, kv, "With key")
+	assert.Equal(t, "carisa/master", key, "Key")
+}
+
+func TestWatchKV(t *testing.T) {
+	w := configp.NewWatcher("", time.Hour)
+	cnf := config.Default(config.Worker, 0)
+
+	assert.NoError(t, WatchKV(w, cnf.Discovery, &cnf), "Without key")
+
+	cnf.Discovery.ConfigKey = "carisa/nodes/{server.id}"
+	assert.NoError(t, WatchKV(w, cnf.Discovery, &cnf), "With key")
+
+	cnf.Discovery.ConfigKey = "carisa/{unknown}"
+	assert.Error(t, WatchKV(w, cnf.Discovery, &cnf), "Unknown placeholder")
+}
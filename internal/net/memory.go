@@ -0,0 +1,352 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"sort"
+	stds "strings"
+	"sync"
+
+	"github.com/carisa/internal/config"
+	"go.uber.org/zap"
+)
+
+// ProcessRegistry is the registry shared by the memory discoveries of the process
+var ProcessRegistry = NewMemoryRegistry()
+
+// electionTopic is the prefix of the topics of the election keys
+const electionTopic = "election:"
+
+// MemoryRegistry stores the services registered by the memory discoveries and
+// the leaders of the memory elections. The services are passing when they are
+// registered and the leadership is lost when the leader service is not passing
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	services map[string]memoryService
+	leaders  map[string]string
+	watchers map[string]map[chan struct{}]bool
+}
+
+type memoryService struct {
+	Service
+	passing bool
+}
+
+// NewMemoryRegistry creates an empty registry
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		services: make(map[string]memoryService),
+		leaders:  make(map[string]string),
+		watchers: make(map[string]map[chan struct{}]bool),
+	}
+}
+
+// SetPassing changes the health of the service. It returns false if the service is not registered
+func (r *MemoryRegistry) SetPassing(id string, passing bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	srv, ok := r.services[id]
+	if !ok {
+		return false
+	}
+	if srv.passing != passing {
+		srv.passing = passing
+		r.services[id] = srv
+		r.notify(srv.Name)
+		if !passing {
+			r.resign(id)
+		} else {
+			// The service can campaign again
+			for topic := range r.watchers {
+				if stds.HasPrefix(topic, electionTopic) {
+					r.notify(topic)
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (r *MemoryRegistry) register(srv Service) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if old, ok := r.services[srv.ID]; ok && old.Name != srv.Name {
+		r.notify(old.Name)
+	}
+	r.services[srv.ID] = memoryService{Service: srv, passing: true}
+	r.notify(srv.Name)
+}
+
+func (r *MemoryRegistry) deregister(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	srv, ok := r.services[id]
+	if !ok {
+		return
+	}
+	delete(r.services, id)
+	r.notify(srv.Name)
+	r.resign(id)
+}
+
+// acquire makes id the leader of key if there is no leader. The service
+// of id cannot acquire the leadership when it is not passing
+func (r *MemoryRegistry) acquire(key string, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if srv, ok := r.services[id]; ok && !srv.passing {
+		return false
+	}
+	if leader, ok := r.leaders[key]; ok {
+		return leader == id
+	}
+	r.leaders[key] = id
+	r.notify(electionTopic + key)
+	return true
+}
+
+// release removes the leadership of id of key
+func (r *MemoryRegistry) release(key string, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.leaders[key] == id {
+		delete(r.leaders, key)
+		r.notify(electionTopic + key)
+	}
+}
+
+// leader returns the leader of key
+func (r *MemoryRegistry) leader(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.leaders[key]
+}
+
+// resign removes the leaderships of id. The registry must be locked
+func (r *MemoryRegistry) resign(id string) {
+	for key, leader := range r.leaders {
+		if leader == id {
+			delete(r.leaders, key)
+			r.notify(electionTopic + key)
+		}
+	}
+}
+
+// passing returns the passing services of name sorted by id
+func (r *MemoryRegistry) passing(name string) []Service {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	srvs := make([]Service, 0)
+	for _, s := range r.services {
+		if s.Name == name && s.passing {
+			srvs = append(srvs, s.Service)
+		}
+	}
+	sort.Slice(srvs, func(i, j int) bool { return srvs[i].ID < srvs[j].ID })
+	return srvs
+}
+
+// subscribe returns the channel signaled when the services of name
+// or the leader of the election topic change
+func (r *MemoryRegistry) subscribe(name string) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if r.watchers[name] == nil {
+		r.watchers[name] = make(map[chan struct{}]bool)
+	}
+	r.watchers[name][ch] = true
+	return ch
+}
+
+func (r *MemoryRegistry) unsubscribe(name string, ch chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.watchers[name], ch)
+	if len(r.watchers[name]) == 0 {
+		delete(r.watchers, name)
+	}
+}
+
+// notify signals the watchers of name. The registry must be locked
+func (r *MemoryRegistry) notify(name string) {
+	for ch := range r.watchers[name] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// MemoryDiscovery is the discovery service of the nodes running in the same process
+type MemoryDiscovery struct {
+	log      *zap.Logger
+	registry *MemoryRegistry
+}
+
+// NewMemoryDiscovery creates the memory discovery service over the registry
+func NewMemoryDiscovery(log *zap.Logger, registry *MemoryRegistry) *MemoryDiscovery {
+	return &MemoryDiscovery{
+		log:      log,
+		registry: registry,
+	}
+}
+
+// Register registers a service into the registry
+func (d *MemoryDiscovery) Register(srv config.Server, disc config.Discovery, name string) {
+	d.log.Info("Registering server in memory ...", zap.String("ID", srv.ID))
+
+	if len(name) == 0 {
+		d.log.Panic(
+			"The name cannot be empty",
+			zap.String("ID", srv.ID),
+			zap.String("Address", srv.Address))
+	}
+	if len(srv.Address) == 0 || srv.Port == 0 {
+		d.log.Panic(
+			"The address and port cannot be empty",
+			zap.String("ID", srv.ID),
+			zap.String("Address", srv.Address),
+			zap.Int("Port", srv.Port))
+	}
+
+	d.registry.register(Service{
+		ID:       srv.ID,
+		Name:     name,
+		Address:  srv.Address,
+		Port:     srv.Port,
+		NodeType: srv.NodeType,
+		Tags:     ServiceTags(srv, disc),
+		Meta:     ServiceMeta(srv, disc),
+	})
+
+	d.log.Info(
+		"Service registered in memory",
+		zap.String("ID", srv.ID),
+		zap.String("Address", srv.Address),
+		zap.Int("Port", srv.Port))
+}
+
+// Deregister removes the service from the registry
+func (d *MemoryDiscovery) Deregister(id string) {
+	d.registry.deregister(id)
+	d.log.Info("Service de-registered in memory", zap.String("ID", id))
+}
+
+// Services returns the passing instances of the service
+func (d *MemoryDiscovery) Services(name string) ([]Service, error) {
+	return d.registry.passing(name), nil
+}
+
+// Watch sends the passing instances of the service when they change
+func (d *MemoryDiscovery) Watch(name string, stop <-chan struct{}) <-chan []Service {
+	ch := make(chan []Service)
+	changed := d.registry.subscribe(name)
+	go func() {
+		defer close(ch)
+		defer d.registry.unsubscribe(name, changed)
+
+		last := d.registry.passing(name)
+		if !send(ch, last, stop) {
+			return
+		}
+		for {
+			select {
+			case <-changed:
+				srvs := d.registry.passing(name)
+				if equalServices(last, srvs) {
+					continue
+				}
+				if !send(ch, srvs, stop) {
+					return
+				}
+				last = srvs
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// MemoryElection is the election of the memory registry
+type MemoryElection struct {
+	log      *zap.Logger
+	registry *MemoryRegistry
+	key      string
+	id       string
+}
+
+// NewMemoryElection creates the memory election of the key
+func NewMemoryElection(log *zap.Logger, registry *MemoryRegistry, key string, id string) *MemoryElection {
+	return &MemoryElection{
+		log:      log,
+		registry: registry,
+		key:      key,
+		id:       id,
+	}
+}
+
+// Holder returns the leader of the key
+func (e *MemoryElection) Holder() (string, error) {
+	return e.registry.leader(e.key), nil
+}
+
+// Run campaigns for the leadership of the key
+func (e *MemoryElection) Run(stop <-chan struct{}) <-chan bool {
+	ch := make(chan bool)
+	changed := e.registry.subscribe(electionTopic + e.key)
+	go func() {
+		defer close(ch)
+		defer e.registry.unsubscribe(electionTopic+e.key, changed)
+		defer e.registry.release(e.key, e.id)
+
+		leader := false
+		for {
+			if !leader && e.registry.acquire(e.key, e.id) {
+				leader = true
+				e.log.Info("The leadership has been acquired", zap.String("Key", e.key), zap.String("ID", e.id))
+				if !sendLeader(ch, true, stop) {
+					return
+				}
+			} else if leader && e.registry.leader(e.key) != e.id {
+				leader = false
+				e.log.Warn("The leadership has been lost", zap.String("Key", e.key), zap.String("ID", e.id))
+				if !sendLeader(ch, false, stop) {
+					return
+				}
+			}
+
+			select {
+			case <-changed:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return ch
+}
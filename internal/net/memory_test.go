@@ -0,0 +1,98 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryDiscovery_Register(t *testing.T) {
+	r := NewMemoryRegistry()
+	d := NewMemoryDiscovery(log.TestLogger(), r)
+
+	assert.Panics(t, func() { d.Register(config.Server{ID: "w1"}, config.Discovery{}, "gi") }, "Address empty")
+	assert.Panics(t, func() { d.Register(testMemoryServer("w1", 1), config.Discovery{}, "") }, "Name empty")
+
+	d.Register(testMemoryServer("w2", 2), config.Discovery{Tags: []string{"gpu"}}, "gi")
+	d.Register(testMemoryServer("w1", 1), config.Discovery{}, "gi")
+	d.Register(testMemoryServer("m1", 3), config.Discovery{}, "master")
+
+	srvs, err := d.Services("gi")
+	if assert.NoError(t, err, "Services") {
+		assert.Len(t, srvs, 2, "Services")
+		assert.Equal(t, "w1", srvs[0].ID, "Sorted by id")
+		assert.Equal(t, []string{"worker", "gpu"}, srvs[1].Tags, "Tags")
+		assert.Equal(t, "worker", srvs[1].Meta[MetaNodeType], "Meta")
+	}
+
+	assert.True(t, r.SetPassing("w1", false), "Critical")
+	assert.False(t, r.SetPassing("unknown", false), "Unknown")
+	srvs, _ = d.Services("gi")
+	assert.Len(t, srvs, 1, "Critical service is not returned")
+
+	d.Deregister("w2")
+	d.Deregister("unknown")
+	srvs, _ = d.Services("gi")
+	assert.Empty(t, srvs, "Deregistered")
+
+	srvs, _ = NewMemoryDiscovery(log.TestLogger(), r).Services("master")
+	assert.Len(t, srvs, 1, "Registry shared")
+}
+
+func TestMemoryDiscovery_Watch(t *testing.T) {
+	r := NewMemoryRegistry()
+	d := NewMemoryDiscovery(log.TestLogger(), r)
+	stop := make(chan struct{})
+	d.Register(testMemoryServer("w1", 1), config.Discovery{}, "gi")
+
+	ch := d.Watch("gi", stop)
+	assert.Len(t, receive(t, ch), 1, "Current services")
+
+	d.Register(testMemoryServer("w2", 2), config.Discovery{}, "gi")
+	assert.Len(t, receive(t, ch), 2, "Registered")
+
+	r.SetPassing("w1", false)
+	assert.Len(t, receive(t, ch), 1, "Critical")
+
+	d.Register(testMemoryServer("m1", 3), config.Discovery{}, "master")
+	d.Deregister("w2")
+	assert.Empty(t, receive(t, ch), "Other services are not sent")
+
+	close(stop)
+	_, ok := <-ch
+	assert.False(t, ok, "Closed")
+}
+
+func testMemoryServer(id string, port int) config.Server {
+	return config.Server{ID: id, Address: "localhost", Port: port, NodeType: config.Worker}
+}
+
+func receive(t *testing.T, ch <-chan []Service) []Service {
+	select {
+	case srvs := <-ch:
+		return srvs
+	case <-time.After(time.Second):
+		assert.Fail(t, "The services have not been sent")
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"strconv"
+
+	"github.com/carisa/internal/config"
+	"go.uber.org/zap"
+)
+
+// StaticDiscovery is the discovery service of a fixed list of peers.
+// The services are not registered, so it is intended for development and tests
+type StaticDiscovery struct {
+	log   *zap.Logger
+	peers []config.Peer
+}
+
+// NewStaticDiscovery creates the static discovery service
+func NewStaticDiscovery(log *zap.Logger, peers []config.Peer) *StaticDiscovery {
+	return &StaticDiscovery{
+		log:   log,
+		peers: peers,
+	}
+}
+
+// Register does nothing because the peers are defined by configuration
+func (d *StaticDiscovery) Register(srv config.Server, disc config.Discovery, name string) {
+	d.log.Info(
+		"The static discovery does not register services",
+		zap.String("ID", srv.ID),
+		zap.String("Name", name))
+}
+
+// Deregister does nothing because the peers are defined by configuration
+func (d *StaticDiscovery) Deregister(id string) {
+	d.log.Info("The static discovery does not de-register services", zap.String("ID", id))
+}
+
+// Services returns the peers of the service
+func (d *StaticDiscovery) Services(name string) ([]Service, error) {
+	var srvs []Service
+	for _, p := range d.peers {
+		if p.Name != name {
+			continue
+		}
+		id := p.ID
+		if len(id) == 0 {
+			id = p.Address + ":" + strconv.Itoa(p.Port)
+		}
+		srvs = append(srvs, Service{
+			ID:       id,
+			Name:     p.Name,
+			Address:  p.Address,
+			Port:     p.Port,
+			NodeType: p.NodeType,
+			Tags:     p.Tags,
+			Meta:     p.Meta,
+		})
+	}
+	return srvs, nil
+}
+
+// Watch sends the peers of the service. The peers do not change
+func (d *StaticDiscovery) Watch(name string, stop <-chan struct{}) <-chan []Service {
+	ch := make(chan []Service)
+	go func() {
+		defer close(ch)
+		srvs, _ := d.Services(name)
+		if send(ch, srvs, stop) {
+			<-stop
+		}
+	}()
+	return ch
+}
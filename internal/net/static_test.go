@@ -0,0 +1,62 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"testing"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticDiscovery_Services(t *testing.T) {
+	d := NewStaticDiscovery(log.TestLogger(), []config.Peer{
+		{Name: "master", Address: "10.0.0.1", Port: 52422, NodeType: config.Master},
+		{ID: "w1", Name: "gi", Address: "10.0.0.2", Port: 62422, NodeType: config.Worker, Tags: []string{"gpu"}},
+	})
+	d.Register(config.Server{ID: "w2"}, config.Discovery{}, "gi")
+	d.Deregister("w2")
+
+	srvs, err := d.Services("master")
+	if assert.NoError(t, err, "Master") {
+		assert.Equal(t, []Service{
+			{ID: "10.0.0.1:52422", Name: "master", Address: "10.0.0.1", Port: 52422, NodeType: config.Master},
+		}, srvs, "Master")
+	}
+	srvs, err = d.Services("gi")
+	if assert.NoError(t, err, "Workers") {
+		assert.Len(t, srvs, 1, "Workers")
+		assert.Equal(t, "w1", srvs[0].ID, "ID")
+		assert.Equal(t, []string{"gpu"}, srvs[0].Tags, "Tags")
+	}
+	srvs, err = d.Services("unknown")
+	if assert.NoError(t, err, "Unknown") {
+		assert.Empty(t, srvs, "Unknown")
+	}
+}
+
+func TestStaticDiscovery_Watch(t *testing.T) {
+	d := NewStaticDiscovery(log.TestLogger(), []config.Peer{{Name: "gi", Address: "10.0.0.2", Port: 62422}})
+	stop := make(chan struct{})
+	ch := d.Watch("gi", stop)
+	assert.Len(t, receive(t, ch), 1, "Peers")
+	close(stop)
+	_, ok := <-ch
+	assert.False(t, ok, "Closed")
+}
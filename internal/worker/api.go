@@ -0,0 +1,32 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package worker
+
+import (
+	"net/http"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+)
+
+// newAPIHandler creates the http routes of the worker api
+func newAPIHandler(log *config.Logger) http.Handler {
+	mux := http.NewServeMux()
+	net.AdminHandler(mux, log)
+	return mux
+}
@@ -0,0 +1,35 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI_Admin(t *testing.T) {
+	h := newAPIHandler(config.NewLogger(config.Zap{Encoding: "console"}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, net.LogLevelsPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "Status")
+}
@@ -18,7 +18,7 @@
 package worker
 
 import (
-	"encoding/json"
+	"sync"
 
 	"github.com/carisa/internal/config"
 	"github.com/carisa/internal/net"
@@ -29,48 +29,98 @@ import (
 
 type Config struct {
 	GraphID string `json:"graphID,omitempty"`
+	// LeaderKey is the key of the leader election of the masters
+	LeaderKey string `json:"leaderKey,omitempty"`
 	config.Common
 }
 
+// Validate checks every field of the config and reports all problems at once
+func (c *Config) Validate() error {
+	var v configp.Validator
+	v.Check(len(c.GraphID) > 0, "graph-id", "the graph id cannot be empty")
+	v.Check(len(c.LeaderKey) > 0, "leader-key", "the leader key cannot be empty")
+	c.Common.Validate(&v)
+	return v.Err()
+}
+
+// ToString returns the config in json with the secret fields redacted
 func (c *Config) ToString() string {
-	r, _ := json.Marshal(c)
-	return string(r)
+	return configp.Redact(c)
 }
 
 // Factory is the worker controller
 type Factory struct {
 	config    Config
 	discovery net.Discovery
-	health    netp.Health
-	log       *zap.Logger
+	// election finds the master that holds the leadership. The worker does not campaign
+	election net.Election
+	health   netp.Health
+	api      netp.API
+	watcher  *configp.Watcher
+	log      *config.Logger
+	// mu guards the master leader followed by the worker
+	mu     sync.Mutex
+	leader *net.Service
+	// configFile and flags are kept to reload the config at runtime
+	configFile string
+	flags      map[string]string
 }
 
-// Build builds worker factory
-func FactoryBuild(configFile string) *Factory {
-	file := false
-	ref := "CARISA_WORKER_CONFIG_JSON"
-
-	if len(configFile) > 0 {
-		file = true
-		ref = configFile
+// LoadConfig resolves the worker configuration overriding the defaults
+// with the config file, the environment variables and the flags
+func LoadConfig(configFile string, flags map[string]string) (Config, configp.Sources) {
+	cnf := defaultConfig()
+	sources, err := resolveConfig(&cnf, configFile, flags)
+	if err != nil {
+		panic(err)
 	}
 
-	cnf := Config{
-		GraphID: "",
-		Common:  config.Default(config.Worker, 0),
+	return cnf, sources
+}
+
+func defaultConfig() Config {
+	return Config{
+		GraphID:   "",
+		LeaderKey: config.LeaderKey,
+		Common:    config.Default(config.Worker, 0),
 	}
-	if err := configp.Read(file, ref, &cnf); err != nil {
+}
+
+func resolveConfig(cnf *Config, configFile string, flags map[string]string) (configp.Sources, error) {
+	return configp.Resolve(configp.Layers{
+		File:      configFile,
+		EnvJSON:   "CARISA_WORKER_CONFIG_JSON",
+		EnvPrefix: config.EnvPrefix,
+		Flags:     flags,
+		KV:        net.KVLayer(&cnf.Discovery),
+	}, cnf)
+}
+
+// Build builds worker factory
+func FactoryBuild(configFile string, flags map[string]string) *Factory {
+	cnf, _ := LoadConfig(configFile, flags)
+	if err := cnf.Validate(); err != nil {
 		panic(err)
 	}
 
 	log := config.NewLogger(cnf.Common.Zap)
 
-	log.Info("Loading worker configuration", zap.String("Source", ref), zap.String("Config", cnf.ToString()))
+	log.Info("Loading worker configuration", zap.String("File", configFile), zap.String("Config", cnf.ToString()))
+
+	watcher := configp.NewWatcher(configFile, config.ReloadInterval)
+	if err := net.WatchKV(watcher, cnf.Discovery, &cnf); err != nil {
+		log.Panic("The config key cannot be watched", zap.String("Error", err.Error()))
+	}
 
 	return &Factory{
-		config:    cnf,
-		discovery: net.NewConsulDiscovery(log, cnf.Discovery.Server),
-		health:    netp.NewTCPHealth(log, net.HealthAddress(cnf.Server, cnf.Health)),
-		log:       log,
+		config:     cnf,
+		discovery:  net.NewDiscovery(log.Named(config.DiscoveryLogger), cnf.Discovery),
+		election:   net.NewElection(log.Named(config.DiscoveryLogger), cnf.Discovery, cnf.LeaderKey, cnf.Server.ID),
+		health:     netp.NewTCPHealth(log.Named(config.HealthLogger), net.HealthAddress(cnf.Server, cnf.Health)),
+		api:        netp.NewHTTPAPI(log.Logger, net.ServerAddress(cnf.Server), newAPIHandler(log)),
+		watcher:    watcher,
+		log:        log,
+		configFile: configFile,
+		flags:      flags,
 	}
 }
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/carisa/internal/config"
+	configp "github.com/carisa/pkg/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -65,16 +66,43 @@ func TestFactoryBuild(t *testing.T) {
 			t.Parallel()
 			tt.action()
 			if tt.panic {
-				assert.Panics(t, func() { FactoryBuild("") })
+				assert.Panics(t, func() { FactoryBuild("", nil) })
 				return
 			}
-			f := FactoryBuild("")
+			f := FactoryBuild("", nil)
 			assert.Equal(t, tt.ec.GraphID, f.config.GraphID, "graphID")
 			tt.ec.Common.ID = f.config.Common.ID
 			assert.Equal(t, tt.ec.Common, f.config.Common, "Common")
 			assert.NotNil(t, f.discovery, "Discovery")
 			assert.NotNil(t, f.health, "Health")
+			assert.NotNil(t, f.api, "API")
 			assert.NotNil(t, f.log, "Logger")
 		})
 	}
 }
+
+func TestLoadConfig(t *testing.T) {
+	os.Unsetenv("CARISA_WORKER_CONFIG_JSON")
+
+	cnf, sources := LoadConfig("", map[string]string{"graph-id": "flag"})
+	assert.Equal(t, "flag", cnf.GraphID, "GraphID")
+	assert.Equal(t, configp.Flag, sources["graph-id"], "GraphID source")
+	assert.Panics(t, func() { LoadConfig("", map[string]string{"unknown": "1"}) }, "Unknown flag")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cnf := Config{Common: config.Default(config.Worker, 0)}
+	err := cnf.Validate()
+	if assert.Error(t, err, "Invalid config") {
+		assert.Equal(t, "graph-id", err.(*configp.ValidationError).Violations[0].Field, "GraphID")
+	}
+
+	cnf.GraphID = "gi"
+	err = cnf.Validate()
+	if assert.Error(t, err, "Leader key empty") {
+		assert.Equal(t, "leader-key", err.(*configp.ValidationError).Violations[0].Field, "LeaderKey")
+	}
+
+	cnf.LeaderKey = config.LeaderKey
+	assert.NoError(t, cnf.Validate(), "Valid config")
+}
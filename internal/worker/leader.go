@@ -0,0 +1,78 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package worker
+
+import (
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+	"go.uber.org/zap"
+)
+
+// Leader returns the master leader. It returns false when there is no leader
+func (f *Factory) Leader() (net.Service, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.leader == nil {
+		return net.Service{}, false
+	}
+	return *f.leader, true
+}
+
+// followLeader watches the masters until stop is closed. The leader is
+// discovered again when the active master fails and a standby takes over
+func (f *Factory) followLeader(stop <-chan struct{}) {
+	for srvs := range f.discovery.Watch(string(config.Master), stop) {
+		leader, ok := net.Leader(srvs, f.holder())
+
+		f.mu.Lock()
+		changed := ok != (f.leader != nil) || (ok && leader.ID != f.leader.ID)
+		if ok {
+			f.leader = &leader
+		} else {
+			f.leader = nil
+		}
+		f.mu.Unlock()
+
+		switch {
+		case !changed:
+		case ok:
+			f.log.Info(
+				"The master leader has been discovered",
+				zap.String("ID", leader.ID),
+				zap.String("Address", leader.Address),
+				zap.Int("Port", leader.Port))
+		default:
+			f.log.Warn("There is no master leader")
+		}
+	}
+}
+
+// holder returns the master that holds the leadership. It is empty when
+// it cannot be read, so the leader is found by the tag
+func (f *Factory) holder() string {
+	if f.election == nil {
+		return ""
+	}
+	h, err := f.election.Holder()
+	if err != nil {
+		f.log.Warn("The master leader holder cannot be read", zap.String("Error", err.Error()))
+		return ""
+	}
+	return h
+}
@@ -0,0 +1,98 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFactory_FollowLeader(t *testing.T) {
+	r := net.NewMemoryRegistry()
+	d := net.NewMemoryDiscovery(log.TestLogger(), r)
+	cnf := defaultConfig()
+	f := &Factory{
+		config:    cnf,
+		discovery: d,
+		log:       config.NewLogger(cnf.Zap),
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go f.followLeader(stop)
+
+	master := func(id string, port int, tags ...string) {
+		d.Register(
+			config.Server{ID: id, Address: "localhost", Port: port, NodeType: config.Master},
+			config.Discovery{Tags: tags},
+			string(config.Master))
+	}
+	master("m1", 1, net.TagLeader)
+	master("m2", 2)
+	assert.Eventually(t, func() bool {
+		leader, ok := f.Leader()
+		return ok && leader.ID == "m1"
+	}, time.Second, time.Millisecond, "m1 leader")
+
+	r.SetPassing("m1", false)
+	assert.Eventually(t, func() bool {
+		_, ok := f.Leader()
+		return !ok
+	}, time.Second, time.Millisecond, "No leader")
+
+	master("m2", 2, net.TagLeader)
+	assert.Eventually(t, func() bool {
+		leader, ok := f.Leader()
+		return ok && leader.ID == "m2"
+	}, time.Second, time.Millisecond, "m2 leader")
+}
+
+func TestFactory_FollowLeader_Holder(t *testing.T) {
+	r := net.NewMemoryRegistry()
+	d := net.NewMemoryDiscovery(log.TestLogger(), r)
+	cnf := defaultConfig()
+	f := &Factory{
+		config:    cnf,
+		discovery: d,
+		election:  net.NewMemoryElection(log.TestLogger(), r, cnf.LeaderKey, "w1"),
+		log:       config.NewLogger(cnf.Zap),
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	m2 := net.NewMemoryElection(log.TestLogger(), r, cnf.LeaderKey, "m2").Run(stop)
+	assert.True(t, <-m2, "m2 holds the leadership")
+	go f.followLeader(stop)
+
+	// Both masters publish the leader tag while the leadership is handed over
+	for i, id := range []string{"m1", "m2"} {
+		d.Register(
+			config.Server{ID: id, Address: "localhost", Port: i + 1, NodeType: config.Master},
+			config.Discovery{Tags: []string{net.TagLeader}},
+			string(config.Master))
+	}
+	assert.Eventually(t, func() bool {
+		leader, ok := f.Leader()
+		return ok && leader.ID == "m2"
+	}, time.Second, time.Millisecond, "The holder is the leader")
+}
@@ -0,0 +1,51 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package worker
+
+import (
+	"github.com/carisa/internal/config"
+	configp "github.com/carisa/pkg/config"
+	"go.uber.org/zap"
+)
+
+// reload resolves the config again and applies the fields that can be changed at runtime
+func (f *Factory) reload() {
+	f.log.Info("Reloading worker configuration", zap.String("File", f.configFile))
+
+	cnf := defaultConfig()
+	cnf.Server.ID = f.config.Server.ID
+	if _, err := resolveConfig(&cnf, f.configFile, f.flags); err != nil {
+		f.log.Error("The worker configuration cannot be reloaded", zap.String("Error", err.Error()))
+		return
+	}
+	if err := cnf.Validate(); err != nil {
+		f.log.Error("The worker configuration reloaded is not valid", zap.String("Error", err.Error()))
+		return
+	}
+	diff, err := configp.Diff(&f.config, &cnf)
+	if err != nil {
+		f.log.Error("The worker configuration changes cannot be found", zap.String("Error", err.Error()))
+		return
+	}
+
+	if config.Reload(f.log, &f.config.Common, cnf.Common, diff) {
+		f.discovery.Register(f.config.Server, f.config.Discovery, f.config.GraphID)
+	}
+
+	f.log.Info("The worker configuration has been reloaded", zap.String("Config", f.config.ToString()))
+}
@@ -0,0 +1,89 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/carisa/internal/config"
+	"github.com/carisa/internal/net"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeDiscovery struct {
+	registered int
+}
+
+func (d *fakeDiscovery) Register(srv config.Server, disc config.Discovery, name string) {
+	d.registered++
+}
+
+func (d *fakeDiscovery) Deregister(id string) {}
+
+func (d *fakeDiscovery) Services(name string) ([]net.Service, error) { return nil, nil }
+
+func (d *fakeDiscovery) Watch(name string, stop <-chan struct{}) <-chan []net.Service { return nil }
+
+func TestFactory_Reload(t *testing.T) {
+	os.Unsetenv("CARISA_WORKER_CONFIG_JSON")
+
+	file := filepath.Join(t.TempDir(), "worker.yaml")
+	write := func(content string) {
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0600))
+	}
+
+	write("graphID: gi\n")
+	cnf, _ := LoadConfig(file, nil)
+	d := &fakeDiscovery{}
+	f := &Factory{
+		config:     cnf,
+		discovery:  d,
+		log:        config.NewLogger(cnf.Zap),
+		configFile: file,
+	}
+
+	write("graphID: other\nlog:\n  level: error\n")
+	f.reload()
+	assert.Equal(t, "gi", f.config.GraphID, "GraphID rejected")
+	assert.Equal(t, zap.ErrorLevel, f.config.Zap.Level, "Level")
+	assert.Equal(t, cnf.Server.ID, f.config.Server.ID, "Server ID kept")
+	assert.Equal(t, 0, d.registered, "Not registered")
+
+	write("graphID: gi\ndiscovery:\n  health:\n    interval: 30\n")
+	f.reload()
+	assert.Equal(t, 30, f.config.Health.Interval, "Interval")
+	assert.Equal(t, 1, d.registered, "Registered again")
+
+	write("graphID: gi\ndiscovery:\n  tags: [gpu]\n  health:\n    interval: 30\n")
+	f.reload()
+	assert.Equal(t, []string{"gpu"}, f.config.Discovery.Tags, "Tags")
+	assert.Equal(t, 2, d.registered, "Registered with tags")
+
+	write("graphID: gi\ndiscovery:\n  tags: [gpu]\n  health:\n    interval: 30\n    deregisterCriticalServiceAfter: 15\n")
+	f.reload()
+	assert.Equal(t, 15, f.config.Health.DeregisterCriticalServiceAfter, "Deregister after")
+	assert.Equal(t, 3, d.registered, "Registered with the deregister time")
+
+	write("graphID: gi\ndiscovery:\n  health:\n    interval: -1\n")
+	f.reload()
+	assert.Equal(t, 30, f.config.Health.Interval, "Invalid config is not applied")
+}
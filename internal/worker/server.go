@@ -24,10 +24,25 @@ import (
 	"go.uber.org/zap"
 )
 
-// Start starts the worker server
+// Start starts the worker server and waits for interrupt signal to gracefully shutdown the server
 func Start(factory *Factory) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt)
+	stop := make(chan struct{})
+	go func() {
+		<-quit
+		close(stop)
+	}()
+
+	Run(factory, stop)
+}
+
+// Run runs the worker server until stop is closed
+func Run(factory *Factory, stop <-chan struct{}) {
 	// Start server
+	started := make(chan struct{})
 	go func() {
+		defer close(started)
 		factory.log.Info(
 			"Starting worker server ...",
 			zap.String("ID", factory.config.Server.ID),
@@ -35,15 +50,28 @@ func Start(factory *Factory) {
 			zap.Int("Port", factory.config.Server.Port))
 
 		factory.health.Run()
-		factory.discovery.Register(factory.config.Server, factory.config.Health, factory.config.GraphID)
+		factory.api.Run()
+		factory.discovery.Register(factory.config.Server, factory.config.Discovery, factory.config.GraphID)
 
 		factory.log.Info("Worker server started")
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	go factory.followLeader(stop)
+
+	// Reload the config when it changes until the server is stopped
+	factory.watcher.Run()
+wait:
+	for {
+		select {
+		case <-factory.watcher.Changes():
+			factory.reload()
+		case <-stop:
+			break wait
+		}
+	}
+	factory.watcher.Stop()
+	// The server is registered before it is deregistered
+	<-started
 
 	factory.log.Info(
 		"Stopping worker server ...",
@@ -51,6 +79,7 @@ func Start(factory *Factory) {
 		zap.String("Address", factory.config.Server.Address))
 
 	factory.discovery.Deregister(factory.config.Server.ID)
+	factory.api.Stop()
 	factory.health.Stop()
 
 	factory.log.Info("Worker server stopped")
@@ -0,0 +1,369 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+// Package algorithm has the library vertex programs ready to run in the engine.
+// The graphs are read from edge lists and the algorithms are created by name
+package algorithm
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	stds "strings"
+	"sync"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// Algorithm is a vertex program with the conversion of its input and output
+type Algorithm interface {
+	// Job returns the job run by the engine
+	Job() engine.Job
+	// Vertices builds the encoded vertices of the edges. Undirected adds the reverse of every edge
+	Vertices(edges []Edge, undirected bool) ([]engine.Vertex, error)
+	// Format returns the output of an encoded vertex value
+	Format(value []byte) (string, error)
+	// Summary returns the readable values of the aggregators reported when the job ends
+	Summary(aggregated map[string][]byte) (map[string]string, error)
+}
+
+// Factory creates an algorithm with its parameters
+type Factory func(p Params) (Algorithm, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{
+		"pagerank":      PageRank,
+		"sssp":          SSSP,
+		"bfs":           BFS,
+		"wcc":           WCC,
+		"scc":           SCC,
+		"lpa":           LPA,
+		"louvain-local": LouvainLocal,
+		"triangles":     Triangles,
+		"clustering":    Clustering,
+		"kcore":         KCore,
+		"stats":         Stats,
+	}
+)
+
+// Register adds the algorithm, so the jobs can run it by name. i.e: a vertex program
+// prototyped in the local mode. It panics when the name is already taken
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(strings.Concat("the algorithm is already registered. Algorithm: ", name))
+	}
+	factories[name] = f
+}
+
+// New creates the algorithm by name
+func New(name string, p Params) (Algorithm, error) {
+	mu.RLock()
+	f, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, errors.New(strings.Concat("the algorithm does not exist. Algorithm: ", name))
+	}
+	alg, err := f(p)
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("the parameters are not valid. Algorithm: ", name))
+	}
+	return alg, nil
+}
+
+// Names returns the sorted names of the algorithms
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run runs the algorithm over the edges in the engine
+func Run(stop <-chan struct{}, e *engine.Engine, alg Algorithm, edges []Edge, undirected bool) (engine.Result, error) {
+	vs, err := alg.Vertices(edges, undirected)
+	if err != nil {
+		return engine.Result{}, err
+	}
+	return e.Run(stop, alg.Job(), vs)
+}
+
+// Write writes a line with the vertex id and the output of its value for every vertex
+func Write(w io.Writer, alg Algorithm, res engine.Result) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range res.Vertices {
+		out, err := alg.Format(v.Value)
+		if err != nil {
+			return errors.Wrap(err, strings.Concat("cannot format the vertex value. Vertex: ", v.ID))
+		}
+		if _, err := bw.WriteString(strings.Concat(v.ID, "\t", out, "\n")); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Params are the parameters of an algorithm by name
+type Params map[string]string
+
+// String returns the parameter or the default value when it is empty
+func (p Params) String(name string, def string) string {
+	if v, ok := p[name]; ok && len(v) > 0 {
+		return v
+	}
+	return def
+}
+
+// Int returns the integer parameter or the default value when it is empty
+func (p Params) Int(name string, def int) (int, error) {
+	v, ok := p[name]
+	if !ok || len(v) == 0 {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrap(err, strings.Concat("the parameter is not an integer. Parameter: ", name))
+	}
+	return i, nil
+}
+
+// Float returns the float parameter or the default value when it is empty
+func (p Params) Float(name string, def float64) (float64, error) {
+	v, ok := p[name]
+	if !ok || len(v) == 0 {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, strings.Concat("the parameter is not a number. Parameter: ", name))
+	}
+	return f, nil
+}
+
+// ParamsFlag is a repeated command line flag that sets the parameters of the form name=value
+type ParamsFlag Params
+
+// String returns the parameters of the form name=value sorted by name
+func (f ParamsFlag) String() string {
+	ps := make([]string, 0, len(f))
+	for name, v := range f {
+		ps = append(ps, strings.Concat(name, "=", v))
+	}
+	sort.Strings(ps)
+	return stds.Join(ps, ",")
+}
+
+// Set adds the parameter
+func (f ParamsFlag) Set(s string) error {
+	name, v, ok := stds.Cut(s, "=")
+	if !ok || len(name) == 0 {
+		return errors.New(strings.Concat("the parameter must be name=value. Parameter: ", s))
+	}
+	f[name] = v
+	return nil
+}
+
+// Edge is an edge of the input graph
+type Edge struct {
+	Source string
+	// Target is empty when the line only has the source, so the source is a vertex without edges
+	Target string
+	// Weight is the edge weight. Common value: 1
+	Weight float64
+}
+
+// ReadEdges reads an edge list. Every line is: source [target [weight]].
+// The fields are separated by spaces or tabs and the lines starting with # are comments
+func ReadEdges(r io.Reader) ([]Edge, error) {
+	var edges []Edge
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		fs := stds.Fields(sc.Text())
+		if len(fs) == 0 || stds.HasPrefix(fs[0], "#") {
+			continue
+		}
+		e := Edge{Source: fs[0], Weight: 1}
+		switch len(fs) {
+		case 1:
+		case 2:
+			e.Target = fs[1]
+		case 3:
+			e.Target = fs[1]
+			w, err := strconv.ParseFloat(fs[2], 64)
+			if err != nil {
+				return nil, errors.Wrap(err, strings.Concat("the edge weight is not a number. Line: ", strconv.Itoa(line)))
+			}
+			e.Weight = w
+		default:
+			return nil, errors.New(strings.Concat("the edge has too many fields. Line: ", strconv.Itoa(line)))
+		}
+		edges = append(edges, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot read the edges")
+	}
+	return edges, nil
+}
+
+// Definition is a typed algorithm. It implements Algorithm
+type Definition[V, E, M any] struct {
+	// Name identifies the program
+	Name string
+	// Program is the vertex program
+	Program compute.Program[V, E, M]
+	// Codecs are the codecs of the values
+	Codecs compute.Codecs[V, E, M]
+	// Master is the master compute. It is optional
+	Master compute.Master
+	// Aggregators are the aggregators of the program
+	Aggregators []compute.RawAggregator
+	// Combiner combines the messages. It is optional
+	Combiner compute.RawCombiner
+	// Reported are the names of the aggregators of the summary
+	Reported []string
+	// MaxSupersteps ends the job after the supersteps. 0 is no limit
+	MaxSupersteps int
+	// Conflicts resolves the mutations of the program
+	Conflicts engine.Conflicts
+	// Undirected adds the reverse edges even if the job is directed
+	Undirected bool
+	// Required are the ids of the vertices that must be in the graph. i.e: the source vertex
+	Required []string
+	// Init returns the initial value of the vertex
+	Init func(id string) V
+	// Edge returns the edge value of the input weight
+	Edge func(weight float64) E
+	// Output returns the output of the vertex value
+	Output func(v V) string
+}
+
+// Job returns the program bound to the codecs
+func (d *Definition[V, E, M]) Job() engine.Job {
+	return engine.Job{
+		Program:       compute.Bind(d.Name, d.Program, d.Codecs),
+		Master:        d.Master,
+		Aggregators:   d.Aggregators,
+		Combiner:      d.Combiner,
+		MaxSupersteps: d.MaxSupersteps,
+		Conflicts:     d.Conflicts,
+	}
+}
+
+// Vertices creates a vertex for every id of the edges with the initial value.
+// The duplicated edges are removed keeping the first one.
+// It fails when a required vertex is not in the edges
+func (d *Definition[V, E, M]) Vertices(edges []Edge, undirected bool) ([]engine.Vertex, error) {
+	undirected = undirected || d.Undirected
+	index := make(map[string]int)
+	var vs []engine.Vertex
+	seen := make(map[[2]string]bool)
+	vertex := func(id string) *engine.Vertex {
+		i, ok := index[id]
+		if !ok {
+			i = len(vs)
+			index[id] = i
+			vs = append(vs, engine.Vertex{ID: id})
+		}
+		return &vs[i]
+	}
+	add := func(source, target string, weight float64) error {
+		if seen[[2]string{source, target}] {
+			return nil
+		}
+		seen[[2]string{source, target}] = true
+		r, err := codec.Encode(d.Codecs.Edge, d.Edge(weight))
+		if err != nil {
+			return errors.Wrap(err, strings.Concat("cannot encode the edge value. Source: ", source, ". Target: ", target))
+		}
+		v := vertex(source)
+		v.Edges = append(v.Edges, compute.Edge[[]byte]{Target: target, Value: r})
+		return nil
+	}
+
+	for _, e := range edges {
+		vertex(e.Source)
+		if len(e.Target) == 0 {
+			continue
+		}
+		vertex(e.Target)
+		if err := add(e.Source, e.Target, e.Weight); err != nil {
+			return nil, err
+		}
+		if undirected && e.Source != e.Target {
+			if err := add(e.Target, e.Source, e.Weight); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, id := range d.Required {
+		if _, ok := index[id]; !ok {
+			return nil, errors.New(strings.Concat("the vertex is not in the graph. Vertex: ", id))
+		}
+	}
+
+	for i := range vs {
+		r, err := codec.Encode(d.Codecs.Vertex, d.Init(vs[i].ID))
+		if err != nil {
+			return nil, errors.Wrap(err, strings.Concat("cannot encode the vertex value. Vertex: ", vs[i].ID))
+		}
+		vs[i].Value = r
+	}
+	return vs, nil
+}
+
+// Format decodes the value and formats it
+func (d *Definition[V, E, M]) Format(value []byte) (string, error) {
+	v, err := codec.Decode(d.Codecs.Vertex, value)
+	if err != nil {
+		return "", err
+	}
+	return d.Output(v), nil
+}
+
+// Summary formats the reported aggregators. The aggregators without value report their zero value
+func (d *Definition[V, E, M]) Summary(aggregated map[string][]byte) (map[string]string, error) {
+	res := make(map[string]string, len(d.Reported))
+	for _, name := range d.Reported {
+		for _, a := range d.Aggregators {
+			if a.Name() != name {
+				continue
+			}
+			v, err := a.Format(aggregated[name])
+			if err != nil {
+				return nil, err
+			}
+			res[name] = v
+		}
+	}
+	return res, nil
+}
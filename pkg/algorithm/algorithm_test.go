@@ -0,0 +1,149 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// degree sets the out degree of every vertex
+func degree(Params) (Algorithm, error) {
+	return &Definition[int64, float64, int64]{
+		Name: "test-degree",
+		Program: compute.Compute[int64, float64, int64](func(ctx compute.Context[int64, float64, int64], messages []int64) error {
+			ctx.SetValue(int64(len(ctx.Edges())))
+			ctx.VoteToHalt()
+			return nil
+		}),
+		Codecs: compute.Codecs[int64, float64, int64]{Vertex: codec.Int64{}, Edge: codec.Float64{}, Message: codec.Int64{}},
+		Init:   func(string) int64 { return 0 },
+		Edge:   func(w float64) float64 { return w },
+		Output: func(v int64) string { return strconv.FormatInt(v, 10) },
+	}, nil
+}
+
+func TestReadEdges(t *testing.T) {
+	edges, err := ReadEdges(strings.NewReader("# comment\na b\n\nb\tc 2.5\nd\n"))
+	if assert.NoError(t, err, "Read") {
+		assert.Equal(t, []Edge{
+			{Source: "a", Target: "b", Weight: 1},
+			{Source: "b", Target: "c", Weight: 2.5},
+			{Source: "d", Weight: 1},
+		}, edges, "Edges")
+	}
+
+	_, err = ReadEdges(strings.NewReader("a b x"))
+	assert.Error(t, err, "Bad weight")
+	_, err = ReadEdges(strings.NewReader("a b 1 2"))
+	assert.Error(t, err, "Too many fields")
+}
+
+func TestParams(t *testing.T) {
+	p := Params{"i": "3", "f": "0.5", "s": "x", "bad": "x", "empty": ""}
+	i, err := p.Int("i", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, i, "Int")
+	i, _ = p.Int("empty", 1)
+	assert.Equal(t, 1, i, "Default int")
+	_, err = p.Int("bad", 1)
+	assert.Error(t, err, "Bad int")
+
+	f, err := p.Float("f", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, f, "Float")
+	f, _ = p.Float("missing", 1)
+	assert.Equal(t, 1.0, f, "Default float")
+	_, err = p.Float("bad", 1)
+	assert.Error(t, err, "Bad float")
+
+	assert.Equal(t, "x", p.String("s", "y"), "String")
+	assert.Equal(t, "y", p.String("empty", "y"), "Default string")
+}
+
+func TestParamsFlag(t *testing.T) {
+	p := Params{}
+	f := ParamsFlag(p)
+	assert.NoError(t, f.Set("source=a"), "Set")
+	assert.NoError(t, f.Set("damping=0.9"), "Set")
+	assert.Equal(t, Params{"source": "a", "damping": "0.9"}, p, "Params")
+	assert.Equal(t, "damping=0.9,source=a", f.String(), "String")
+	assert.Error(t, f.Set("source"), "Without value")
+	assert.Error(t, f.Set("=a"), "Without name")
+}
+
+func TestNew(t *testing.T) {
+	assert.Contains(t, Names(), "pagerank", "Names")
+
+	_, err := New("unknown", nil)
+	assert.Error(t, err, "Unknown")
+	_, err = New("pagerank", Params{"damping": "x"})
+	assert.Error(t, err, "Bad params")
+
+	alg, err := New("pagerank", nil)
+	if assert.NoError(t, err, "New") {
+		assert.Equal(t, "pagerank", alg.Job().Program.Name(), "Program")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-degree", degree)
+	assert.Contains(t, Names(), "test-degree", "Names")
+	assert.Panics(t, func() { Register("test-degree", degree) }, "Duplicated")
+
+	alg, err := New("test-degree", nil)
+	if assert.NoError(t, err, "New") {
+		assert.Equal(t, "test-degree", alg.Job().Program.Name(), "Program")
+	}
+}
+
+func TestDefinition_Vertices(t *testing.T) {
+	alg, _ := PageRank(nil)
+	edges := []Edge{{Source: "a", Target: "b"}, {Source: "a", Target: "b"}, {Source: "b", Target: "a"}, {Source: "c"}}
+
+	vs, err := alg.Vertices(edges, false)
+	if assert.NoError(t, err, "Directed") && assert.Len(t, vs, 3, "Vertices") {
+		assert.Equal(t, "a", vs[0].ID, "Source")
+		assert.Len(t, vs[0].Edges, 1, "Duplicated edge removed")
+		assert.Empty(t, vs[2].Edges, "Vertex without edges")
+	}
+
+	vs, err = alg.Vertices(edges[:1], true)
+	if assert.NoError(t, err, "Undirected") && assert.Len(t, vs, 2, "Vertices") {
+		assert.Equal(t, "a", vs[1].Edges[0].Target, "Reverse edge")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	alg, _ := PageRank(nil)
+	e := engine.New(log.TestLogger(), 2, engine.NewLoopback())
+	res, err := Run(make(chan struct{}), e, alg, []Edge{{Source: "a", Target: "b"}, {Source: "b", Target: "a"}}, false)
+	if assert.NoError(t, err, "Run") {
+		var buf bytes.Buffer
+		assert.NoError(t, Write(&buf, alg, res), "Write")
+		assert.Equal(t, "a\t0.5\nb\t0.5\n", buf.String(), "Output")
+	}
+}
@@ -0,0 +1,514 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// Community aggregators
+const (
+	// ModularityAggregator is the modularity of the communities
+	ModularityAggregator = "modularity"
+	// WeightAggregator is the sum of the vertex degrees: twice the weight of the edges
+	WeightAggregator = "weight"
+	// QualityAggregator is the modularity of the communities of the last iteration
+	QualityAggregator = "quality"
+	// ImprovedAggregator is set by the master compute when the modularity of the last iteration is the best one
+	ImprovedAggregator = "improved"
+	// FrozenAggregator is set by the master compute to stop the label changes
+	FrozenAggregator = "frozen"
+	// ConvergedAggregator is set by the master compute when the vertices stop moving
+	ConvergedAggregator = "converged"
+)
+
+// The community labels are vertex ids, so the vertex of a label owns the community:
+// the members send it their degree and it returns the total degree of the community
+const (
+	// neighborMessage is the label of a neighbor and the total degree of its community
+	neighborMessage byte = iota
+	// degreeMessage is the degree of a member sent to the owner of its community
+	degreeMessage
+	// totalMessage is the total degree of the community sent by its owner to a member
+	totalMessage
+)
+
+// communityMessage is a message of the community algorithms
+type communityMessage struct {
+	Kind   byte
+	From   string
+	Label  string
+	Value  float64
+	Degree float64
+}
+
+// communityCodec encodes the community messages
+type communityCodec struct{}
+
+func (communityCodec) Name() string { return "community" }
+
+func (communityCodec) Append(dst []byte, m communityMessage) ([]byte, error) {
+	dst = append(dst, m.Kind)
+	dst, _ = codec.String{}.Append(dst, m.From)
+	dst, _ = codec.String{}.Append(dst, m.Label)
+	dst, _ = codec.Float64{}.Append(dst, m.Value)
+	return codec.Float64{}.Append(dst, m.Degree)
+}
+
+func (communityCodec) Decode(src []byte) (communityMessage, int, error) {
+	var m communityMessage
+	if len(src) == 0 {
+		return m, 0, codec.ErrShortBuffer
+	}
+	m.Kind = src[0]
+	n := 1
+	var err error
+	var l int
+	if m.From, l, err = (codec.String{}).Decode(src[n:]); err != nil {
+		return m, 0, err
+	}
+	n += l
+	if m.Label, l, err = (codec.String{}).Decode(src[n:]); err != nil {
+		return m, 0, err
+	}
+	n += l
+	if m.Value, l, err = (codec.Float64{}).Decode(src[n:]); err != nil {
+		return m, 0, err
+	}
+	n += l
+	if m.Degree, l, err = (codec.Float64{}).Decode(src[n:]); err != nil {
+		return m, 0, err
+	}
+	return m, n + l, nil
+}
+
+// degreeOf returns the weighted degree of the vertex
+func degreeOf(edges []compute.Edge[float64]) float64 {
+	k := 0.0
+	for _, e := range edges {
+		k += e.Value
+	}
+	return k
+}
+
+// weightsTo returns the weight of the edges by target
+func weightsTo(edges []compute.Edge[float64]) map[string]float64 {
+	ws := make(map[string]float64, len(edges))
+	for _, e := range edges {
+		ws[e.Target] = e.Value
+	}
+	return ws
+}
+
+func communityParams(p Params) (int, float64, error) {
+	iterations, err := p.Int("maxIterations", 20)
+	if err != nil {
+		return 0, 0, err
+	}
+	tolerance, err := p.Float("tolerance", 0.000001)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch {
+	case iterations <= 0:
+		return 0, 0, errors.New("the max iterations must be greater than 0")
+	case tolerance < 0:
+		return 0, 0, errors.New("the tolerance cannot be negative")
+	}
+	return iterations, tolerance, nil
+}
+
+// LPA detects the communities with label propagation: every vertex takes the label
+// with the highest weight among its neighbors. The ties keep the current label or take
+// the lowest one. The edges are undirected. The params are:
+//   - maxIterations: the labels are frozen after the iterations. Common value: 20
+//
+// The modularity of the communities is reported in the summary
+func LPA(p Params) (Algorithm, error) {
+	iterations, _, err := communityParams(p)
+	if err != nil {
+		return nil, err
+	}
+
+	weight := compute.SumFloat64(WeightAggregator)
+	weight.Persistent = true
+	modularity := compute.SumFloat64(ModularityAggregator)
+	changed := compute.SumInt64(ChangedAggregator)
+	frozen := compute.Aggregator[int64]{Key: FrozenAggregator, Codec: codec.Int64{}, Reduce: maxInt64, Persistent: true}
+
+	program := compute.Compute[string, float64, communityMessage](
+		func(ctx compute.Context[string, float64, communityMessage], messages []communityMessage) error {
+			edges := ctx.Edges()
+			label := ctx.Value()
+			if ctx.Superstep() == 0 {
+				label = ctx.ID()
+				if err := weight.Aggregate(ctx, degreeOf(edges)); err != nil {
+					return err
+				}
+			} else {
+				w, err := weight.Value(ctx)
+				if err != nil {
+					return err
+				}
+				f, err := frozen.Value(ctx)
+				if err != nil {
+					return err
+				}
+
+				// The messages are the labels of the previous superstep, so its modularity is aggregated
+				ws := weightsTo(edges)
+				counts := make(map[string]float64)
+				owned := 0.0
+				for _, m := range messages {
+					if m.Kind == degreeMessage {
+						owned += m.Value
+						continue
+					}
+					counts[m.Label] += ws[m.From]
+				}
+				if w > 0 {
+					if err := modularity.Aggregate(ctx, counts[label]/w-(owned/w)*(owned/w)); err != nil {
+						return err
+					}
+				}
+
+				if f == 0 {
+					next := label
+					for l, c := range counts {
+						if c > counts[next] || (c == counts[next] && next != label && l < next) {
+							next = l
+						}
+					}
+					if next != label {
+						label = next
+						if err := changed.Aggregate(ctx, 1); err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			ctx.SetValue(label)
+			ctx.SendToNeighbors(communityMessage{Kind: neighborMessage, From: ctx.ID(), Label: label})
+			ctx.Send(label, communityMessage{Kind: degreeMessage, From: ctx.ID(), Value: degreeOf(edges)})
+			return nil
+		})
+
+	// The labels of a superstep are measured in the next one, so the job ends
+	// a superstep after the labels stop changing
+	master := compute.MasterCompute(func(ctx compute.MasterContext) error {
+		if ctx.Superstep() < 2 {
+			return nil
+		}
+		c, err := changed.Value(ctx)
+		if err != nil {
+			return err
+		}
+		if c == 0 {
+			ctx.Halt()
+			return nil
+		}
+		if ctx.Superstep() > iterations {
+			return frozen.Set(ctx, 1)
+		}
+		return nil
+	})
+
+	return &Definition[string, float64, communityMessage]{
+		Name:        "lpa",
+		Program:     program,
+		Codecs:      compute.Codecs[string, float64, communityMessage]{Vertex: codec.String{}, Edge: codec.Float64{}, Message: communityCodec{}},
+		Master:      master,
+		Aggregators: []compute.RawAggregator{weight.Raw(), modularity.Raw(), changed.Raw(), frozen.Raw()},
+		Reported:    []string{ModularityAggregator},
+		Undirected:  true,
+		Init:        func(string) string { return "" },
+		Edge:        func(w float64) float64 { return w },
+		Output:      func(v string) string { return v },
+	}, nil
+}
+
+// louvainVertex is the state of a vertex in the Louvain local moving
+type louvainVertex struct {
+	// Community is the current community
+	Community string
+	// Prev is the community before the last move
+	Prev string
+	// Best is the community of the best modularity
+	Best string
+	// Degree is the weighted degree of the vertex
+	Degree float64
+	// Tot is the total degree of the community
+	Tot float64
+	// Owned is the total degree of the community owned by the vertex
+	Owned float64
+}
+
+// louvainCodec encodes the state of the Louvain vertices
+type louvainCodec struct{}
+
+func (louvainCodec) Name() string { return "louvain" }
+
+func (louvainCodec) Append(dst []byte, v louvainVertex) ([]byte, error) {
+	for _, s := range []string{v.Community, v.Prev, v.Best} {
+		dst, _ = codec.String{}.Append(dst, s)
+	}
+	for _, f := range []float64{v.Degree, v.Tot, v.Owned} {
+		dst, _ = codec.Float64{}.Append(dst, f)
+	}
+	return dst, nil
+}
+
+func (louvainCodec) Decode(src []byte) (louvainVertex, int, error) {
+	var v louvainVertex
+	n := 0
+	for _, s := range []*string{&v.Community, &v.Prev, &v.Best} {
+		d, l, err := codec.String{}.Decode(src[n:])
+		if err != nil {
+			return v, 0, err
+		}
+		*s = d
+		n += l
+	}
+	for _, f := range []*float64{&v.Degree, &v.Tot, &v.Owned} {
+		d, l, err := codec.Float64{}.Decode(src[n:])
+		if err != nil {
+			return v, 0, err
+		}
+		*f = d
+		n += l
+	}
+	return v, n, nil
+}
+
+// Louvain phases. Every iteration takes three supersteps after the first one
+const (
+	// louvainTotal sums the degree of the members in the owner of the community
+	louvainTotal = iota
+	// louvainNeighbor sends the community and its total degree to the neighbors
+	louvainNeighbor
+	// louvainMove moves the vertex to the neighbor community of the highest modularity gain
+	louvainMove
+)
+
+func louvainPhase(superstep int) int {
+	return (superstep - 1) % 3
+}
+
+// LouvainLocal detects the communities maximizing the modularity with the local moving of
+// the Louvain method: every vertex moves to the neighbor community of the highest modularity
+// gain. The moves are synchronous and may decrease the modularity, so half of the vertices
+// move in every iteration and the communities of the best modularity are kept. The job ends when
+// no vertex has a better community. The edges are undirected.
+// It is only the first phase of the Louvain method: the communities are not coarsened into
+// a new graph and moved again, so no community is merged once no single vertex improves it.
+// The modularity is the one of a local optimum by vertex moves. It is the one of the full method
+// on graphs of well separated communities, i.e: 5/14 on two triangles joined by an edge, and
+// lower on graphs of nested communities. The params are:
+//   - maxIterations: the max number of moves. Common value: 20
+//   - tolerance: the min improvement of the modularity to keep the communities. Common value: 0.000001
+//
+// The modularity of the communities is reported in the summary
+func LouvainLocal(p Params) (Algorithm, error) {
+	iterations, tolerance, err := communityParams(p)
+	if err != nil {
+		return nil, err
+	}
+
+	weight := compute.SumFloat64(WeightAggregator)
+	weight.Persistent = true
+	quality := compute.SumFloat64(QualityAggregator)
+	best := compute.Aggregator[float64]{Key: ModularityAggregator, Codec: codec.Float64{}, Zero: math.Inf(-1),
+		Reduce: math.Max, Persistent: true}
+	improved := compute.Aggregator[int64]{Key: ImprovedAggregator, Codec: codec.Int64{}, Reduce: maxInt64}
+	converged := compute.Aggregator[int64]{Key: ConvergedAggregator, Codec: codec.Int64{}, Reduce: maxInt64, Persistent: true}
+	moved := compute.SumInt64(ChangedAggregator)
+
+	program := compute.Compute[louvainVertex, float64, communityMessage](
+		func(ctx compute.Context[louvainVertex, float64, communityMessage], messages []communityMessage) error {
+			v := ctx.Value()
+			if ctx.Superstep() == 0 {
+				v = louvainVertex{Community: ctx.ID(), Prev: ctx.ID(), Best: ctx.ID(), Degree: degreeOf(ctx.Edges())}
+				if err := weight.Aggregate(ctx, v.Degree); err != nil {
+					return err
+				}
+				ctx.Send(v.Community, communityMessage{Kind: degreeMessage, From: ctx.ID(), Value: v.Degree})
+				ctx.SetValue(v)
+				return nil
+			}
+
+			switch louvainPhase(ctx.Superstep()) {
+			case louvainTotal:
+				imp, err := improved.Value(ctx)
+				if err != nil {
+					return err
+				}
+				if imp > 0 {
+					v.Best = v.Prev
+				}
+				v.Owned = 0
+				for _, m := range messages {
+					v.Owned += m.Value
+				}
+				for _, m := range messages {
+					ctx.Send(m.From, communityMessage{Kind: totalMessage, From: ctx.ID(), Value: v.Owned})
+				}
+			case louvainNeighbor:
+				for _, m := range messages {
+					v.Tot = m.Value
+				}
+				ctx.SendToNeighbors(communityMessage{
+					Kind: neighborMessage, From: ctx.ID(), Label: v.Community, Value: v.Tot, Degree: v.Degree})
+			case louvainMove:
+				w, err := weight.Value(ctx)
+				if err != nil {
+					return err
+				}
+				if w == 0 {
+					break
+				}
+				next, err := louvainMoveTo(ctx, quality, v, w, messages)
+				if err != nil {
+					return err
+				}
+				v.Prev = v.Community
+				if next != v.Community {
+					if err := moved.Aggregate(ctx, 1); err != nil {
+						return err
+					}
+					if louvainMoves(ctx.ID(), ctx.Superstep()) {
+						v.Community = next
+					}
+				}
+				ctx.Send(v.Community, communityMessage{Kind: degreeMessage, From: ctx.ID(), Value: v.Degree})
+			}
+			ctx.SetValue(v)
+			return nil
+		})
+
+	// The modularity of the communities before the moves is known after the move superstep.
+	// The vertices keep the best communities in the next superstep, so the job ends after it
+	master := compute.MasterCompute(func(ctx compute.MasterContext) error {
+		switch {
+		case ctx.Superstep() < 2:
+		case louvainPhase(ctx.Superstep()) == louvainTotal:
+			q, err := quality.Value(ctx)
+			if err != nil {
+				return err
+			}
+			b, err := best.Value(ctx)
+			if err != nil {
+				return err
+			}
+			m, err := moved.Value(ctx)
+			if err != nil {
+				return err
+			}
+			if q > b+tolerance {
+				if err := best.Set(ctx, q); err != nil {
+					return err
+				}
+				if err := improved.Set(ctx, 1); err != nil {
+					return err
+				}
+			} else if m == 0 {
+				ctx.Halt()
+				return nil
+			}
+			if m == 0 {
+				return converged.Set(ctx, 1)
+			}
+		case louvainPhase(ctx.Superstep()) == louvainNeighbor:
+			c, err := converged.Value(ctx)
+			if err != nil {
+				return err
+			}
+			if c > 0 || (ctx.Superstep()-1)/3 >= iterations {
+				ctx.Halt()
+			}
+		}
+		return nil
+	})
+
+	return &Definition[louvainVertex, float64, communityMessage]{
+		Name:        "louvain-local",
+		Program:     program,
+		Codecs:      compute.Codecs[louvainVertex, float64, communityMessage]{Vertex: louvainCodec{}, Edge: codec.Float64{}, Message: communityCodec{}},
+		Master:      master,
+		Aggregators: []compute.RawAggregator{weight.Raw(), quality.Raw(), best.Raw(), improved.Raw(), converged.Raw(), moved.Raw()},
+		Reported:    []string{ModularityAggregator},
+		Undirected:  true,
+		Init:        func(string) louvainVertex { return louvainVertex{} },
+		Edge:        func(w float64) float64 { return w },
+		Output:      func(v louvainVertex) string { return v.Best },
+	}, nil
+}
+
+// louvainMoves returns if the vertex can move in the superstep. Half of the vertices move
+// in every iteration, so the neighbors do not swap their communities forever
+func louvainMoves(id string, superstep int) bool {
+	return engine.PartitionOf(strings.Concat(id, "/", strconv.Itoa(superstep)), 2) == 0
+}
+
+// louvainMoveTo aggregates the modularity of the current communities and returns the
+// neighbor community of the highest gain. The gain of a community is proportional to:
+// the weight to the community - the total degree of the community * the vertex degree / w.
+// A single vertex only moves to the community of another single vertex with a lower label,
+// so two single vertices do not swap their communities
+func louvainMoveTo(ctx compute.Context[louvainVertex, float64, communityMessage], quality compute.Aggregator[float64],
+	v louvainVertex, w float64, messages []communityMessage) (string, error) {
+	ws := weightsTo(ctx.Edges())
+	kin := make(map[string]float64)
+	tots := make(map[string]float64)
+	singles := make(map[string]bool)
+	for _, m := range messages {
+		kin[m.Label] += ws[m.From]
+		tots[m.Label] = m.Value
+		singles[m.Label] = m.Value == m.Degree
+	}
+
+	q := kin[v.Community] / w
+	if v.Owned > 0 {
+		q -= (v.Owned / w) * (v.Owned / w)
+	}
+	if err := quality.Aggregate(ctx, q); err != nil {
+		return "", err
+	}
+
+	single := v.Tot == v.Degree
+	next := v.Community
+	gain := kin[v.Community] - (v.Tot-v.Degree)*v.Degree/w
+	for c, k := range kin {
+		if c == v.Community || (single && singles[c] && c > v.Community) {
+			continue
+		}
+		g := k - tots[c]*v.Degree/w
+		if g > gain || (g == gain && next != v.Community && c < next) {
+			next = c
+			gain = g
+		}
+	}
+	return next, nil
+}
@@ -0,0 +1,118 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// twoTriangles are two triangles joined by the edge c-d. The modularity of the triangles is 5/14
+func twoTriangles() []Edge {
+	return []Edge{
+		{Source: "a", Target: "b", Weight: 1},
+		{Source: "b", Target: "c", Weight: 1},
+		{Source: "c", Target: "a", Weight: 1},
+		{Source: "c", Target: "d", Weight: 1},
+		{Source: "d", Target: "e", Weight: 1},
+		{Source: "e", Target: "f", Weight: 1},
+		{Source: "f", Target: "d", Weight: 1},
+	}
+}
+
+func TestLPA(t *testing.T) {
+	edges := append(twoTriangles(), Edge{Source: "z"})
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			alg, _ := New("lpa", nil)
+			res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), partitions, engine.NewLoopback()), alg, edges, false)
+			if assert.NoError(t, err, "Run") {
+				assert.Equal(t, map[string]string{"a": "a", "b": "a", "c": "a", "d": "d", "e": "d", "f": "d", "z": "z"},
+					outputsOf(t, alg, res), "Communities")
+				summary, err := alg.Summary(res.Aggregated)
+				assert.NoError(t, err, "Summary")
+				assert.Equal(t, map[string]string{ModularityAggregator: "0.3571428571428571"}, summary, "Modularity")
+			}
+		})
+	}
+}
+
+func TestLPA_MaxIterations(t *testing.T) {
+	// The labels of a bipartite graph swap forever
+	edges := []Edge{{Source: "a", Target: "b", Weight: 1}}
+	alg, _ := New("lpa", Params{"maxIterations": "3"})
+	res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), 1, engine.NewLoopback()), alg, edges, false)
+	if assert.NoError(t, err, "Run") {
+		assert.Equal(t, 5, res.Supersteps, "Supersteps")
+	}
+}
+
+func TestLouvainLocal(t *testing.T) {
+	edges := append(twoTriangles(), Edge{Source: "z"})
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			alg, _ := New("louvain-local", nil)
+			res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), partitions, engine.NewLoopback()), alg, edges, false)
+			if assert.NoError(t, err, "Run") {
+				assert.Equal(t, map[string]string{"a": "a", "b": "a", "c": "a", "d": "d", "e": "d", "f": "d", "z": "z"},
+					outputsOf(t, alg, res), "Communities")
+				summary, err := alg.Summary(res.Aggregated)
+				assert.NoError(t, err, "Summary")
+				assert.Equal(t, map[string]string{ModularityAggregator: "0.3571428571428571"}, summary, "Modularity")
+			}
+		})
+	}
+}
+
+func TestLouvainLocal_Params(t *testing.T) {
+	_, err := New("louvain-local", Params{"maxIterations": "0"})
+	assert.Error(t, err, "Max iterations")
+	_, err = New("louvain-local", Params{"tolerance": "-1"})
+	assert.Error(t, err, "Tolerance")
+}
+
+func TestCommunityCodecs(t *testing.T) {
+	m := communityMessage{Kind: neighborMessage, From: "a", Label: "b", Value: 3, Degree: 2}
+	r, err := codec.Encode[communityMessage](communityCodec{}, m)
+	if assert.NoError(t, err, "Encode message") {
+		d, err := codec.Decode[communityMessage](communityCodec{}, r)
+		assert.NoError(t, err, "Decode message")
+		assert.Equal(t, m, d, "Message round trip")
+	}
+	for i := 0; i < len(r); i++ {
+		_, err := codec.Decode[communityMessage](communityCodec{}, r[:i])
+		assert.Error(t, err, "Short message")
+	}
+
+	v := louvainVertex{Community: "a", Prev: "b", Best: "c", Degree: 1, Tot: 2, Owned: 3}
+	r, err = codec.Encode[louvainVertex](louvainCodec{}, v)
+	if assert.NoError(t, err, "Encode vertex") {
+		d, err := codec.Decode[louvainVertex](louvainCodec{}, r)
+		assert.NoError(t, err, "Decode vertex")
+		assert.Equal(t, v, d, "Vertex round trip")
+	}
+	for i := 0; i < len(r); i++ {
+		_, err := codec.Decode[louvainVertex](louvainCodec{}, r[:i])
+		assert.Error(t, err, "Short vertex")
+	}
+}
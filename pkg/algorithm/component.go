@@ -0,0 +1,255 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+)
+
+// WCC labels every vertex with the lowest vertex id of its weakly connected component.
+// The edges are followed in both directions and the labels are combined by the min
+func WCC(Params) (Algorithm, error) {
+	program := compute.Compute[string, struct{}, string](
+		func(ctx compute.Context[string, struct{}, string], messages []string) error {
+			label := ctx.Value()
+			if ctx.Superstep() == 0 {
+				label = ctx.ID()
+			}
+			for _, m := range messages {
+				label = minString(label, m)
+			}
+			if ctx.Superstep() == 0 || label < ctx.Value() {
+				ctx.SetValue(label)
+				ctx.SendToNeighbors(label)
+			}
+			ctx.VoteToHalt()
+			return nil
+		})
+
+	return &Definition[string, struct{}, string]{
+		Name:       "wcc",
+		Program:    program,
+		Codecs:     compute.Codecs[string, struct{}, string]{Vertex: codec.String{}, Edge: codec.Empty{}, Message: codec.String{}},
+		Combiner:   compute.Combiner[string]{Codec: codec.String{}, Combine: minString}.Raw(),
+		Undirected: true,
+		Init:       func(string) string { return "" },
+		Edge:       func(float64) struct{} { return struct{}{} },
+		Output:     func(v string) string { return v },
+	}, nil
+}
+
+func minString(a, b string) string {
+	if b < a {
+		return b
+	}
+	return a
+}
+
+// SCC phases. The master compute moves the vertices from one phase to the next one
+const (
+	// sccTranspose sends the id of every vertex to its out neighbors
+	sccTranspose int64 = iota
+	// sccForwardStart keeps the in neighbors and starts the forward coloring
+	sccForwardStart
+	// sccForward propagates the max color through the out edges
+	sccForward
+	// sccBackwardStart assigns the component of the vertices whose color is their id
+	sccBackwardStart
+	// sccBackward propagates the component through the in edges of the same color
+	sccBackward
+)
+
+// SCC aggregators
+const (
+	// PhaseAggregator is the current phase set by the master compute
+	PhaseAggregator = "phase"
+	// ChangedAggregator counts the vertices that have changed in a superstep
+	ChangedAggregator = "changed"
+	// UnassignedAggregator counts the vertices without component
+	UnassignedAggregator = "unassigned"
+)
+
+// sccVertex is the state of a vertex in the SCC coloring
+type sccVertex struct {
+	// Color is the max id that reaches the vertex in the forward phase
+	Color string
+	// Component is the id of the strongly connected component. It is empty until it is assigned
+	Component string
+	// In are the in neighbors without component
+	In []string
+}
+
+// sccCodec encodes the state of the SCC vertices
+type sccCodec struct{}
+
+func (sccCodec) Name() string { return "scc" }
+
+func (sccCodec) Append(dst []byte, v sccVertex) ([]byte, error) {
+	dst, _ = codec.String{}.Append(dst, v.Color)
+	dst, _ = codec.String{}.Append(dst, v.Component)
+	return codec.Slice[string]{Elem: codec.String{}}.Append(dst, v.In)
+}
+
+func (sccCodec) Decode(src []byte) (sccVertex, int, error) {
+	var v sccVertex
+	color, n, err := codec.String{}.Decode(src)
+	if err != nil {
+		return v, 0, err
+	}
+	component, m, err := codec.String{}.Decode(src[n:])
+	if err != nil {
+		return v, 0, err
+	}
+	n += m
+	in, m, err := codec.Slice[string]{Elem: codec.String{}}.Decode(src[n:])
+	if err != nil {
+		return v, 0, err
+	}
+	return sccVertex{Color: color, Component: component, In: in}, n + m, nil
+}
+
+// SCC labels every vertex with the highest vertex id of its strongly connected component.
+// It repeats the forward and backward coloring over the vertices without component:
+// the max color is propagated forward and every vertex whose color is its id is the root
+// of a component that is propagated backward through the vertices of the same color
+func SCC(Params) (Algorithm, error) {
+	phase := compute.Aggregator[int64]{Key: PhaseAggregator, Codec: codec.Int64{}, Reduce: maxInt64, Persistent: true}
+	changed := compute.SumInt64(ChangedAggregator)
+	unassigned := compute.SumInt64(UnassignedAggregator)
+
+	program := compute.Compute[sccVertex, struct{}, string](
+		func(ctx compute.Context[sccVertex, struct{}, string], messages []string) error {
+			v := ctx.Value()
+			if len(v.Component) > 0 {
+				ctx.VoteToHalt()
+				return nil
+			}
+			ph, err := phase.Value(ctx)
+			if err != nil {
+				return err
+			}
+
+			change := false
+			switch ph {
+			case sccTranspose:
+				v = sccVertex{Color: ctx.ID()}
+				for _, e := range ctx.Edges() {
+					ctx.Send(e.Target, ctx.ID())
+				}
+			case sccForwardStart:
+				v.In = messages
+				change = true
+				ctx.SendToNeighbors(v.Color)
+			case sccForward:
+				max := v.Color
+				for _, m := range messages {
+					if m > max {
+						max = m
+					}
+				}
+				if max != v.Color {
+					v.Color = max
+					change = true
+					ctx.SendToNeighbors(max)
+				}
+			case sccBackwardStart:
+				if v.Color == ctx.ID() {
+					v.Component = v.Color
+				}
+			case sccBackward:
+				for _, m := range messages {
+					if m == v.Color {
+						v.Component = v.Color
+						break
+					}
+				}
+			}
+
+			if len(v.Component) > 0 {
+				change = true
+				for _, in := range v.In {
+					ctx.Send(in, v.Component)
+				}
+			} else if err := unassigned.Aggregate(ctx, 1); err != nil {
+				return err
+			}
+			if change {
+				if err := changed.Aggregate(ctx, 1); err != nil {
+					return err
+				}
+			}
+			ctx.SetValue(v)
+			return nil
+		})
+
+	master := compute.MasterCompute(func(ctx compute.MasterContext) error {
+		if ctx.Superstep() == 0 {
+			return phase.Set(ctx, sccTranspose)
+		}
+		ph, err := phase.Value(ctx)
+		if err != nil {
+			return err
+		}
+		c, err := changed.Value(ctx)
+		if err != nil {
+			return err
+		}
+		u, err := unassigned.Value(ctx)
+		if err != nil {
+			return err
+		}
+
+		next := ph
+		switch {
+		case ph == sccTranspose:
+			next = sccForwardStart
+		case ph == sccForwardStart || ph == sccForward:
+			next = sccForward
+			if c == 0 {
+				next = sccBackwardStart
+			}
+		case c > 0:
+			next = sccBackward
+		case u > 0:
+			next = sccTranspose
+		default:
+			ctx.Halt()
+			return nil
+		}
+		return phase.Set(ctx, next)
+	})
+
+	return &Definition[sccVertex, struct{}, string]{
+		Name:        "scc",
+		Program:     program,
+		Codecs:      compute.Codecs[sccVertex, struct{}, string]{Vertex: sccCodec{}, Edge: codec.Empty{}, Message: codec.String{}},
+		Master:      master,
+		Aggregators: []compute.RawAggregator{phase.Raw(), changed.Raw(), unassigned.Raw()},
+		Init:        func(string) sccVertex { return sccVertex{} },
+		Edge:        func(float64) struct{} { return struct{}{} },
+		Output:      func(v sccVertex) string { return v.Component },
+	}, nil
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
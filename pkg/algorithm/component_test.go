@@ -0,0 +1,94 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWCC(t *testing.T) {
+	edges := []Edge{
+		{Source: "d", Target: "c"},
+		{Source: "b", Target: "c"},
+		{Source: "x", Target: "y"},
+		{Source: "z"},
+	}
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			alg, _ := New("wcc", nil)
+			res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), partitions, engine.NewLoopback()), alg, edges, false)
+			if assert.NoError(t, err, "Run") {
+				assert.Equal(t, map[string]string{"b": "b", "c": "b", "d": "b", "x": "x", "y": "x", "z": "z"},
+					outputsOf(t, alg, res), "Components")
+			}
+		})
+	}
+}
+
+func TestSCC(t *testing.T) {
+	edges := []Edge{
+		{Source: "a", Target: "b"},
+		{Source: "b", Target: "c"},
+		{Source: "c", Target: "a"},
+		{Source: "c", Target: "d"},
+		{Source: "d", Target: "e"},
+		{Source: "e", Target: "d"},
+		{Source: "e", Target: "f"},
+		{Source: "g", Target: "a"},
+	}
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			alg, _ := New("scc", nil)
+			res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), partitions, engine.NewLoopback()), alg, edges, false)
+			if assert.NoError(t, err, "Run") {
+				assert.Equal(t, map[string]string{"a": "c", "b": "c", "c": "c", "d": "e", "e": "e", "f": "f", "g": "g"},
+					outputsOf(t, alg, res), "Components")
+			}
+		})
+	}
+}
+
+func TestSCCCodec(t *testing.T) {
+	v := sccVertex{Color: "c", Component: "d", In: []string{"a", "b"}}
+	r, err := codec.Encode[sccVertex](sccCodec{}, v)
+	if assert.NoError(t, err, "Encode") {
+		d, err := codec.Decode[sccVertex](sccCodec{}, r)
+		assert.NoError(t, err, "Decode")
+		assert.Equal(t, v, d, "Round trip")
+	}
+	for i := 0; i < len(r); i++ {
+		_, err = codec.Decode[sccVertex](sccCodec{}, r[:i])
+		assert.Error(t, err, i)
+	}
+}
+
+func outputsOf(t *testing.T, alg Algorithm, res engine.Result) map[string]string {
+	out := make(map[string]string, len(res.Vertices))
+	for _, v := range res.Vertices {
+		o, err := alg.Format(v.Value)
+		assert.NoError(t, err, "Format")
+		out[v.ID] = o
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/pkg/errors"
+)
+
+// PageRank aggregators
+const (
+	// DanglingAggregator sums the rank of the vertices without out edges. It is spread over every vertex
+	DanglingAggregator = "dangling"
+	// DeltaAggregator sums the change of the ranks in a superstep
+	DeltaAggregator = "delta"
+)
+
+// PageRank ranks the vertices by the rank of the vertices that link to them.
+// The params are:
+//   - damping: the probability of following a link. Common value: 0.85
+//   - maxIterations: the max number of rank updates. Common value: 30
+//   - tolerance: the job ends when the sum of the rank changes is lower. Common value: 0.000001
+func PageRank(p Params) (Algorithm, error) {
+	damping, err := p.Float("damping", 0.85)
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := p.Int("maxIterations", 30)
+	if err != nil {
+		return nil, err
+	}
+	tolerance, err := p.Float("tolerance", 0.000001)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case damping <= 0 || damping >= 1:
+		return nil, errors.New("the damping must be between 0 and 1")
+	case iterations <= 0:
+		return nil, errors.New("the max iterations must be greater than 0")
+	case tolerance < 0:
+		return nil, errors.New("the tolerance cannot be negative")
+	}
+
+	dangling := compute.SumFloat64(DanglingAggregator)
+	delta := compute.SumFloat64(DeltaAggregator)
+
+	program := compute.Compute[float64, struct{}, float64](
+		func(ctx compute.Context[float64, struct{}, float64], messages []float64) error {
+			n := float64(ctx.Vertices())
+			rank := 1 / n
+			if ctx.Superstep() > 0 {
+				lost, err := dangling.Value(ctx)
+				if err != nil {
+					return err
+				}
+				sum := 0.0
+				for _, m := range messages {
+					sum += m
+				}
+				rank = (1-damping)/n + damping*(sum+lost/n)
+				if err := delta.Aggregate(ctx, math.Abs(rank-ctx.Value())); err != nil {
+					return err
+				}
+			}
+			ctx.SetValue(rank)
+
+			edges := ctx.Edges()
+			if len(edges) == 0 {
+				return dangling.Aggregate(ctx, rank)
+			}
+			ctx.SendToNeighbors(rank / float64(len(edges)))
+			return nil
+		})
+
+	// The ranks are updated from the superstep 1, so the delta is known from the superstep 2
+	master := compute.MasterCompute(func(ctx compute.MasterContext) error {
+		if ctx.Superstep() > iterations {
+			ctx.Halt()
+			return nil
+		}
+		if ctx.Superstep() < 2 {
+			return nil
+		}
+		d, err := delta.Value(ctx)
+		if err != nil {
+			return err
+		}
+		if d < tolerance {
+			ctx.Halt()
+		}
+		return nil
+	})
+
+	return &Definition[float64, struct{}, float64]{
+		Name:        "pagerank",
+		Program:     program,
+		Codecs:      compute.Codecs[float64, struct{}, float64]{Vertex: codec.Float64{}, Edge: codec.Empty{}, Message: codec.Float64{}},
+		Master:      master,
+		Aggregators: []compute.RawAggregator{dangling.Raw(), delta.Raw()},
+		Reported:    []string{DeltaAggregator},
+		Init:        func(string) float64 { return 0 },
+		Edge:        func(float64) struct{} { return struct{}{} },
+		Output:      formatFloat,
+	}, nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,100 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageRank(t *testing.T) {
+	edges := []Edge{
+		{Source: "a", Target: "b"},
+		{Source: "a", Target: "c"},
+		{Source: "b", Target: "c"},
+		{Source: "c", Target: "a"},
+		{Source: "d"},
+	}
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			alg, err := New("pagerank", Params{"maxIterations": "100", "tolerance": "0.0000001"})
+			if !assert.NoError(t, err, "New") {
+				return
+			}
+			e := engine.New(log.TestLogger(), partitions, engine.NewLoopback())
+			res, err := Run(make(chan struct{}), e, alg, edges, false)
+			if !assert.NoError(t, err, "Run") {
+				return
+			}
+
+			ranks := ranksOf(t, res)
+			expected := map[string]float64{"a": 0.3693, "b": 0.2046, "c": 0.3785, "d": 0.0476}
+			sum := 0.0
+			for id, r := range ranks {
+				assert.InDelta(t, expected[id], r, 0.0001, id)
+				sum += r
+			}
+			assert.InDelta(t, 1, sum, 0.000001, "The dangling rank is not lost")
+			assert.Less(t, res.Supersteps, 100, "Converged")
+
+			summary, err := alg.Summary(res.Aggregated)
+			if assert.NoError(t, err, "Summary") {
+				d, _ := strconv.ParseFloat(summary[DeltaAggregator], 64)
+				assert.Less(t, d, 0.0000001, "Delta")
+			}
+		})
+	}
+}
+
+func TestPageRank_MaxIterations(t *testing.T) {
+	alg, _ := PageRank(Params{"maxIterations": "2", "tolerance": "0"})
+	e := engine.New(log.TestLogger(), 1, engine.NewLoopback())
+	res, err := Run(make(chan struct{}), e, alg, []Edge{{Source: "a", Target: "b"}}, false)
+	if assert.NoError(t, err, "Run") {
+		assert.Equal(t, 3, res.Supersteps, "Initial superstep and two iterations")
+	}
+}
+
+func TestPageRank_Params(t *testing.T) {
+	for _, p := range []Params{
+		{"damping": "1"},
+		{"damping": "0"},
+		{"maxIterations": "0"},
+		{"tolerance": "-1"},
+		{"maxIterations": "x"},
+		{"tolerance": "x"},
+	} {
+		_, err := PageRank(p)
+		assert.Error(t, err, p)
+	}
+}
+
+func ranksOf(t *testing.T, res engine.Result) map[string]float64 {
+	ranks := make(map[string]float64, len(res.Vertices))
+	for _, v := range res.Vertices {
+		r, err := codec.Decode[float64](codec.Float64{}, v.Value)
+		assert.NoError(t, err, "Decode")
+		ranks[v.ID] = r
+	}
+	return ranks
+}
@@ -0,0 +1,146 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"math"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// Path is the shortest path to a vertex: the distance from the source and the previous vertex.
+// The distance of the vertices that are not reached is +Inf
+type Path struct {
+	Distance    float64
+	Predecessor string
+}
+
+// less orders the paths by distance and predecessor, so the ties are resolved in the same way on every run
+func (p Path) less(o Path) bool {
+	if p.Distance != o.Distance {
+		return p.Distance < o.Distance
+	}
+	return p.Predecessor < o.Predecessor
+}
+
+func (p Path) String() string {
+	pred := p.Predecessor
+	if len(pred) == 0 {
+		pred = "-"
+	}
+	return strings.Concat(formatFloat(p.Distance), "\t", pred)
+}
+
+// PathCodec encodes the paths as the float64 distance and the string predecessor
+type PathCodec struct{}
+
+// Name returns path
+func (PathCodec) Name() string { return "path" }
+
+// Append appends the distance and the predecessor
+func (PathCodec) Append(dst []byte, v Path) ([]byte, error) {
+	dst, _ = codec.Float64{}.Append(dst, v.Distance)
+	return codec.String{}.Append(dst, v.Predecessor)
+}
+
+// Decode reads the distance and the predecessor
+func (PathCodec) Decode(src []byte) (Path, int, error) {
+	d, n, err := codec.Float64{}.Decode(src)
+	if err != nil {
+		return Path{}, 0, err
+	}
+	pred, m, err := codec.String{}.Decode(src[n:])
+	if err != nil {
+		return Path{}, 0, err
+	}
+	return Path{Distance: d, Predecessor: pred}, n + m, nil
+}
+
+// minPath keeps the shortest path
+func minPath(a, b Path) Path {
+	if b.less(a) {
+		return b
+	}
+	return a
+}
+
+// SSSP computes the single-source shortest paths over the weighted edges.
+// The weights cannot be negative. The params are:
+//   - source: the id of the source vertex. It is required
+func SSSP(p Params) (Algorithm, error) {
+	weight := func(w float64) float64 { return w }
+	return shortestPaths[float64](p, "sssp", codec.Float64{}, weight, weight)
+}
+
+// BFS computes the number of hops from the source vertex with a breadth-first search.
+// The edge weights are ignored. The params are:
+//   - source: the id of the source vertex. It is required
+func BFS(p Params) (Algorithm, error) {
+	return shortestPaths[struct{}](p, "bfs", codec.Empty{},
+		func(float64) struct{} { return struct{}{} },
+		func(struct{}) float64 { return 1 })
+}
+
+// shortestPaths relaxes the distances from the source. The messages to a vertex are combined
+// into the shortest one. The edge converts the input weight and the weight returns the length of the edge
+func shortestPaths[E any](p Params, name string, ec codec.Codec[E], edge func(float64) E, weight func(E) float64) (Algorithm, error) {
+	source := p.String("source", "")
+	if len(source) == 0 {
+		return nil, errors.New("the source vertex cannot be empty")
+	}
+
+	program := compute.Compute[Path, E, Path](func(ctx compute.Context[Path, E, Path], messages []Path) error {
+		best := ctx.Value()
+		if ctx.Superstep() == 0 && ctx.ID() == source {
+			best = Path{}
+		}
+		for _, m := range messages {
+			best = minPath(best, m)
+		}
+		if !best.less(ctx.Value()) {
+			ctx.VoteToHalt()
+			return nil
+		}
+
+		ctx.SetValue(best)
+		for _, e := range ctx.Edges() {
+			w := weight(e.Value)
+			if w < 0 {
+				return errors.New(strings.Concat("the edge weight cannot be negative. Target: ", e.Target))
+			}
+			ctx.Send(e.Target, Path{Distance: best.Distance + w, Predecessor: ctx.ID()})
+		}
+		ctx.VoteToHalt()
+		return nil
+	})
+
+	codecs := compute.Codecs[Path, E, Path]{Vertex: PathCodec{}, Edge: ec, Message: PathCodec{}}
+	return &Definition[Path, E, Path]{
+		Name:     name,
+		Program:  program,
+		Codecs:   codecs,
+		Combiner: compute.Combiner[Path]{Codec: PathCodec{}, Combine: minPath}.Raw(),
+		Required: []string{source},
+		Init:     func(string) Path { return Path{Distance: math.Inf(1)} },
+		Edge:     edge,
+		Output:   Path.String,
+	}, nil
+}
@@ -0,0 +1,117 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSSP(t *testing.T) {
+	edges := []Edge{
+		{Source: "s", Target: "a", Weight: 4},
+		{Source: "s", Target: "b", Weight: 1},
+		{Source: "b", Target: "a", Weight: 2},
+		{Source: "a", Target: "c", Weight: 1},
+		{Source: "b", Target: "c", Weight: 4},
+		{Source: "d", Target: "s", Weight: 1},
+	}
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			alg, err := New("sssp", Params{"source": "s"})
+			if !assert.NoError(t, err, "New") {
+				return
+			}
+			res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), partitions, engine.NewLoopback()), alg, edges, false)
+			if assert.NoError(t, err, "Run") {
+				paths := pathsOf(t, res)
+				assert.Equal(t, Path{Distance: 0}, paths["s"], "Source")
+				assert.Equal(t, Path{Distance: 1, Predecessor: "s"}, paths["b"], "b")
+				assert.Equal(t, Path{Distance: 3, Predecessor: "b"}, paths["a"], "a")
+				// The paths through a and b have the same distance. The lowest predecessor wins
+				assert.Equal(t, Path{Distance: 4, Predecessor: "a"}, paths["c"], "c")
+				assert.True(t, math.IsInf(paths["d"].Distance, 1), "Not reached")
+			}
+		})
+	}
+}
+
+func TestBFS(t *testing.T) {
+	edges := []Edge{
+		{Source: "s", Target: "a", Weight: 4},
+		{Source: "a", Target: "b", Weight: 0.5},
+		{Source: "s", Target: "c", Weight: 9},
+		{Source: "c", Target: "b", Weight: 9},
+	}
+	alg, _ := New("bfs", Params{"source": "s"})
+	res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), 2, engine.NewLoopback()), alg, edges, false)
+	if assert.NoError(t, err, "Run") {
+		paths := pathsOf(t, res)
+		assert.Equal(t, Path{Distance: 1, Predecessor: "s"}, paths["c"], "c")
+		assert.Equal(t, Path{Distance: 2, Predecessor: "a"}, paths["b"], "b")
+
+		out, _ := alg.Format(res.Vertices[len(res.Vertices)-1].Value)
+		assert.Equal(t, "0\t-", out, "Source output")
+	}
+}
+
+func TestSSSP_Errors(t *testing.T) {
+	_, err := New("sssp", nil)
+	assert.Error(t, err, "Source required")
+	_, err = New("bfs", nil)
+	assert.Error(t, err, "Source required")
+
+	alg, _ := New("sssp", Params{"source": "s"})
+	_, err = Run(make(chan struct{}), engine.New(log.TestLogger(), 1, engine.NewLoopback()), alg,
+		[]Edge{{Source: "s", Target: "a", Weight: -1}}, false)
+	assert.Error(t, err, "Negative weight")
+
+	_, err = alg.Vertices([]Edge{{Source: "a", Target: "b", Weight: 1}}, false)
+	assert.Error(t, err, "Source not in the graph")
+}
+
+func TestPathCodec(t *testing.T) {
+	for _, p := range []Path{{}, {Distance: math.Inf(1)}, {Distance: 2.5, Predecessor: "v"}} {
+		r, err := codec.Encode[Path](PathCodec{}, p)
+		if assert.NoError(t, err, "Encode") {
+			d, err := codec.Decode[Path](PathCodec{}, r)
+			assert.NoError(t, err, "Decode")
+			assert.Equal(t, p, d, "Round trip")
+		}
+	}
+	_, err := codec.Decode[Path](PathCodec{}, []byte{1})
+	assert.Error(t, err, "Short distance")
+	_, err = codec.Decode[Path](PathCodec{}, make([]byte, 8))
+	assert.Error(t, err, "Short predecessor")
+}
+
+func pathsOf(t *testing.T, res engine.Result) map[string]Path {
+	paths := make(map[string]Path, len(res.Vertices))
+	for _, v := range res.Vertices {
+		p, err := codec.Decode[Path](PathCodec{}, v.Value)
+		assert.NoError(t, err, "Decode")
+		paths[v.ID] = p
+	}
+	return paths
+}
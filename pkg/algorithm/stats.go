@@ -0,0 +1,473 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"sort"
+	"strconv"
+	stds "strings"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/strings"
+)
+
+// Stats and k-core aggregators
+const (
+	// VerticesAggregator is the number of vertices
+	VerticesAggregator = "vertices"
+	// EdgesAggregator is the number of edges
+	EdgesAggregator = "edges"
+	// InDegreesAggregator is the distribution of the in degrees
+	InDegreesAggregator = "inDegrees"
+	// OutDegreesAggregator is the distribution of the out degrees
+	OutDegreesAggregator = "outDegrees"
+	// MaxInDegreeAggregator is the max in degree
+	MaxInDegreeAggregator = "maxInDegree"
+	// MaxOutDegreeAggregator is the max out degree
+	MaxOutDegreeAggregator = "maxOutDegree"
+	// PartitionsAggregator are the stats of every partition
+	PartitionsAggregator = "partitions"
+	// CoresAggregator is the distribution of the core numbers
+	CoresAggregator = "cores"
+	// DegeneracyAggregator is the max core number
+	DegeneracyAggregator = "degeneracy"
+)
+
+// Histogram is the number of vertices by value
+type Histogram map[int64]int64
+
+// Merge returns the sum of the histograms without the values of count 0
+func (h Histogram) Merge(o Histogram) Histogram {
+	res := make(Histogram, len(h)+len(o))
+	for _, m := range []Histogram{h, o} {
+		for v, c := range m {
+			if res[v] += c; res[v] == 0 {
+				delete(res, v)
+			}
+		}
+	}
+	return res
+}
+
+// Max returns the max value. It is 0 when the histogram is empty
+func (h Histogram) Max() int64 {
+	max := int64(0)
+	for v := range h {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// String returns the value:count pairs sorted by value
+func (h Histogram) String() string {
+	vs := make([]int64, 0, len(h))
+	for v := range h {
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool { return vs[i] < vs[j] })
+	pairs := make([]string, len(vs))
+	for i, v := range vs {
+		pairs[i] = strings.Concat(strconv.FormatInt(v, 10), ":", strconv.FormatInt(h[v], 10))
+	}
+	return stds.Join(pairs, " ")
+}
+
+// histogramCodec encodes the histograms as pairs sorted by value, so the encoding is deterministic
+type histogramCodec struct{}
+
+func (histogramCodec) Name() string { return "histogram" }
+
+func (histogramCodec) Append(dst []byte, h Histogram) ([]byte, error) {
+	vs := make([]int64, 0, len(h))
+	for v := range h {
+		vs = append(vs, v)
+	}
+	sort.Slice(vs, func(i, j int) bool { return vs[i] < vs[j] })
+	dst, _ = codec.Int64{}.Append(dst, int64(len(vs)))
+	for _, v := range vs {
+		dst, _ = codec.Int64{}.Append(dst, v)
+		dst, _ = codec.Int64{}.Append(dst, h[v])
+	}
+	return dst, nil
+}
+
+func (histogramCodec) Decode(src []byte) (Histogram, int, error) {
+	l, n, err := codec.Int64{}.Decode(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	h := make(Histogram)
+	for i := int64(0); i < l; i++ {
+		v, m, err := codec.Int64{}.Decode(src[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+		n += m
+		c, m, err := codec.Int64{}.Decode(src[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+		n += m
+		h[v] = c
+	}
+	return h, n, nil
+}
+
+// GraphStats are the counts of the vertices of a partition
+type GraphStats struct {
+	Vertices     int64
+	Edges        int64
+	MaxInDegree  int64
+	MaxOutDegree int64
+}
+
+// PartitionStats are the stats by partition
+type PartitionStats map[int64]GraphStats
+
+// Merge returns the stats of both with the partitions in common merged
+func (p PartitionStats) Merge(o PartitionStats) PartitionStats {
+	res := make(PartitionStats, len(p)+len(o))
+	for _, m := range []PartitionStats{p, o} {
+		for id, s := range m {
+			r := res[id]
+			res[id] = GraphStats{
+				Vertices:     r.Vertices + s.Vertices,
+				Edges:        r.Edges + s.Edges,
+				MaxInDegree:  maxInt64(r.MaxInDegree, s.MaxInDegree),
+				MaxOutDegree: maxInt64(r.MaxOutDegree, s.MaxOutDegree),
+			}
+		}
+	}
+	return res
+}
+
+// String returns the stats sorted by partition
+func (p PartitionStats) String() string {
+	ids := make([]int64, 0, len(p))
+	for id := range p {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		s := p[id]
+		parts[i] = strings.Concat(strconv.FormatInt(id, 10),
+			":{vertices=", strconv.FormatInt(s.Vertices, 10),
+			" edges=", strconv.FormatInt(s.Edges, 10),
+			" maxInDegree=", strconv.FormatInt(s.MaxInDegree, 10),
+			" maxOutDegree=", strconv.FormatInt(s.MaxOutDegree, 10), "}")
+	}
+	return stds.Join(parts, " ")
+}
+
+// partitionStatsCodec encodes the stats sorted by partition
+type partitionStatsCodec struct{}
+
+func (partitionStatsCodec) Name() string { return "partition-stats" }
+
+func (partitionStatsCodec) Append(dst []byte, p PartitionStats) ([]byte, error) {
+	ids := make([]int64, 0, len(p))
+	for id := range p {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	dst, _ = codec.Int64{}.Append(dst, int64(len(ids)))
+	for _, id := range ids {
+		s := p[id]
+		for _, v := range []int64{id, s.Vertices, s.Edges, s.MaxInDegree, s.MaxOutDegree} {
+			dst, _ = codec.Int64{}.Append(dst, v)
+		}
+	}
+	return dst, nil
+}
+
+func (partitionStatsCodec) Decode(src []byte) (PartitionStats, int, error) {
+	l, n, err := codec.Int64{}.Decode(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	p := make(PartitionStats)
+	for i := int64(0); i < l; i++ {
+		var id int64
+		var s GraphStats
+		for _, v := range []*int64{&id, &s.Vertices, &s.Edges, &s.MaxInDegree, &s.MaxOutDegree} {
+			d, m, err := codec.Int64{}.Decode(src[n:])
+			if err != nil {
+				return nil, 0, err
+			}
+			*v = d
+			n += m
+		}
+		p[id] = s
+	}
+	return p, n, nil
+}
+
+// degrees are the in and out degrees of a vertex
+type degrees struct {
+	In  int64
+	Out int64
+}
+
+// degreesCodec encodes the degrees
+type degreesCodec struct{}
+
+func (degreesCodec) Name() string { return "degrees" }
+
+func (degreesCodec) Append(dst []byte, d degrees) ([]byte, error) {
+	dst, _ = codec.Int64{}.Append(dst, d.In)
+	return codec.Int64{}.Append(dst, d.Out)
+}
+
+func (degreesCodec) Decode(src []byte) (degrees, int, error) {
+	in, n, err := codec.Int64{}.Decode(src)
+	if err != nil {
+		return degrees{}, 0, err
+	}
+	out, m, err := codec.Int64{}.Decode(src[n:])
+	if err != nil {
+		return degrees{}, 0, err
+	}
+	return degrees{In: in, Out: out}, n + m, nil
+}
+
+// Stats counts the vertices and the edges with the distribution of the in and out degrees
+// and the max degrees of the graph and of every partition. The output of every vertex is its
+// in and out degree separated by a tab. The counts are reported in the summary
+func Stats(Params) (Algorithm, error) {
+	sum := func(a, b int64) int64 { return a + b }
+	vertices := compute.SumInt64(VerticesAggregator)
+	edges := compute.SumInt64(EdgesAggregator)
+	inDegrees := compute.Aggregator[Histogram]{Key: InDegreesAggregator, Codec: histogramCodec{}, Zero: Histogram{}, Reduce: Histogram.Merge}
+	outDegrees := compute.Aggregator[Histogram]{Key: OutDegreesAggregator, Codec: histogramCodec{}, Zero: Histogram{}, Reduce: Histogram.Merge}
+	maxIn := compute.Aggregator[int64]{Key: MaxInDegreeAggregator, Codec: codec.Int64{}, Reduce: maxInt64}
+	maxOut := compute.Aggregator[int64]{Key: MaxOutDegreeAggregator, Codec: codec.Int64{}, Reduce: maxInt64}
+	partitions := compute.Aggregator[PartitionStats]{Key: PartitionsAggregator, Codec: partitionStatsCodec{}, Zero: PartitionStats{},
+		Reduce: PartitionStats.Merge}
+
+	// The in degree is known in the second superstep, so every vertex is counted then
+	program := compute.Compute[degrees, struct{}, int64](
+		func(ctx compute.Context[degrees, struct{}, int64], messages []int64) error {
+			if ctx.Superstep() == 0 {
+				ctx.SendToNeighbors(1)
+				return nil
+			}
+			d := degrees{Out: int64(len(ctx.Edges()))}
+			for _, m := range messages {
+				d.In += m
+			}
+			ctx.SetValue(d)
+			ctx.VoteToHalt()
+
+			if err := vertices.Aggregate(ctx, 1); err != nil {
+				return err
+			}
+			if err := edges.Aggregate(ctx, d.Out); err != nil {
+				return err
+			}
+			if err := inDegrees.Aggregate(ctx, Histogram{d.In: 1}); err != nil {
+				return err
+			}
+			if err := outDegrees.Aggregate(ctx, Histogram{d.Out: 1}); err != nil {
+				return err
+			}
+			if err := maxIn.Aggregate(ctx, d.In); err != nil {
+				return err
+			}
+			if err := maxOut.Aggregate(ctx, d.Out); err != nil {
+				return err
+			}
+			return partitions.Aggregate(ctx, PartitionStats{int64(ctx.Partition()): {
+				Vertices: 1, Edges: d.Out, MaxInDegree: d.In, MaxOutDegree: d.Out}})
+		})
+
+	return &Definition[degrees, struct{}, int64]{
+		Name:    "stats",
+		Program: program,
+		Codecs:  compute.Codecs[degrees, struct{}, int64]{Vertex: degreesCodec{}, Edge: codec.Empty{}, Message: codec.Int64{}},
+		Aggregators: []compute.RawAggregator{vertices.Raw(), edges.Raw(), inDegrees.Raw(), outDegrees.Raw(), maxIn.Raw(),
+			maxOut.Raw(), partitions.Raw()},
+		Combiner: compute.Combiner[int64]{Codec: codec.Int64{}, Combine: sum}.Raw(),
+		Reported: []string{VerticesAggregator, EdgesAggregator, InDegreesAggregator, OutDegreesAggregator,
+			MaxInDegreeAggregator, MaxOutDegreeAggregator, PartitionsAggregator},
+		Init: func(string) degrees { return degrees{} },
+		Edge: func(float64) struct{} { return struct{}{} },
+		Output: func(d degrees) string {
+			return strings.Concat(strconv.FormatInt(d.In, 10), "\t", strconv.FormatInt(d.Out, 10))
+		},
+	}, nil
+}
+
+// coreVertex is the state of a vertex in the k-core decomposition
+type coreVertex struct {
+	// Core is the estimate of the core number. It only decreases
+	Core int64
+	// Known are the last estimates of the neighbors by edge. The self loops are -1
+	Known []int64
+}
+
+// coreCodec encodes the state of the k-core vertices
+type coreCodec struct{}
+
+func (coreCodec) Name() string { return "core" }
+
+func (coreCodec) Append(dst []byte, v coreVertex) ([]byte, error) {
+	dst, _ = codec.Int64{}.Append(dst, v.Core)
+	return codec.Slice[int64]{Elem: codec.Int64{}}.Append(dst, v.Known)
+}
+
+func (coreCodec) Decode(src []byte) (coreVertex, int, error) {
+	core, n, err := codec.Int64{}.Decode(src)
+	if err != nil {
+		return coreVertex{}, 0, err
+	}
+	known, m, err := codec.Slice[int64]{Elem: codec.Int64{}}.Decode(src[n:])
+	if err != nil {
+		return coreVertex{}, 0, err
+	}
+	return coreVertex{Core: core, Known: known}, n + m, nil
+}
+
+// coreMessage is the estimate of the core number of a neighbor
+type coreMessage struct {
+	From string
+	Core int64
+}
+
+// coreMessageCodec encodes the estimates of the neighbors
+type coreMessageCodec struct{}
+
+func (coreMessageCodec) Name() string { return "core-message" }
+
+func (coreMessageCodec) Append(dst []byte, m coreMessage) ([]byte, error) {
+	dst, _ = codec.String{}.Append(dst, m.From)
+	return codec.Int64{}.Append(dst, m.Core)
+}
+
+func (coreMessageCodec) Decode(src []byte) (coreMessage, int, error) {
+	from, n, err := codec.String{}.Decode(src)
+	if err != nil {
+		return coreMessage{}, 0, err
+	}
+	core, m, err := codec.Int64{}.Decode(src[n:])
+	if err != nil {
+		return coreMessage{}, 0, err
+	}
+	return coreMessage{From: from, Core: core}, n + m, nil
+}
+
+// KCore returns the core number of every vertex: the max k of a k-core with the vertex.
+// A k-core is the max subgraph whose vertices have k neighbors at least in the subgraph.
+// The estimate of every vertex starts at its degree and it is lowered to the max k such that
+// k neighbors have an estimate of k at least, until no estimate changes. The edges are undirected.
+// The distribution of the core numbers and the degeneracy of the graph are reported in the summary
+func KCore(Params) (Algorithm, error) {
+	cores := compute.Aggregator[Histogram]{Key: CoresAggregator, Codec: histogramCodec{}, Zero: Histogram{}, Reduce: Histogram.Merge,
+		Persistent: true}
+	degeneracy := compute.Aggregator[int64]{Key: DegeneracyAggregator, Codec: codec.Int64{}, Reduce: maxInt64, Persistent: true}
+
+	program := compute.Compute[coreVertex, struct{}, coreMessage](
+		func(ctx compute.Context[coreVertex, struct{}, coreMessage], messages []coreMessage) error {
+			v := ctx.Value()
+			edges := ctx.Edges()
+			if ctx.Superstep() == 0 {
+				v.Known = make([]int64, len(edges))
+				for i, e := range edges {
+					if e.Target == ctx.ID() {
+						v.Known[i] = -1
+						continue
+					}
+					v.Core++
+				}
+				if err := cores.Aggregate(ctx, Histogram{v.Core: 1}); err != nil {
+					return err
+				}
+				ctx.SetValue(v)
+				ctx.SendToNeighbors(coreMessage{From: ctx.ID(), Core: v.Core})
+				ctx.VoteToHalt()
+				return nil
+			}
+
+			index := make(map[string]int, len(edges))
+			for i, e := range edges {
+				index[e.Target] = i
+			}
+			for _, m := range messages {
+				if i, ok := index[m.From]; ok && v.Known[i] >= 0 {
+					v.Known[i] = m.Core
+				}
+			}
+			if core := coreOf(v.Core, v.Known); core < v.Core {
+				if err := cores.Aggregate(ctx, Histogram{v.Core: -1, core: 1}); err != nil {
+					return err
+				}
+				v.Core = core
+				ctx.SendToNeighbors(coreMessage{From: ctx.ID(), Core: v.Core})
+			}
+			ctx.SetValue(v)
+			ctx.VoteToHalt()
+			return nil
+		})
+
+	// The estimates change in a superstep and the neighbors are notified, so the master
+	// computes the degeneracy before the next one
+	master := compute.MasterCompute(func(ctx compute.MasterContext) error {
+		h, err := cores.Value(ctx)
+		if err != nil {
+			return err
+		}
+		return degeneracy.Set(ctx, h.Max())
+	})
+
+	return &Definition[coreVertex, struct{}, coreMessage]{
+		Name:        "kcore",
+		Program:     program,
+		Codecs:      compute.Codecs[coreVertex, struct{}, coreMessage]{Vertex: coreCodec{}, Edge: codec.Empty{}, Message: coreMessageCodec{}},
+		Master:      master,
+		Aggregators: []compute.RawAggregator{cores.Raw(), degeneracy.Raw()},
+		Reported:    []string{CoresAggregator, DegeneracyAggregator},
+		Undirected:  true,
+		Init:        func(string) coreVertex { return coreVertex{} },
+		Edge:        func(float64) struct{} { return struct{}{} },
+		Output:      func(v coreVertex) string { return strconv.FormatInt(v.Core, 10) },
+	}, nil
+}
+
+// coreOf returns the max k up to the core such that k neighbors have an estimate of k at least
+func coreOf(core int64, known []int64) int64 {
+	counts := make([]int64, core+1)
+	for _, k := range known {
+		if k < 0 {
+			continue
+		}
+		if k > core {
+			k = core
+		}
+		counts[k]++
+	}
+	n := int64(0)
+	for k := core; k > 0; k-- {
+		if n += counts[k]; n >= k {
+			return k
+		}
+	}
+	return 0
+}
@@ -0,0 +1,142 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	edges := []Edge{
+		{Source: "a", Target: "b"},
+		{Source: "a", Target: "c"},
+		{Source: "b", Target: "c"},
+		{Source: "c", Target: "a"},
+		{Source: "d"},
+	}
+	alg, _ := New("stats", nil)
+	res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), 1, engine.NewLoopback()), alg, edges, false)
+	if assert.NoError(t, err, "Run") {
+		assert.Equal(t, map[string]string{"a": "1\t2", "b": "1\t1", "c": "2\t1", "d": "0\t0"}, outputsOf(t, alg, res), "Degrees")
+		summary, err := alg.Summary(res.Aggregated)
+		assert.NoError(t, err, "Summary")
+		assert.Equal(t, map[string]string{
+			VerticesAggregator:     "4",
+			EdgesAggregator:        "4",
+			InDegreesAggregator:    "0:1 1:2 2:1",
+			OutDegreesAggregator:   "0:1 1:2 2:1",
+			MaxInDegreeAggregator:  "2",
+			MaxOutDegreeAggregator: "2",
+			PartitionsAggregator:   "0:{vertices=4 edges=4 maxInDegree=2 maxOutDegree=2}",
+		}, summary, "Summary")
+	}
+
+	res, err = Run(make(chan struct{}), engine.New(log.TestLogger(), 3, engine.NewLoopback()), alg, edges, false)
+	if assert.NoError(t, err, "Run partitions") {
+		ps, err := codec.Decode[PartitionStats](partitionStatsCodec{}, res.Aggregated[PartitionsAggregator])
+		if assert.NoError(t, err, "Decode") {
+			vertices := make(map[int64]int64)
+			for _, id := range []string{"a", "b", "c", "d"} {
+				vertices[int64(engine.PartitionOf(id, 3))]++
+			}
+			for id, s := range ps {
+				assert.Equal(t, vertices[id], s.Vertices, strconv.FormatInt(id, 10))
+			}
+			assert.Len(t, ps, len(vertices), "Partitions")
+		}
+	}
+}
+
+func TestKCore(t *testing.T) {
+	edges := []Edge{
+		{Source: "a", Target: "b"},
+		{Source: "a", Target: "c"},
+		{Source: "a", Target: "d"},
+		{Source: "b", Target: "c"},
+		{Source: "b", Target: "d"},
+		{Source: "c", Target: "d"},
+		{Source: "e", Target: "a"},
+		{Source: "e", Target: "b"},
+		{Source: "e", Target: "e"},
+		{Source: "f", Target: "e"},
+		{Source: "g"},
+	}
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			alg, _ := New("kcore", nil)
+			res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), partitions, engine.NewLoopback()), alg, edges, false)
+			if assert.NoError(t, err, "Run") {
+				assert.Equal(t, map[string]string{"a": "3", "b": "3", "c": "3", "d": "3", "e": "2", "f": "1", "g": "0"},
+					outputsOf(t, alg, res), "Cores")
+				summary, err := alg.Summary(res.Aggregated)
+				assert.NoError(t, err, "Summary")
+				assert.Equal(t, map[string]string{CoresAggregator: "0:1 1:1 2:1 3:4", DegeneracyAggregator: "3"}, summary, "Summary")
+			}
+		})
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := Histogram{1: 2, 3: 1}.Merge(Histogram{3: -1, 0: 4})
+	assert.Equal(t, Histogram{0: 4, 1: 2}, h, "Merge")
+	assert.Equal(t, int64(1), h.Max(), "Max")
+	assert.Equal(t, "0:4 1:2", h.String(), "String")
+
+	r, err := codec.Encode[Histogram](histogramCodec{}, h)
+	if assert.NoError(t, err, "Encode") {
+		d, err := codec.Decode[Histogram](histogramCodec{}, r)
+		assert.NoError(t, err, "Decode")
+		assert.Equal(t, h, d, "Round trip")
+	}
+	for i := 0; i < len(r); i++ {
+		_, err := codec.Decode[Histogram](histogramCodec{}, r[:i])
+		assert.Error(t, err, "Short")
+	}
+}
+
+func TestStatsCodecs(t *testing.T) {
+	ps := PartitionStats{0: {Vertices: 1, Edges: 2, MaxInDegree: 3, MaxOutDegree: 4}, 2: {Vertices: 5}}
+	r, err := codec.Encode[PartitionStats](partitionStatsCodec{}, ps)
+	if assert.NoError(t, err, "Encode partitions") {
+		d, err := codec.Decode[PartitionStats](partitionStatsCodec{}, r)
+		assert.NoError(t, err, "Decode partitions")
+		assert.Equal(t, ps, d, "Partitions round trip")
+	}
+	for i := 0; i < len(r); i++ {
+		_, err := codec.Decode[PartitionStats](partitionStatsCodec{}, r[:i])
+		assert.Error(t, err, "Short partitions")
+	}
+
+	v := coreVertex{Core: 2, Known: []int64{-1, 3}}
+	r, err = codec.Encode[coreVertex](coreCodec{}, v)
+	if assert.NoError(t, err, "Encode core") {
+		d, err := codec.Decode[coreVertex](coreCodec{}, r)
+		assert.NoError(t, err, "Decode core")
+		assert.Equal(t, v, d, "Core round trip")
+	}
+	for i := 0; i < len(r); i++ {
+		_, err := codec.Decode[coreVertex](coreCodec{}, r[:i])
+		assert.Error(t, err, "Short core")
+	}
+}
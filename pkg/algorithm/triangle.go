@@ -0,0 +1,324 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/pkg/errors"
+)
+
+// Triangle aggregators
+const (
+	// TrianglesAggregator is the number of triangles of the graph
+	TrianglesAggregator = "triangles"
+	// WedgesAggregator is the number of paths of two edges of the graph
+	WedgesAggregator = "wedges"
+	// CoefficientAggregator is the global clustering coefficient
+	CoefficientAggregator = "coefficient"
+)
+
+const (
+	// rankMessage is the degree of a neighbor
+	rankMessage byte = iota
+	// listMessage are the neighbors of a lower vertex ranked above the target
+	listMessage
+	// foundMessage is the number of triangles found by another vertex of the triangles
+	foundMessage
+)
+
+// triangleMessage is a message of the triangle counting
+type triangleMessage struct {
+	Kind  byte
+	From  string
+	Count int64
+	IDs   []string
+}
+
+// triangleMessageCodec encodes the triangle messages
+type triangleMessageCodec struct{}
+
+func (triangleMessageCodec) Name() string { return "triangle-message" }
+
+func (triangleMessageCodec) Append(dst []byte, m triangleMessage) ([]byte, error) {
+	dst = append(dst, m.Kind)
+	dst, _ = codec.String{}.Append(dst, m.From)
+	dst, _ = codec.Int64{}.Append(dst, m.Count)
+	return codec.Slice[string]{Elem: codec.String{}}.Append(dst, m.IDs)
+}
+
+func (triangleMessageCodec) Decode(src []byte) (triangleMessage, int, error) {
+	var m triangleMessage
+	if len(src) == 0 {
+		return m, 0, codec.ErrShortBuffer
+	}
+	m.Kind = src[0]
+	n := 1
+	var err error
+	var l int
+	if m.From, l, err = (codec.String{}).Decode(src[n:]); err != nil {
+		return m, 0, err
+	}
+	n += l
+	if m.Count, l, err = (codec.Int64{}).Decode(src[n:]); err != nil {
+		return m, 0, err
+	}
+	n += l
+	if m.IDs, l, err = (codec.Slice[string]{Elem: codec.String{}}).Decode(src[n:]); err != nil {
+		return m, 0, err
+	}
+	return m, n + l, nil
+}
+
+// triangleVertex is the state of a vertex in the triangle counting
+type triangleVertex struct {
+	// Degree is the number of neighbors without the vertex itself
+	Degree int64
+	// Higher are the neighbors ranked above the vertex sorted by rank
+	Higher []string
+	// Next is the position of the next list to send: the target and the first neighbor of the list
+	Next [2]int64
+	// Triangles is the number of triangles of the vertex
+	Triangles int64
+}
+
+// triangleCodec encodes the state of the triangle vertices
+type triangleCodec struct{}
+
+func (triangleCodec) Name() string { return "triangle" }
+
+func (triangleCodec) Append(dst []byte, v triangleVertex) ([]byte, error) {
+	dst, _ = codec.Int64{}.Append(dst, v.Degree)
+	dst, _ = codec.Slice[string]{Elem: codec.String{}}.Append(dst, v.Higher)
+	dst, _ = codec.Int64{}.Append(dst, v.Next[0])
+	dst, _ = codec.Int64{}.Append(dst, v.Next[1])
+	return codec.Int64{}.Append(dst, v.Triangles)
+}
+
+func (triangleCodec) Decode(src []byte) (triangleVertex, int, error) {
+	var v triangleVertex
+	var err error
+	var n, l int
+	if v.Degree, l, err = (codec.Int64{}).Decode(src); err != nil {
+		return v, 0, err
+	}
+	n += l
+	if v.Higher, l, err = (codec.Slice[string]{Elem: codec.String{}}).Decode(src[n:]); err != nil {
+		return v, 0, err
+	}
+	n += l
+	for _, i := range []*int64{&v.Next[0], &v.Next[1], &v.Triangles} {
+		if *i, l, err = (codec.Int64{}).Decode(src[n:]); err != nil {
+			return v, 0, err
+		}
+		n += l
+	}
+	return v, n, nil
+}
+
+// Triangles counts the triangles of every vertex. The edges are undirected. The params are:
+//   - batch: the max number of neighbor ids sent by a vertex in a superstep. 0 is no limit. Common value: 1024
+//
+// The number of triangles of the graph is reported in the summary
+func Triangles(p Params) (Algorithm, error) {
+	d, err := triangles(p, "triangles", func(v triangleVertex) string { return strconv.FormatInt(v.Triangles, 10) })
+	if err != nil {
+		return nil, err
+	}
+	d.Reported = []string{TrianglesAggregator}
+	return d, nil
+}
+
+// Clustering returns the local clustering coefficient of every vertex: the fraction of the pairs
+// of neighbors that are connected. The edges are undirected. The params are the params of Triangles.
+// The global clustering coefficient is reported in the summary: 3 * triangles / wedges
+func Clustering(p Params) (Algorithm, error) {
+	d, err := triangles(p, "clustering", func(v triangleVertex) string {
+		if v.Degree < 2 {
+			return formatFloat(0)
+		}
+		return formatFloat(float64(2*v.Triangles) / float64(v.Degree*(v.Degree-1)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.Reported = []string{CoefficientAggregator, TrianglesAggregator}
+	return d, nil
+}
+
+// triangles counts every triangle once in its middle vertex by rank. The vertices are ranked by degree
+// and id, so every vertex sends to the higher neighbors the ids of the neighbors ranked above them.
+// The high degree vertices have few higher neighbors and the lists are split in batches of ids.
+// The middle vertex notifies the other two vertices of the triangle.
+// The lists are exchanged between the partitions of the engine. They do not cross workers:
+// the partitions of a job run in the process of the leader
+func triangles(p Params, name string, output func(v triangleVertex) string) (*Definition[triangleVertex, struct{}, triangleMessage], error) {
+	batch, err := p.Int("batch", 1024)
+	if err != nil {
+		return nil, err
+	}
+	if batch < 0 {
+		return nil, errors.New("the batch cannot be negative")
+	}
+
+	count := compute.SumInt64(TrianglesAggregator)
+	count.Persistent = true
+	wedges := compute.SumInt64(WedgesAggregator)
+	wedges.Persistent = true
+	coefficient := compute.Aggregator[float64]{Key: CoefficientAggregator, Codec: codec.Float64{}, Reduce: math.Max, Persistent: true}
+
+	program := compute.Compute[triangleVertex, struct{}, triangleMessage](
+		func(ctx compute.Context[triangleVertex, struct{}, triangleMessage], messages []triangleMessage) error {
+			v := ctx.Value()
+			switch ctx.Superstep() {
+			case 0:
+				v.Degree = int64(len(neighborsOf(ctx.ID(), ctx.Edges())))
+				if err := wedges.Aggregate(ctx, v.Degree*(v.Degree-1)/2); err != nil {
+					return err
+				}
+				ctx.SendToNeighbors(triangleMessage{Kind: rankMessage, From: ctx.ID(), Count: v.Degree})
+				ctx.SetValue(v)
+				return nil
+			case 1:
+				v.Higher = higherOf(ctx.ID(), v.Degree, messages)
+				v.Next = [2]int64{0, 1}
+			}
+
+			var neighbors map[string]bool
+			found := make(map[string]int64)
+			for _, m := range messages {
+				switch m.Kind {
+				case foundMessage:
+					v.Triangles += m.Count
+				case listMessage:
+					if neighbors == nil {
+						neighbors = neighborsOf(ctx.ID(), ctx.Edges())
+					}
+					for _, id := range m.IDs {
+						if neighbors[id] {
+							v.Triangles++
+							found[m.From]++
+							found[id]++
+						}
+					}
+				}
+			}
+			n := int64(0)
+			for id, c := range found {
+				ctx.Send(id, triangleMessage{Kind: foundMessage, Count: c})
+				n += c
+			}
+			if err := count.Aggregate(ctx, n/2); err != nil {
+				return err
+			}
+
+			v.Next = sendLists(ctx, v.Higher, v.Next, batch)
+			if v.Next[0] >= int64(len(v.Higher)) {
+				ctx.VoteToHalt()
+			}
+			ctx.SetValue(v)
+			return nil
+		})
+
+	master := compute.MasterCompute(func(ctx compute.MasterContext) error {
+		t, err := count.Value(ctx)
+		if err != nil {
+			return err
+		}
+		w, err := wedges.Value(ctx)
+		if err != nil || w == 0 {
+			return err
+		}
+		return coefficient.Set(ctx, float64(3*t)/float64(w))
+	})
+
+	return &Definition[triangleVertex, struct{}, triangleMessage]{
+		Name:        name,
+		Program:     program,
+		Codecs:      compute.Codecs[triangleVertex, struct{}, triangleMessage]{Vertex: triangleCodec{}, Edge: codec.Empty{}, Message: triangleMessageCodec{}},
+		Master:      master,
+		Aggregators: []compute.RawAggregator{count.Raw(), wedges.Raw(), coefficient.Raw()},
+		Undirected:  true,
+		Init:        func(string) triangleVertex { return triangleVertex{} },
+		Edge:        func(float64) struct{} { return struct{}{} },
+		Output:      output,
+	}, nil
+}
+
+// neighborsOf returns the targets of the edges without the vertex itself
+func neighborsOf(id string, edges []compute.Edge[struct{}]) map[string]bool {
+	ns := make(map[string]bool, len(edges))
+	for _, e := range edges {
+		if e.Target != id {
+			ns[e.Target] = true
+		}
+	}
+	return ns
+}
+
+// higherOf returns the neighbors ranked above the vertex sorted by rank.
+// The rank is the degree and the id breaks the ties
+func higherOf(id string, degree int64, messages []triangleMessage) []string {
+	type rank struct {
+		id     string
+		degree int64
+	}
+	less := func(a, b rank) bool {
+		return a.degree < b.degree || (a.degree == b.degree && a.id < b.id)
+	}
+	own := rank{id: id, degree: degree}
+	var rs []rank
+	for _, m := range messages {
+		if r := (rank{id: m.From, degree: m.Count}); m.Kind == rankMessage && less(own, r) {
+			rs = append(rs, r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return less(rs[i], rs[j]) })
+	higher := make([]string, len(rs))
+	for i, r := range rs {
+		higher[i] = r.id
+	}
+	return higher
+}
+
+// sendLists sends to every higher neighbor the neighbors ranked above it from the position.
+// It sends batch ids at most and returns the next position
+func sendLists(ctx compute.Context[triangleVertex, struct{}, triangleMessage], higher []string, next [2]int64, batch int) [2]int64 {
+	size := int64(len(higher))
+	budget := int64(batch)
+	for next[0] < size && (batch == 0 || budget > 0) {
+		end := size
+		if batch > 0 && next[1]+budget < end {
+			end = next[1] + budget
+		}
+		if next[1] < end {
+			ctx.Send(higher[next[0]], triangleMessage{Kind: listMessage, From: ctx.ID(), IDs: higher[next[1]:end]})
+			budget -= end - next[1]
+		}
+		next[1] = end
+		if next[1] >= size {
+			next[0]++
+			next[1] = next[0] + 1
+		}
+	}
+	return next
+}
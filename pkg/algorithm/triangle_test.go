@@ -0,0 +1,104 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package algorithm
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/engine"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// twoTrianglesSharingAnEdge are the triangles a-b-c and a-c-d with the edge d-e
+func twoTrianglesSharingAnEdge() []Edge {
+	return []Edge{
+		{Source: "a", Target: "b"},
+		{Source: "b", Target: "c"},
+		{Source: "c", Target: "a"},
+		{Source: "c", Target: "d"},
+		{Source: "d", Target: "a"},
+		{Source: "d", Target: "e"},
+		{Source: "e", Target: "e"},
+	}
+}
+
+func TestTriangles(t *testing.T) {
+	for _, partitions := range []int{1, 3} {
+		for _, batch := range []string{"0", "1"} {
+			t.Run(strconv.Itoa(partitions)+"/"+batch, func(t *testing.T) {
+				alg, _ := New("triangles", Params{"batch": batch})
+				res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), partitions, engine.NewLoopback()), alg,
+					twoTrianglesSharingAnEdge(), false)
+				if assert.NoError(t, err, "Run") {
+					assert.Equal(t, map[string]string{"a": "2", "b": "1", "c": "2", "d": "1", "e": "0"},
+						outputsOf(t, alg, res), "Triangles")
+					summary, err := alg.Summary(res.Aggregated)
+					assert.NoError(t, err, "Summary")
+					assert.Equal(t, map[string]string{TrianglesAggregator: "2"}, summary, "Summary")
+				}
+			})
+		}
+	}
+}
+
+func TestClustering(t *testing.T) {
+	alg, _ := New("clustering", Params{"batch": "1"})
+	res, err := Run(make(chan struct{}), engine.New(log.TestLogger(), 2, engine.NewLoopback()), alg,
+		twoTrianglesSharingAnEdge(), false)
+	if assert.NoError(t, err, "Run") {
+		assert.Equal(t, map[string]string{"a": "0.6666666666666666", "b": "1", "c": "0.6666666666666666",
+			"d": "0.3333333333333333", "e": "0"}, outputsOf(t, alg, res), "Coefficients")
+		summary, err := alg.Summary(res.Aggregated)
+		assert.NoError(t, err, "Summary")
+		assert.Equal(t, map[string]string{CoefficientAggregator: "0.6", TrianglesAggregator: "2"}, summary, "Summary")
+	}
+}
+
+func TestTriangles_Params(t *testing.T) {
+	_, err := New("triangles", Params{"batch": "-1"})
+	assert.Error(t, err, "Batch")
+}
+
+func TestTriangleCodecs(t *testing.T) {
+	m := triangleMessage{Kind: listMessage, From: "a", Count: 2, IDs: []string{"b", "c"}}
+	r, err := codec.Encode[triangleMessage](triangleMessageCodec{}, m)
+	if assert.NoError(t, err, "Encode message") {
+		d, err := codec.Decode[triangleMessage](triangleMessageCodec{}, r)
+		assert.NoError(t, err, "Decode message")
+		assert.Equal(t, m, d, "Message round trip")
+	}
+	for i := 0; i < len(r); i++ {
+		_, err := codec.Decode[triangleMessage](triangleMessageCodec{}, r[:i])
+		assert.Error(t, err, "Short message")
+	}
+
+	v := triangleVertex{Degree: 3, Higher: []string{"b", "c"}, Next: [2]int64{1, 2}, Triangles: 4}
+	r, err = codec.Encode[triangleVertex](triangleCodec{}, v)
+	if assert.NoError(t, err, "Encode vertex") {
+		d, err := codec.Decode[triangleVertex](triangleCodec{}, r)
+		assert.NoError(t, err, "Decode vertex")
+		assert.Equal(t, v, d, "Vertex round trip")
+	}
+	for i := 0; i < len(r); i++ {
+		_, err := codec.Decode[triangleVertex](triangleCodec{}, r[:i])
+		assert.Error(t, err, "Short vertex")
+	}
+}
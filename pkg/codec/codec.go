@@ -0,0 +1,334 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+// Package codec encodes the vertex values, edge values and messages.
+// The built-in codecs of the basic types do not use reflection
+package codec
+
+import (
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrShortBuffer is returned when the data ends before the value
+var ErrShortBuffer = errors.New("the data is shorter than the value")
+
+// Codec encodes and decodes the values of type T
+type Codec[T any] interface {
+	// Name identifies the codec in the checkpoint files. i.e: int64, json
+	Name() string
+	// Append appends the encoded value to dst and returns the extended buffer
+	Append(dst []byte, v T) ([]byte, error)
+	// Decode decodes the value at the beginning of src and returns the number of bytes read
+	Decode(src []byte) (T, int, error)
+}
+
+// Encode returns the encoded value
+func Encode[T any](c Codec[T], v T) ([]byte, error) {
+	return c.Append(nil, v)
+}
+
+// Decode decodes the value that takes the whole src
+func Decode[T any](c Codec[T], src []byte) (T, error) {
+	v, n, err := c.Decode(src)
+	if err != nil {
+		return v, err
+	}
+	if n != len(src) {
+		return v, errors.New(strings.Concat(
+			"the data has ", strconv.Itoa(len(src)-n), " bytes after the value. Codec: ", c.Name()))
+	}
+	return v, nil
+}
+
+// Int64 encodes the int64 values as zig-zag varints
+type Int64 struct{}
+
+// Name returns int64
+func (Int64) Name() string { return "int64" }
+
+// Append appends the varint of v
+func (Int64) Append(dst []byte, v int64) ([]byte, error) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(dst, buf[:n]...), nil
+}
+
+// Decode reads a varint
+func (Int64) Decode(src []byte) (int64, int, error) {
+	v, n := binary.Varint(src)
+	if n == 0 {
+		return 0, 0, ErrShortBuffer
+	}
+	if n < 0 {
+		return 0, 0, errors.New("the varint overflows an int64")
+	}
+	return v, n, nil
+}
+
+// Float64 encodes the float64 values in 8 bytes little endian
+type Float64 struct{}
+
+// Name returns float64
+func (Float64) Name() string { return "float64" }
+
+// Append appends the 8 bytes of v
+func (Float64) Append(dst []byte, v float64) ([]byte, error) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(dst, buf[:]...), nil
+}
+
+// Decode reads 8 bytes
+func (Float64) Decode(src []byte) (float64, int, error) {
+	if len(src) < 8 {
+		return 0, 0, ErrShortBuffer
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(src)), 8, nil
+}
+
+// String encodes the strings prefixed by the length
+type String struct{}
+
+// Name returns string
+func (String) Name() string { return "string" }
+
+// Append appends the length and the bytes of v
+func (String) Append(dst []byte, v string) ([]byte, error) {
+	dst = appendLen(dst, len(v))
+	return append(dst, v...), nil
+}
+
+// Decode reads the length and the bytes
+func (String) Decode(src []byte) (string, int, error) {
+	b, n, err := readLen(src)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(b), n, nil
+}
+
+// Bytes encodes the byte slices prefixed by the length
+type Bytes struct{}
+
+// Name returns bytes
+func (Bytes) Name() string { return "bytes" }
+
+// Append appends the length and v
+func (Bytes) Append(dst []byte, v []byte) ([]byte, error) {
+	dst = appendLen(dst, len(v))
+	return append(dst, v...), nil
+}
+
+// Decode reads the length and returns a copy of the bytes
+func (Bytes) Decode(src []byte) ([]byte, int, error) {
+	b, n, err := readLen(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append([]byte{}, b...), n, nil
+}
+
+// Empty encodes nothing. It is intended for the values that are not used. i.e: the unweighted edges
+type Empty struct{}
+
+// Name returns empty
+func (Empty) Name() string { return "empty" }
+
+// Append does not append anything
+func (Empty) Append(dst []byte, _ struct{}) ([]byte, error) { return dst, nil }
+
+// Decode does not read anything
+func (Empty) Decode([]byte) (struct{}, int, error) { return struct{}{}, 0, nil }
+
+// JSON encodes any value in json prefixed by the length. It uses reflection,
+// so it is intended for the complex values out of the hot paths
+type JSON[T any] struct{}
+
+// Name returns json
+func (JSON[T]) Name() string { return "json" }
+
+// Append appends the length and the json of v
+func (JSON[T]) Append(dst []byte, v T) ([]byte, error) {
+	r, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal the json value")
+	}
+	dst = appendLen(dst, len(r))
+	return append(dst, r...), nil
+}
+
+// Decode reads the length and unmarshals the json
+func (JSON[T]) Decode(src []byte) (T, int, error) {
+	var v T
+	b, n, err := readLen(src)
+	if err != nil {
+		return v, 0, err
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, 0, errors.Wrap(err, "cannot unmarshal the json value")
+	}
+	return v, n, nil
+}
+
+// BinaryValue is the pointer to a value that has its own binary form
+type BinaryValue[T any] interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// Binary encodes the values with their own compact binary form prefixed by the length.
+// i.e: codec.Binary[Point, *Point]{}
+type Binary[T any, P BinaryValue[T]] struct{}
+
+// Name returns binary
+func (Binary[T, P]) Name() string { return "binary" }
+
+// Append appends the length and the binary form of v
+func (Binary[T, P]) Append(dst []byte, v T) ([]byte, error) {
+	r, err := P(&v).MarshalBinary()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal the binary value")
+	}
+	dst = appendLen(dst, len(r))
+	return append(dst, r...), nil
+}
+
+// Decode reads the length and unmarshals the binary form
+func (Binary[T, P]) Decode(src []byte) (T, int, error) {
+	var v T
+	b, n, err := readLen(src)
+	if err != nil {
+		return v, 0, err
+	}
+	if err := P(&v).UnmarshalBinary(b); err != nil {
+		return v, 0, errors.Wrap(err, "cannot unmarshal the binary value")
+	}
+	return v, n, nil
+}
+
+// ProtoMessage is the pointer to a generated protobuf message
+type ProtoMessage[T any] interface {
+	*T
+	proto.Message
+}
+
+// Proto encodes the protobuf messages prefixed by the length. The values are the
+// message pointers because the generated messages cannot be copied.
+// i.e: codec.Proto[pb.Rank, *pb.Rank]{}
+type Proto[T any, P ProtoMessage[T]] struct{}
+
+// Name returns proto
+func (Proto[T, P]) Name() string { return "proto" }
+
+// Append appends the length and the deterministic protobuf encoding of v
+func (Proto[T, P]) Append(dst []byte, v P) ([]byte, error) {
+	opts := proto.MarshalOptions{Deterministic: true}
+	dst = appendLen(dst, opts.Size(v))
+	dst, err := opts.MarshalAppend(dst, v)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal the protobuf value")
+	}
+	return dst, nil
+}
+
+// Decode reads the length and unmarshals a new message
+func (Proto[T, P]) Decode(src []byte) (P, int, error) {
+	b, n, err := readLen(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	v := P(new(T))
+	if err := proto.Unmarshal(b, v); err != nil {
+		return nil, 0, errors.Wrap(err, "cannot unmarshal the protobuf value")
+	}
+	return v, n, nil
+}
+
+// Slice encodes the slices prefixed by the number of elements with the codec of the elements
+type Slice[T any] struct {
+	Elem Codec[T]
+}
+
+// Name returns the name of the element codec with brackets. i.e: []int64
+func (c Slice[T]) Name() string { return strings.Concat("[]", c.Elem.Name()) }
+
+// Append appends the number of elements and every element
+func (c Slice[T]) Append(dst []byte, v []T) ([]byte, error) {
+	dst = appendLen(dst, len(v))
+	var err error
+	for _, e := range v {
+		if dst, err = c.Elem.Append(dst, e); err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// Decode reads the number of elements and every element
+func (c Slice[T]) Decode(src []byte) ([]T, int, error) {
+	l, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, 0, ErrShortBuffer
+	}
+	// The length is not trusted to allocate the slice
+	size := l
+	if size > uint64(len(src)) {
+		size = uint64(len(src))
+	}
+	v := make([]T, 0, size)
+	for i := uint64(0); i < l; i++ {
+		e, en, err := c.Elem.Decode(src[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+		if en == 0 && l > uint64(len(src)) {
+			return nil, 0, errors.New(strings.Concat("the slice length is not valid. Codec: ", c.Name()))
+		}
+		v = append(v, e)
+		n += en
+	}
+	return v, n, nil
+}
+
+func appendLen(dst []byte, l int) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(l))
+	return append(dst, buf[:n]...)
+}
+
+// readLen reads the length prefix and returns the bytes of the value
+// and the number of bytes read with the prefix
+func readLen(src []byte) ([]byte, int, error) {
+	l, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, 0, ErrShortBuffer
+	}
+	if l > uint64(len(src)-n) {
+		return nil, 0, ErrShortBuffer
+	}
+	end := n + int(l)
+	return src[n:end], end, nil
+}
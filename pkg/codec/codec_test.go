@@ -0,0 +1,183 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package codec
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type point struct {
+	X int32
+	Y int32
+}
+
+func (p *point) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, uint32(p.X))
+	binary.LittleEndian.PutUint32(b[4:], uint32(p.Y))
+	return b, nil
+}
+
+func (p *point) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return errors.New("bad point")
+	}
+	p.X = int32(binary.LittleEndian.Uint32(b))
+	p.Y = int32(binary.LittleEndian.Uint32(b[4:]))
+	return nil
+}
+
+type vertex struct {
+	ID    string   `json:"id"`
+	Ranks []string `json:"ranks"`
+}
+
+func TestCodecs(t *testing.T) {
+	testRoundTrip[int64](t, Int64{}, "int64", 0, -1, 1, math.MaxInt64, math.MinInt64)
+	testRoundTrip[float64](t, Float64{}, "float64", 0, -1.5, math.Inf(1), math.MaxFloat64)
+	testRoundTrip[string](t, String{}, "string", "", "vertex", "ñandú")
+	testRoundTrip[[]byte](t, Bytes{}, "bytes", []byte{}, []byte{1, 2, 3})
+	testRoundTrip[struct{}](t, Empty{}, "empty", struct{}{})
+	testRoundTrip[vertex](t, JSON[vertex]{}, "json", vertex{}, vertex{ID: "v1", Ranks: []string{"a"}})
+	testRoundTrip[point](t, Binary[point, *point]{}, "binary", point{}, point{X: -1, Y: 7})
+	testRoundTrip[[]int64](t, Slice[int64]{Elem: Int64{}}, "[]int64", []int64{}, []int64{1, -2, 300})
+	testRoundTrip[[]string](t, Slice[string]{Elem: String{}}, "[]string", []string{"a", "", "bc"})
+}
+
+func TestProto(t *testing.T) {
+	c := Proto[wrapperspb.StringValue, *wrapperspb.StringValue]{}
+	assert.Equal(t, "proto", c.Name(), "Name")
+
+	values := []*wrapperspb.StringValue{wrapperspb.String(""), wrapperspb.String("vertex")}
+	var buf []byte
+	for _, v := range values {
+		r, err := Encode[*wrapperspb.StringValue](c, v)
+		if assert.NoError(t, err, "Encode") {
+			d, err := Decode[*wrapperspb.StringValue](c, r)
+			if assert.NoError(t, err, "Decode") {
+				assert.True(t, proto.Equal(v, d), "Round trip")
+			}
+		}
+		buf, _ = c.Append(buf, v)
+	}
+
+	// The values are decoded one after another from the same buffer
+	for _, v := range values {
+		d, n, err := c.Decode(buf)
+		if assert.NoError(t, err, "Decode stream") {
+			assert.True(t, proto.Equal(v, d), "Stream value")
+		}
+		buf = buf[n:]
+	}
+	assert.Empty(t, buf, "Whole stream")
+
+	_, err := Decode[*wrapperspb.StringValue](c, []byte{1, 0xff})
+	assert.Error(t, err, "Bad protobuf")
+}
+
+func testRoundTrip[T any](t *testing.T, c Codec[T], name string, values ...T) {
+	t.Run(name, func(t *testing.T) {
+		assert.Equal(t, name, c.Name(), "Name")
+
+		var buf []byte
+		for _, v := range values {
+			r, err := Encode(c, v)
+			if assert.NoError(t, err, "Encode") {
+				d, err := Decode(c, r)
+				if assert.NoError(t, err, "Decode") {
+					assert.Equal(t, v, d, "Round trip")
+				}
+			}
+			buf, _ = c.Append(buf, v)
+		}
+
+		// The values are decoded one after another from the same buffer
+		for _, v := range values {
+			d, n, err := c.Decode(buf)
+			if assert.NoError(t, err, "Decode stream") {
+				assert.Equal(t, v, d, "Stream value")
+			}
+			buf = buf[n:]
+		}
+		assert.Empty(t, buf, "Whole stream")
+	})
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func() error
+	}{
+		{
+			name:   "Int64 empty",
+			decode: func() error { _, err := Decode[int64](Int64{}, nil); return err },
+		},
+		{
+			name: "Int64 overflow",
+			decode: func() error {
+				_, err := Decode[int64](Int64{}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+				return err
+			},
+		},
+		{
+			name:   "Float64 short",
+			decode: func() error { _, err := Decode[float64](Float64{}, []byte{1, 2}); return err },
+		},
+		{
+			name:   "String short",
+			decode: func() error { _, err := Decode[string](String{}, []byte{5, 'a'}); return err },
+		},
+		{
+			name:   "Trailing bytes",
+			decode: func() error { _, err := Decode[int64](Int64{}, []byte{2, 0}); return err },
+		},
+		{
+			name:   "Bad json",
+			decode: func() error { _, err := Decode[vertex](JSON[vertex]{}, []byte{1, '{'}); return err },
+		},
+		{
+			name:   "Bad binary",
+			decode: func() error { _, err := Decode[point](Binary[point, *point]{}, []byte{1, 0}); return err },
+		},
+		{
+			name:   "Slice short",
+			decode: func() error { _, err := Decode[[]int64](Slice[int64]{Elem: Int64{}}, []byte{3, 2}); return err },
+		},
+		{
+			name: "Slice of empty values too long",
+			decode: func() error {
+				_, err := Decode[[]struct{}](Slice[struct{}]{Elem: Empty{}}, []byte{0xff, 0xff, 0xff, 0xff, 0x0f})
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.decode())
+		})
+	}
+	_, err := Decode[int64](Int64{}, nil)
+	assert.ErrorIs(t, err, ErrShortBuffer, "Short buffer")
+}
@@ -0,0 +1,174 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package compute
+
+import (
+	"fmt"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// Aggregates reads the aggregators
+type Aggregates interface {
+	// Aggregated returns the encoded value of the aggregator reduced in the previous superstep
+	// or set by the master compute. It is nil when there is no value
+	Aggregated(name string) []byte
+}
+
+// Aggregating reads and writes the aggregators
+type Aggregating interface {
+	Aggregates
+	// Aggregate adds the encoded value to the aggregator. It is reduced at the end of the superstep
+	Aggregate(name string, v []byte)
+}
+
+// RawAggregator is the aggregator run by the engine. It reduces the encoded values
+type RawAggregator interface {
+	// Name identifies the aggregator
+	Name() string
+	// Persistent returns true when the value is kept across the supersteps.
+	// The value of a regular aggregator starts again every superstep
+	Persistent() bool
+	// Reduce reduces two encoded values
+	Reduce(a []byte, b []byte) ([]byte, error)
+	// Format returns the readable form of the encoded value
+	Format(v []byte) (string, error)
+}
+
+// Aggregator reduces the values of type A that the vertices aggregate in a superstep
+type Aggregator[A any] struct {
+	// Key identifies the aggregator
+	Key string
+	// Codec encodes the values
+	Codec codec.Codec[A]
+	// Zero is the value when nothing has been aggregated
+	Zero A
+	// Reduce reduces two values. It must be commutative and associative
+	Reduce func(a, b A) A
+	// Persistent keeps the value across the supersteps
+	Persistent bool
+}
+
+// Aggregate adds the value to the aggregator
+func (a Aggregator[A]) Aggregate(ctx Aggregating, v A) error {
+	r, err := codec.Encode(a.Codec, v)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot encode the aggregated value. Aggregator: ", a.Key))
+	}
+	ctx.Aggregate(a.Key, r)
+	return nil
+}
+
+// Value returns the value of the aggregator. It is the zero value when there is no value
+func (a Aggregator[A]) Value(ctx Aggregates) (A, error) {
+	return a.decode(ctx.Aggregated(a.Key))
+}
+
+// Set changes the value of the aggregator that the vertices read in the superstep
+func (a Aggregator[A]) Set(ctx MasterContext, v A) error {
+	r, err := codec.Encode(a.Codec, v)
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot encode the aggregated value. Aggregator: ", a.Key))
+	}
+	ctx.SetAggregated(a.Key, r)
+	return nil
+}
+
+// Raw returns the aggregator run by the engine
+func (a Aggregator[A]) Raw() RawAggregator {
+	return rawAggregator[A]{a: a}
+}
+
+func (a Aggregator[A]) decode(r []byte) (A, error) {
+	if r == nil {
+		return a.Zero, nil
+	}
+	v, err := codec.Decode(a.Codec, r)
+	if err != nil {
+		return v, errors.Wrap(err, strings.Concat("cannot decode the aggregated value. Aggregator: ", a.Key))
+	}
+	return v, nil
+}
+
+type rawAggregator[A any] struct {
+	a Aggregator[A]
+}
+
+func (r rawAggregator[A]) Name() string { return r.a.Key }
+
+func (r rawAggregator[A]) Persistent() bool { return r.a.Persistent }
+
+func (r rawAggregator[A]) Reduce(a []byte, b []byte) ([]byte, error) {
+	va, err := r.a.decode(a)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := r.a.decode(b)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Encode(r.a.Codec, r.a.Reduce(va, vb))
+}
+
+func (r rawAggregator[A]) Format(v []byte) (string, error) {
+	d, err := r.a.decode(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(d), nil
+}
+
+// SumFloat64 returns the aggregator that sums float64 values
+func SumFloat64(key string) Aggregator[float64] {
+	return Aggregator[float64]{Key: key, Codec: codec.Float64{}, Reduce: func(a, b float64) float64 { return a + b }}
+}
+
+// SumInt64 returns the aggregator that sums int64 values
+func SumInt64(key string) Aggregator[int64] {
+	return Aggregator[int64]{Key: key, Codec: codec.Int64{}, Reduce: func(a, b int64) int64 { return a + b }}
+}
+
+// MasterContext is the context of the master compute. The master compute
+// runs before every superstep with the values aggregated in the previous one
+type MasterContext interface {
+	Aggregates
+	// Superstep returns the superstep that is going to run
+	Superstep() int
+	// Vertices returns the number of vertices of the graph
+	Vertices() int64
+	// SetAggregated changes the encoded value of the aggregator that the vertices read in the superstep
+	SetAggregated(name string, v []byte)
+	// Halt ends the job without running the superstep
+	Halt()
+}
+
+// Master is the master compute of a job. It coordinates the vertices through
+// the aggregators. i.e: it checks the convergence or changes the phase
+type Master interface {
+	Compute(ctx MasterContext) error
+}
+
+// MasterCompute is a master compute defined by a function
+type MasterCompute func(ctx MasterContext) error
+
+// Compute calls the function
+func (m MasterCompute) Compute(ctx MasterContext) error {
+	return m(ctx)
+}
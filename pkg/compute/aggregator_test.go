@@ -0,0 +1,99 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package compute
+
+import (
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+type masterFake struct {
+	values map[string][]byte
+	halted bool
+}
+
+func (m *masterFake) Superstep() int                      { return 1 }
+func (m *masterFake) Vertices() int64                     { return 3 }
+func (m *masterFake) Aggregated(name string) []byte       { return m.values[name] }
+func (m *masterFake) SetAggregated(name string, v []byte) { m.values[name] = v }
+func (m *masterFake) Halt()                               { m.halted = true }
+
+func TestAggregator(t *testing.T) {
+	sum := SumFloat64("sum")
+	p := Bind[int64, float64, int64]("sum", Compute[int64, float64, int64](
+		func(ctx Context[int64, float64, int64], messages []int64) error {
+			prev, err := sum.Value(ctx)
+			if err != nil {
+				return err
+			}
+			return sum.Aggregate(ctx, prev+float64(ctx.Vertices()))
+		}), maxCodecs)
+
+	v := testRawVertex(t, 1, 1)
+	if assert.NoError(t, p.Compute(v, nil), "Zero value") {
+		assert.Equal(t, 3.0, decode[float64](t, codec.Float64{}, v.aggregated["sum"][0]), "Aggregated")
+	}
+	v = testRawVertex(t, 1, 1)
+	v.values["sum"] = encode[float64](t, codec.Float64{}, 1.5)
+	if assert.NoError(t, p.Compute(v, nil), "Previous value") {
+		assert.Equal(t, 4.5, decode[float64](t, codec.Float64{}, v.aggregated["sum"][0]), "Aggregated")
+	}
+	v = testRawVertex(t, 1, 1)
+	v.values["sum"] = []byte{1}
+	assert.Error(t, p.Compute(v, nil), "Bad aggregated value")
+
+	raw := sum.Raw()
+	assert.Equal(t, "sum", raw.Name(), "Name")
+	assert.False(t, raw.Persistent(), "Persistent")
+	r, err := raw.Reduce(encode[float64](t, codec.Float64{}, 1), encode[float64](t, codec.Float64{}, 2.5))
+	if assert.NoError(t, err, "Reduce") {
+		assert.Equal(t, 3.5, decode[float64](t, codec.Float64{}, r), "Reduced")
+		f, err := raw.Format(r)
+		assert.NoError(t, err, "Format")
+		assert.Equal(t, "3.5", f, "Format")
+	}
+	_, err = raw.Reduce([]byte{1}, nil)
+	assert.Error(t, err, "Bad value")
+}
+
+func TestMasterCompute(t *testing.T) {
+	delta := SumFloat64("delta")
+	m := MasterCompute(func(ctx MasterContext) error {
+		d, err := delta.Value(ctx)
+		if err != nil {
+			return err
+		}
+		if d < 0.1 {
+			ctx.Halt()
+			return nil
+		}
+		return delta.Set(ctx, d/2)
+	})
+
+	ctx := &masterFake{values: map[string][]byte{"delta": encode[float64](t, codec.Float64{}, 1)}}
+	if assert.NoError(t, m.Compute(ctx), "Compute") {
+		assert.False(t, ctx.halted, "Not converged")
+		assert.Equal(t, 0.5, decode[float64](t, codec.Float64{}, ctx.values["delta"]), "Set")
+	}
+	ctx.values["delta"] = encode[float64](t, codec.Float64{}, 0.01)
+	if assert.NoError(t, m.Compute(ctx), "Compute") {
+		assert.True(t, ctx.halted, "Converged")
+	}
+}
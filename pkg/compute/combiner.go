@@ -0,0 +1,58 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package compute
+
+import (
+	"github.com/carisa/pkg/codec"
+	"github.com/pkg/errors"
+)
+
+// RawCombiner is the combiner run by the engine. It combines the encoded messages
+type RawCombiner interface {
+	Combine(a []byte, b []byte) ([]byte, error)
+}
+
+// Combiner combines the messages sent to the same vertex in a superstep, so the vertex
+// receives a single message. The function must be commutative and associative. i.e: min, sum
+type Combiner[M any] struct {
+	// Codec encodes the messages
+	Codec codec.Codec[M]
+	// Combine combines two messages
+	Combine func(a, b M) M
+}
+
+// Raw returns the combiner run by the engine
+func (c Combiner[M]) Raw() RawCombiner {
+	return rawCombiner[M]{c: c}
+}
+
+type rawCombiner[M any] struct {
+	c Combiner[M]
+}
+
+func (r rawCombiner[M]) Combine(a []byte, b []byte) ([]byte, error) {
+	va, err := codec.Decode(r.c.Codec, a)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode the combined message")
+	}
+	vb, err := codec.Decode(r.c.Codec, b)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode the combined message")
+	}
+	return codec.Encode(r.c.Codec, r.c.Combine(va, vb))
+}
@@ -0,0 +1,43 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package compute
+
+import (
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCombiner(t *testing.T) {
+	min := Combiner[int64]{Codec: codec.Int64{}, Combine: func(a, b int64) int64 {
+		if a < b {
+			return a
+		}
+		return b
+	}}.Raw()
+
+	r, err := min.Combine(encode[int64](t, codec.Int64{}, 3), encode[int64](t, codec.Int64{}, -2))
+	if assert.NoError(t, err, "Combine") {
+		assert.Equal(t, int64(-2), decode[int64](t, codec.Int64{}, r), "Min")
+	}
+	_, err = min.Combine(nil, encode[int64](t, codec.Int64{}, 1))
+	assert.Error(t, err, "Bad first message")
+	_, err = min.Combine(encode[int64](t, codec.Int64{}, 1), nil)
+	assert.Error(t, err, "Bad second message")
+}
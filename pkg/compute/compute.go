@@ -0,0 +1,301 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+// Package compute defines the typed api of the vertex programs. The programs
+// work with the vertex value type V, the edge value type E and the message
+// type M, and they are bound to codecs so the engine only moves encoded values
+package compute
+
+import (
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// Edge is an out edge of a vertex
+type Edge[E any] struct {
+	// Target is the id of the target vertex
+	Target string
+	// Value is the edge value
+	Value E
+}
+
+// Context is the vertex being computed in a superstep
+type Context[V, E, M any] interface {
+	Aggregating
+	// Superstep returns the current superstep. The first one is 0
+	Superstep() int
+	// Vertices returns the number of vertices of the graph
+	Vertices() int64
+	// Partition returns the partition of the vertex
+	Partition() int
+	// ID returns the vertex id
+	ID() string
+	// Value returns the vertex value
+	Value() V
+	// SetValue changes the vertex value
+	SetValue(v V)
+	// Edges returns the out edges of the vertex
+	Edges() []Edge[E]
+	// Send sends the message to the target vertex. It is received in the next superstep
+	Send(target string, m M)
+	// SendToNeighbors sends the message to the targets of every out edge
+	SendToNeighbors(m M)
+	// VoteToHalt deactivates the vertex until it receives a message
+	VoteToHalt()
+	// AddVertex adds the vertex with the value at the end of the superstep
+	AddVertex(id string, v V)
+	// RemoveVertex removes the vertex and its out edges at the end of the superstep.
+	// The messages sent to the vertex in the superstep are dropped
+	RemoveVertex(id string)
+	// AddEdge adds the out edge to the source vertex at the end of the superstep
+	AddEdge(source string, e Edge[E])
+	// RemoveEdge removes the out edge of the source vertex to the target at the end of the superstep
+	RemoveEdge(source string, target string)
+}
+
+// Program is a vertex program
+type Program[V, E, M any] interface {
+	// Compute runs the vertex in the superstep with the messages received
+	Compute(ctx Context[V, E, M], messages []M) error
+}
+
+// Compute is a vertex program defined by a function
+type Compute[V, E, M any] func(ctx Context[V, E, M], messages []M) error
+
+// Compute calls the function
+func (c Compute[V, E, M]) Compute(ctx Context[V, E, M], messages []M) error {
+	return c(ctx, messages)
+}
+
+// Codecs are the codecs of the values of a program
+type Codecs[V, E, M any] struct {
+	Vertex  codec.Codec[V]
+	Edge    codec.Codec[E]
+	Message codec.Codec[M]
+}
+
+// RawContext is the vertex context implemented by the engine. The values are encoded
+type RawContext interface {
+	Aggregating
+	Superstep() int
+	Vertices() int64
+	Partition() int
+	ID() string
+	Value() []byte
+	SetValue(v []byte)
+	Edges() []Edge[[]byte]
+	Send(target string, m []byte)
+	VoteToHalt()
+	Mutate(m Mutation)
+}
+
+// RawProgram is the program run by the engine. It decodes and encodes the values with the codecs
+type RawProgram interface {
+	// Name identifies the program. i.e: pagerank
+	Name() string
+	// Codecs returns the names of the vertex, edge and message codecs.
+	// They are written in the header of the checkpoints and checked when a job is resumed
+	Codecs() (vertex string, edge string, message string)
+	// Compute runs the vertex with the encoded messages
+	Compute(ctx RawContext, messages [][]byte) error
+}
+
+// Bind binds the typed program to its codecs and returns the program run by the engine
+func Bind[V, E, M any](name string, p Program[V, E, M], c Codecs[V, E, M]) RawProgram {
+	return &boundProgram[V, E, M]{
+		name:    name,
+		program: p,
+		codecs:  c,
+	}
+}
+
+type boundProgram[V, E, M any] struct {
+	name    string
+	program Program[V, E, M]
+	codecs  Codecs[V, E, M]
+}
+
+func (b *boundProgram[V, E, M]) Name() string { return b.name }
+
+func (b *boundProgram[V, E, M]) Codecs() (string, string, string) {
+	return b.codecs.Vertex.Name(), b.codecs.Edge.Name(), b.codecs.Message.Name()
+}
+
+// Compute decodes the vertex value and the messages, runs the typed program and
+// encodes the new value and the messages sent. The edges are decoded when they are used.
+// The value, the messages, the aggregated values, the mutations and the vote to halt are only passed
+// to the engine when the program ends without error, so a failed vertex does not leave partial messages
+func (b *boundProgram[V, E, M]) Compute(raw RawContext, messages [][]byte) error {
+	value, err := codec.Decode(b.codecs.Vertex, raw.Value())
+	if err != nil {
+		return errors.Wrap(err, strings.Concat("cannot decode the vertex value. Vertex: ", raw.ID()))
+	}
+	ms := make([]M, len(messages))
+	for i, m := range messages {
+		if ms[i], err = codec.Decode(b.codecs.Message, m); err != nil {
+			return errors.Wrap(err, strings.Concat("cannot decode the message. Vertex: ", raw.ID()))
+		}
+	}
+
+	ctx := &boundContext[V, E, M]{raw: raw, codecs: b.codecs, value: value}
+	if err := b.program.Compute(ctx, ms); err != nil {
+		return err
+	}
+	if ctx.err != nil {
+		return ctx.err
+	}
+	if ctx.changed {
+		r, err := codec.Encode(b.codecs.Vertex, ctx.value)
+		if err != nil {
+			return errors.Wrap(err, strings.Concat("cannot encode the vertex value. Vertex: ", raw.ID()))
+		}
+		raw.SetValue(r)
+	}
+	for _, m := range ctx.sent {
+		raw.Send(m.target, m.value)
+	}
+	for _, a := range ctx.aggregated {
+		raw.Aggregate(a.target, a.value)
+	}
+	for _, m := range ctx.mutations {
+		raw.Mutate(m)
+	}
+	if ctx.halted {
+		raw.VoteToHalt()
+	}
+	return nil
+}
+
+// message is an encoded message or aggregated value waiting for the end of the program.
+// The target is the vertex or the aggregator
+type message struct {
+	target string
+	value  []byte
+}
+
+// boundContext is the typed context over the raw context. The first
+// encoding error is kept and returned when the program ends
+type boundContext[V, E, M any] struct {
+	raw     RawContext
+	codecs  Codecs[V, E, M]
+	value   V
+	changed bool
+	edges   []Edge[E]
+	decoded bool
+	sent    []message
+	// aggregated are the values for the aggregators
+	aggregated []message
+	mutations  []Mutation
+	halted     bool
+	err        error
+}
+
+func (c *boundContext[V, E, M]) Superstep() int { return c.raw.Superstep() }
+
+func (c *boundContext[V, E, M]) Vertices() int64 { return c.raw.Vertices() }
+
+func (c *boundContext[V, E, M]) Partition() int { return c.raw.Partition() }
+
+func (c *boundContext[V, E, M]) ID() string { return c.raw.ID() }
+
+func (c *boundContext[V, E, M]) Value() V { return c.value }
+
+func (c *boundContext[V, E, M]) SetValue(v V) {
+	c.value = v
+	c.changed = true
+}
+
+func (c *boundContext[V, E, M]) Edges() []Edge[E] {
+	if c.decoded {
+		return c.edges
+	}
+	c.decoded = true
+
+	raw := c.raw.Edges()
+	c.edges = make([]Edge[E], 0, len(raw))
+	for _, e := range raw {
+		v, err := codec.Decode(c.codecs.Edge, e.Value)
+		if err != nil {
+			c.fail(errors.Wrap(err, strings.Concat("cannot decode the edge value. Target: ", e.Target)))
+			continue
+		}
+		c.edges = append(c.edges, Edge[E]{Target: e.Target, Value: v})
+	}
+	return c.edges
+}
+
+func (c *boundContext[V, E, M]) Send(target string, m M) {
+	r, err := codec.Encode(c.codecs.Message, m)
+	if err != nil {
+		c.fail(errors.Wrap(err, strings.Concat("cannot encode the message. Target: ", target)))
+		return
+	}
+	c.sent = append(c.sent, message{target: target, value: r})
+}
+
+// SendToNeighbors encodes the message once for every target
+func (c *boundContext[V, E, M]) SendToNeighbors(m M) {
+	r, err := codec.Encode(c.codecs.Message, m)
+	if err != nil {
+		c.fail(errors.Wrap(err, strings.Concat("cannot encode the message. Vertex: ", c.raw.ID())))
+		return
+	}
+	for _, e := range c.raw.Edges() {
+		c.sent = append(c.sent, message{target: e.Target, value: r})
+	}
+}
+
+func (c *boundContext[V, E, M]) VoteToHalt() { c.halted = true }
+
+func (c *boundContext[V, E, M]) AddVertex(id string, v V) {
+	r, err := codec.Encode(c.codecs.Vertex, v)
+	if err != nil {
+		c.fail(errors.Wrap(err, strings.Concat("cannot encode the vertex value. Vertex: ", id)))
+		return
+	}
+	c.mutations = append(c.mutations, Mutation{Kind: AddVertex, Vertex: id, Value: r})
+}
+
+func (c *boundContext[V, E, M]) RemoveVertex(id string) {
+	c.mutations = append(c.mutations, Mutation{Kind: RemoveVertex, Vertex: id})
+}
+
+func (c *boundContext[V, E, M]) AddEdge(source string, e Edge[E]) {
+	r, err := codec.Encode(c.codecs.Edge, e.Value)
+	if err != nil {
+		c.fail(errors.Wrap(err, strings.Concat("cannot encode the edge value. Source: ", source, ". Target: ", e.Target)))
+		return
+	}
+	c.mutations = append(c.mutations, Mutation{Kind: AddEdge, Vertex: source, Edge: Edge[[]byte]{Target: e.Target, Value: r}})
+}
+
+func (c *boundContext[V, E, M]) RemoveEdge(source string, target string) {
+	c.mutations = append(c.mutations, Mutation{Kind: RemoveEdge, Vertex: source, Edge: Edge[[]byte]{Target: target}})
+}
+
+func (c *boundContext[V, E, M]) Aggregate(name string, v []byte) {
+	c.aggregated = append(c.aggregated, message{target: name, value: v})
+}
+
+func (c *boundContext[V, E, M]) Aggregated(name string) []byte { return c.raw.Aggregated(name) }
+
+func (c *boundContext[V, E, M]) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package compute
+
+import (
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type rawVertex struct {
+	superstep int
+	id        string
+	value     []byte
+	edges     []Edge[[]byte]
+	sent      map[string][][]byte
+	halted    bool
+	// values are the aggregated values read and aggregated the values written
+	values     map[string][]byte
+	aggregated map[string][][]byte
+	mutations  []Mutation
+}
+
+func (v *rawVertex) Superstep() int                { return v.superstep }
+func (v *rawVertex) ID() string                    { return v.id }
+func (v *rawVertex) Value() []byte                 { return v.value }
+func (v *rawVertex) SetValue(value []byte)         { v.value = value }
+func (v *rawVertex) Edges() []Edge[[]byte]         { return v.edges }
+func (v *rawVertex) Send(target string, m []byte)  { v.sent[target] = append(v.sent[target], m) }
+func (v *rawVertex) VoteToHalt()                   { v.halted = true }
+func (v *rawVertex) Vertices() int64               { return 3 }
+func (v *rawVertex) Partition() int                { return 1 }
+func (v *rawVertex) Aggregated(name string) []byte { return v.values[name] }
+func (v *rawVertex) Mutate(m Mutation)             { v.mutations = append(v.mutations, m) }
+func (v *rawVertex) Aggregate(name string, r []byte) {
+	v.aggregated[name] = append(v.aggregated[name], r)
+}
+
+// maxValue propagates the maximum value of the graph
+var maxValue = Compute[int64, float64, int64](func(ctx Context[int64, float64, int64], messages []int64) error {
+	max := ctx.Value()
+	for _, m := range messages {
+		if m > max {
+			max = m
+		}
+	}
+	if ctx.Superstep() == 0 || max > ctx.Value() {
+		ctx.SetValue(max)
+		ctx.SendToNeighbors(max)
+	}
+	ctx.VoteToHalt()
+	return nil
+})
+
+var maxCodecs = Codecs[int64, float64, int64]{
+	Vertex:  codec.Int64{},
+	Edge:    codec.Float64{},
+	Message: codec.Int64{},
+}
+
+func TestBind(t *testing.T) {
+	p := Bind[int64, float64, int64]("max", maxValue, maxCodecs)
+	assert.Equal(t, "max", p.Name(), "Name")
+	vc, ec, mc := p.Codecs()
+	assert.Equal(t, []string{"int64", "float64", "int64"}, []string{vc, ec, mc}, "Codecs")
+
+	v := testRawVertex(t, 1, 3)
+	if assert.NoError(t, p.Compute(v, [][]byte{encode[int64](t, codec.Int64{}, 5), encode[int64](t, codec.Int64{}, 2)})) {
+		assert.Equal(t, int64(5), decode[int64](t, codec.Int64{}, v.value), "Value")
+		assert.Equal(t, int64(5), decode[int64](t, codec.Int64{}, v.sent["b"][0]), "Message to b")
+		assert.Len(t, v.sent["c"], 1, "Message to c")
+		assert.True(t, v.halted, "Halted")
+	}
+
+	v = testRawVertex(t, 1, 7)
+	if assert.NoError(t, p.Compute(v, [][]byte{encode[int64](t, codec.Int64{}, 5)})) {
+		assert.Equal(t, int64(7), decode[int64](t, codec.Int64{}, v.value), "Value unchanged")
+		assert.Empty(t, v.sent, "No messages")
+	}
+}
+
+func TestBind_Edges(t *testing.T) {
+	var weights []float64
+	p := Bind[int64, float64, int64]("edges", Compute[int64, float64, int64](
+		func(ctx Context[int64, float64, int64], messages []int64) error {
+			for _, e := range ctx.Edges() {
+				weights = append(weights, e.Value)
+				ctx.Send(e.Target, int64(e.Value))
+			}
+			return nil
+		}), maxCodecs)
+
+	v := testRawVertex(t, 0, 1)
+	if assert.NoError(t, p.Compute(v, nil)) {
+		assert.Equal(t, []float64{0.5, 1.5}, weights, "Weights")
+		assert.Equal(t, int64(1), decode[int64](t, codec.Int64{}, v.sent["c"][0]), "Message to c")
+	}
+}
+
+func TestBind_Errors(t *testing.T) {
+	p := Bind[int64, float64, int64]("max", maxValue, maxCodecs)
+
+	v := testRawVertex(t, 0, 1)
+	v.value = nil
+	assert.Error(t, p.Compute(v, nil), "Bad vertex value")
+
+	assert.Error(t, p.Compute(testRawVertex(t, 0, 1), [][]byte{{}}), "Bad message")
+
+	v = testRawVertex(t, 0, 1)
+	v.edges[0].Value = []byte{1}
+	edges := Bind[int64, float64, int64]("edges", Compute[int64, float64, int64](
+		func(ctx Context[int64, float64, int64], messages []int64) error {
+			assert.Len(t, ctx.Edges(), 1, "Valid edges")
+			return nil
+		}), maxCodecs)
+	assert.Error(t, edges.Compute(v, nil), "Bad edge value")
+
+	failed := Bind[int64, float64, int64]("failed", Compute[int64, float64, int64](
+		func(ctx Context[int64, float64, int64], messages []int64) error {
+			return errors.New("failed")
+		}), maxCodecs)
+	assert.EqualError(t, failed.Compute(testRawVertex(t, 0, 1), nil), "failed", "Program error")
+
+	partial := Bind[int64, float64, int64]("partial", Compute[int64, float64, int64](
+		func(ctx Context[int64, float64, int64], messages []int64) error {
+			ctx.SetValue(9)
+			ctx.SendToNeighbors(9)
+			ctx.Aggregate("sum", []byte{1})
+			ctx.RemoveVertex("b")
+			ctx.VoteToHalt()
+			return errors.New("failed")
+		}), maxCodecs)
+	v = testRawVertex(t, 0, 1)
+	if assert.Error(t, partial.Compute(v, nil), "Program error after sending") {
+		assert.Equal(t, int64(1), decode[int64](t, codec.Int64{}, v.value), "Value not changed")
+		assert.Empty(t, v.sent, "Messages not sent")
+		assert.Empty(t, v.aggregated, "Values not aggregated")
+		assert.Empty(t, v.mutations, "Graph not mutated")
+		assert.False(t, v.halted, "Not halted")
+	}
+}
+
+func TestBind_Mutations(t *testing.T) {
+	p := Bind[int64, float64, int64]("mutations", Compute[int64, float64, int64](
+		func(ctx Context[int64, float64, int64], messages []int64) error {
+			ctx.AddVertex("d", 4)
+			ctx.AddEdge("d", Edge[float64]{Target: "a", Value: 2.5})
+			ctx.RemoveEdge("a", "b")
+			ctx.RemoveVertex("c")
+			return nil
+		}), maxCodecs)
+
+	v := testRawVertex(t, 0, 1)
+	if assert.NoError(t, p.Compute(v, nil)) {
+		assert.Equal(t, []Mutation{
+			{Kind: AddVertex, Vertex: "d", Value: encode[int64](t, codec.Int64{}, 4)},
+			{Kind: AddEdge, Vertex: "d", Edge: Edge[[]byte]{Target: "a", Value: encode[float64](t, codec.Float64{}, 2.5)}},
+			{Kind: RemoveEdge, Vertex: "a", Edge: Edge[[]byte]{Target: "b"}},
+			{Kind: RemoveVertex, Vertex: "c"},
+		}, v.mutations, "Mutations")
+	}
+}
+
+func testRawVertex(t *testing.T, superstep int, value int64) *rawVertex {
+	return &rawVertex{
+		superstep: superstep,
+		id:        "a",
+		value:     encode[int64](t, codec.Int64{}, value),
+		edges: []Edge[[]byte]{
+			{Target: "b", Value: encode[float64](t, codec.Float64{}, 0.5)},
+			{Target: "c", Value: encode[float64](t, codec.Float64{}, 1.5)},
+		},
+		sent:       make(map[string][][]byte),
+		values:     make(map[string][]byte),
+		aggregated: make(map[string][][]byte),
+	}
+}
+
+func encode[T any](t *testing.T, c codec.Codec[T], v T) []byte {
+	r, err := codec.Encode(c, v)
+	assert.NoError(t, err, "Encode")
+	return r
+}
+
+func decode[T any](t *testing.T, c codec.Codec[T], r []byte) T {
+	v, err := codec.Decode(c, r)
+	assert.NoError(t, err, "Decode")
+	return v
+}
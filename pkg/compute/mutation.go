@@ -0,0 +1,44 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package compute
+
+// MutationKind is the change of the graph
+type MutationKind int8
+
+const (
+	// AddVertex adds the vertex or changes the value of an existing one
+	AddVertex MutationKind = iota
+	// RemoveVertex removes the vertex and its out edges
+	RemoveVertex
+	// AddEdge adds the out edge to the vertex or changes the value of an existing one
+	AddEdge
+	// RemoveEdge removes the out edge of the vertex
+	RemoveEdge
+)
+
+// Mutation is a change of the graph requested by a vertex. It is applied by
+// the partition of the changed vertex at the end of the superstep
+type Mutation struct {
+	Kind MutationKind
+	// Vertex is the vertex added or removed or the source of the edge
+	Vertex string
+	// Value is the encoded value of the vertex added
+	Value []byte
+	// Edge is the edge added or removed. The value is not used when it is removed
+	Edge Edge[[]byte]
+}
@@ -0,0 +1,515 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	stds "strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// Source is where a configuration value comes from
+type Source string
+
+const (
+	Default Source = "default"
+	File    Source = "file"
+	Env     Source = "env"
+	Flag    Source = "flag"
+	KV      Source = "kv"
+)
+
+// Sources are the sources of the configuration values by field path. i.e: server.port
+type Sources map[string]Source
+
+// Layers defines the configuration layers. The values of a layer override
+// the values of the previous ones in this order: defaults, file, key/value store,
+// json environment variable, field environment variables and flags
+type Layers struct {
+	// File is the configuration file. It is not read when it is empty
+	File string
+	// EnvJSON is the environment variable with the whole configuration in json
+	EnvJSON string
+	// EnvPrefix is the prefix of the environment variable of each field.
+	// i.e: the field server.port with the CARISA prefix is CARISA_SERVER_PORT
+	EnvPrefix string
+	// Flags are the values of the command line flags by field path
+	Flags map[string]string
+	// KV returns the key/value store and the key of the configuration.
+	// It is called once the other layers are resolved, so the store can be
+	// created from them. The key placeholders are expanded with ExpandKey.
+	// Its values cannot have secret references. The store is not read when it is nil
+	KV func() (KVReader, string, error)
+}
+
+// Resolve overrides the default values of confg with the layers and
+// returns the source of every value
+func Resolve(layers Layers, confg interface{}) (Sources, error) {
+	fs, err := fields(confg)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(Sources, len(fs))
+	for _, f := range fs {
+		sources[f.path] = Default
+	}
+
+	if len(layers.File) > 0 {
+		res, err := read(true, layers.File)
+		if err != nil {
+			return nil, err
+		}
+		if err := resolveSource(res, layers.File, confg, fs, File, sources); err != nil {
+			return nil, err
+		}
+	}
+	if err := resolveOverrides(layers, confg, fs, sources); err != nil {
+		return nil, err
+	}
+
+	if layers.KV == nil {
+		return sources, nil
+	}
+	kv, key, err := layers.KV()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create the key/value store of the configuration")
+	}
+	if kv == nil {
+		return sources, nil
+	}
+	if key, err = ExpandKey(key, confg); err != nil {
+		return nil, err
+	}
+	res, err := readKV(kv, key)
+	if err != nil || len(res) == 0 {
+		return sources, err
+	}
+	if err := resolveSource(res, key, confg, fs, KV, sources); err != nil {
+		return nil, err
+	}
+	// The environment variables and flags take precedence over the key/value store
+	if err := resolveOverrides(layers, confg, fs, sources); err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+// keyPlaceholder matches the field paths of a key template. i.e: {graph-id}
+var keyPlaceholder = regexp.MustCompile(`\{([a-z0-9.-]+)\}`)
+
+// ExpandKey replaces the placeholders {<field path>} of the key with the values
+// of the confg fields, so every graph or node can have its own key.
+// i.e: carisa/workers/{graph-id} or carisa/nodes/{server.id}
+func ExpandKey(key string, confg interface{}) (string, error) {
+	fs, err := fields(confg)
+	if err != nil {
+		return "", err
+	}
+
+	var ferr error
+	res := keyPlaceholder.ReplaceAllStringFunc(key, func(m string) string {
+		path := m[1 : len(m)-1]
+		f, ok := findField(fs, path)
+		if !ok {
+			ferr = errors.New(strings.Concat("the key placeholder does not match any configuration field. Ref: ", path))
+			return m
+		}
+		v := fmt.Sprint(f.value.Interface())
+		if len(v) == 0 {
+			ferr = errors.New(strings.Concat("the key placeholder has no value. Ref: ", path))
+		}
+		return v
+	})
+	if ferr != nil {
+		return "", errors.Wrap(ferr, strings.Concat("cannot expand the key. Key: ", key))
+	}
+	return res, nil
+}
+
+// resolveOverrides applies the json environment variable, the field environment variables and the flags
+func resolveOverrides(layers Layers, confg interface{}, fs []field, sources Sources) error {
+	if len(layers.EnvJSON) > 0 {
+		res, err := read(false, layers.EnvJSON)
+		if err != nil {
+			return err
+		}
+		if err := resolveSource(res, layers.EnvJSON, confg, fs, Env, sources); err != nil {
+			return err
+		}
+	}
+	if len(layers.EnvPrefix) > 0 {
+		for _, f := range fs {
+			name := EnvName(layers.EnvPrefix, f.path)
+			if v, ok := os.LookupEnv(name); ok {
+				v, err := Expand(v)
+				if err != nil {
+					return errors.Wrap(err, strings.Concat("cannot expand the environment variable. Ref: ", name))
+				}
+				if err := setValue(f.value, v); err != nil {
+					return errors.Wrap(err, strings.Concat("cannot set the environment variable. Ref: ", name))
+				}
+				sources[f.path] = Env
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(layers.Flags))
+	for p := range layers.Flags {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		f, ok := findField(fs, p)
+		if !ok {
+			return errors.New(strings.Concat("the flag does not match any configuration field. Ref: ", p))
+		}
+		v, err := Expand(layers.Flags[p])
+		if err != nil {
+			return errors.Wrap(err, strings.Concat("cannot expand the flag. Ref: ", p))
+		}
+		if err := setValue(f.value, v); err != nil {
+			return errors.Wrap(err, strings.Concat("cannot set the flag. Ref: ", p))
+		}
+		sources[p] = Flag
+	}
+
+	return nil
+}
+
+// EnvName returns the environment variable name of the field path
+func EnvName(prefix string, path string) string {
+	name := stds.ToUpper(stds.NewReplacer(".", "_", "-", "_").Replace(path))
+	return strings.Concat(prefix, "_", name)
+}
+
+// Print writes the configuration values and their sources.
+// The values of the secret fields are redacted
+func Print(w io.Writer, confg interface{}, sources Sources) error {
+	fs, err := fields(confg)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tVALUE\tSOURCE")
+	for _, f := range fs {
+		var v interface{} = f.value.Interface()
+		if f.secret && !f.value.IsZero() {
+			v = Redacted
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%s\n", f.path, v, sources[f.path])
+	}
+	return tw.Flush()
+}
+
+// Diff returns the paths of the fields whose values are distinct in both configurations.
+// The configurations must be pointers to the same struct type
+func Diff(a interface{}, b interface{}) ([]string, error) {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return nil, errors.New("the configurations must be of the same type")
+	}
+	fa, err := fields(a)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := fields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var diff []string
+	for i := range fa {
+		if !reflect.DeepEqual(fa[i].value.Interface(), fb[i].value.Interface()) {
+			diff = append(diff, fa[i].path)
+		}
+	}
+	return diff, nil
+}
+
+// Flags are the command line flags of the configuration fields
+type Flags struct {
+	fs     *flag.FlagSet
+	values map[string]*string
+}
+
+// NewFlags defines into fs a flag by each field of confg.
+// The flag name is the field path with dashes. i.e: -server-port
+func NewFlags(fs *flag.FlagSet, confg interface{}) *Flags {
+	fields, err := fields(confg)
+	if err != nil {
+		panic(err)
+	}
+
+	f := &Flags{
+		fs:     fs,
+		values: make(map[string]*string, len(fields)),
+	}
+	for _, field := range fields {
+		f.values[field.path] = fs.String(
+			FlagName(field.path), "", strings.Concat("overrides the configuration field ", field.path))
+	}
+	return f
+}
+
+// FlagName returns the flag name of the field path
+func FlagName(path string) string {
+	return stds.ReplaceAll(path, ".", "-")
+}
+
+// Values returns the values of the flags set in the command line by field path
+func (f *Flags) Values() map[string]string {
+	res := make(map[string]string)
+	f.fs.Visit(func(fl *flag.Flag) {
+		for path, v := range f.values {
+			if FlagName(path) == fl.Name {
+				res[path] = *v
+			}
+		}
+	})
+	return res
+}
+
+// field is a leaf field of the configuration
+type field struct {
+	// path is the field path with kebab case names. i.e: discovery.health.port
+	path string
+	// key is the lower case json path. i.e: discovery.health.port
+	key string
+	// secret is true when the field is tagged with `secret:"true"`
+	secret bool
+	value  reflect.Value
+}
+
+// fields returns the leaf fields of the confg struct following the json names
+func fields(confg interface{}) ([]field, error) {
+	v := reflect.ValueOf(confg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("the configuration must be a pointer to struct")
+	}
+
+	var fs []field
+	walkFields(v.Elem(), "", "", &fs)
+	return fs, nil
+}
+
+func walkFields(v reflect.Value, path string, key string, fs *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if len(sf.PkgPath) > 0 && !sf.Anonymous {
+			continue
+		}
+		name, tagged := jsonName(sf)
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if sf.Anonymous && !tagged && !isLeaf(fv) {
+			walkFields(fv, path, key, fs)
+			continue
+		}
+
+		fpath := joinPath(path, kebab(name))
+		fkey := joinPath(key, stds.ToLower(name))
+		if isLeaf(fv) {
+			*fs = append(*fs, field{path: fpath, key: fkey, secret: sf.Tag.Get("secret") == "true", value: fv})
+			continue
+		}
+		walkFields(fv, fpath, fkey, fs)
+	}
+}
+
+func findField(fs []field, path string) (field, bool) {
+	for _, f := range fs {
+		if f.path == path {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// resolveSource unmarshals the json source and marks the fields found with the source
+func resolveSource(res []byte, ref string, confg interface{}, fs []field, source Source, sources Sources) error {
+	if len(res) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(res, &confg); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot unmarshal the configuration. Ref: ", ref))
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(res, &m); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot unmarshal the configuration. Ref: ", ref))
+	}
+	keys := make(map[string]bool)
+	flattenKeys(m, "", keys)
+	for _, f := range fs {
+		if keys[f.key] {
+			sources[f.path] = source
+		}
+	}
+
+	return nil
+}
+
+// flattenKeys adds the lower case path of every key of m
+func flattenKeys(m map[string]interface{}, prefix string, keys map[string]bool) {
+	for k, v := range m {
+		key := joinPath(prefix, stds.ToLower(k))
+		keys[key] = true
+		if sm, ok := v.(map[string]interface{}); ok {
+			flattenKeys(sm, key, keys)
+		}
+	}
+}
+
+// setValue assigns the text s to the field v.
+// The slices are separated by commas and the maps are key=value pairs separated by commas
+func setValue(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		items := splitList(s)
+		sl := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setValue(sl.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, item := range splitList(s) {
+			kv := stds.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				return errors.New(strings.Concat("the map item must be key=value. Item: ", item))
+			}
+			k := reflect.New(v.Type().Key()).Elem()
+			if err := setValue(k, stds.TrimSpace(kv[0])); err != nil {
+				return err
+			}
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(e, stds.TrimSpace(kv[1])); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, e)
+		}
+		v.Set(m)
+	default:
+		return errors.New(strings.Concat("the field type is not supported. Type: ", v.Type().String()))
+	}
+
+	return nil
+}
+
+func splitList(s string) []string {
+	if len(stds.TrimSpace(s)) == 0 {
+		return []string{}
+	}
+	items := stds.Split(s, ",")
+	for i := range items {
+		items[i] = stds.TrimSpace(items[i])
+	}
+	return items
+}
+
+func jsonName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	name := stds.Split(tag, ",")[0]
+	if len(name) == 0 {
+		return sf.Name, false
+	}
+	return name, true
+}
+
+func isLeaf(v reflect.Value) bool {
+	if _, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return true
+	}
+	return v.Kind() != reflect.Struct
+}
+
+func joinPath(path string, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return strings.Concat(path, ".", name)
+}
+
+// kebab converts a camel case name to kebab case. i.e: graphID -> graph-id
+func kebab(name string) string {
+	rs := []rune(name)
+	var b stds.Builder
+	for i, r := range rs {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := rs[i-1]
+			next := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				b.WriteRune('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
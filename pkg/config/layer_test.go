@@ -0,0 +1,237 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+type LayerServer struct {
+	Port    int `json:",omitempty"`
+	Address string
+}
+
+type LayerCommon struct {
+	Server LayerServer `json:"server,omitempty"`
+}
+
+type LayerConfig struct {
+	GraphID string                   `json:"graphID,omitempty"`
+	Level   zapcore.Level            `json:",omitempty"`
+	Tags    []string                 `json:",omitempty"`
+	Levels  map[string]zapcore.Level `json:",omitempty"`
+	Skip    string                   `json:"-"`
+	LayerCommon
+}
+
+func TestResolve(t *testing.T) {
+	os.Setenv("LAYER_CONFIG_JSON", `{"graphID": "env", "server": {"address": "envjson"}}`)
+	os.Setenv("LAYER_SERVER_PORT", "9090")
+	os.Setenv("LAYER_TAGS", "a, b")
+
+	cnf := LayerConfig{
+		GraphID: "default",
+		Level:   zapcore.InfoLevel,
+		LayerCommon: LayerCommon{
+			Server: LayerServer{
+				Port:    8080,
+				Address: "localhost",
+			},
+		},
+	}
+	sources, err := Resolve(Layers{
+		File:      "./rtest/layer.yaml",
+		EnvJSON:   "LAYER_CONFIG_JSON",
+		EnvPrefix: "LAYER",
+		Flags: map[string]string{
+			"server.address": "flag",
+			"levels":         "discovery=debug,health=error",
+		},
+	}, &cnf)
+
+	if assert.NoError(t, err, "Resolve") {
+		assert.Equal(t, LayerConfig{
+			GraphID: "env",
+			Level:   zapcore.WarnLevel,
+			Tags:    []string{"a", "b"},
+			Levels: map[string]zapcore.Level{
+				"discovery": zapcore.DebugLevel,
+				"health":    zapcore.ErrorLevel,
+			},
+			LayerCommon: LayerCommon{
+				Server: LayerServer{
+					Port:    9090,
+					Address: "flag",
+				},
+			},
+		}, cnf, "Config")
+		assert.Equal(t, Sources{
+			"graph-id":       Env,
+			"level":          File,
+			"tags":           Env,
+			"levels":         Flag,
+			"server.port":    Env,
+			"server.address": Flag,
+		}, sources, "Sources")
+	}
+}
+
+func TestResolve_KV(t *testing.T) {
+	kv := testKV{"carisa/workers/file": `{"graphID": "kv", "level": "error", "server": {"port": 7070}}`}
+
+	cnf := LayerConfig{}
+	sources, err := Resolve(Layers{
+		File:  "./rtest/layer.yaml",
+		Flags: map[string]string{"server.port": "6060"},
+		KV: func() (KVReader, string, error) {
+			return kv, "carisa/workers/{graph-id}", nil
+		},
+	}, &cnf)
+
+	if assert.NoError(t, err, "Resolve") {
+		assert.Equal(t, "kv", cnf.GraphID, "GraphID")
+		assert.Equal(t, zapcore.ErrorLevel, cnf.Level, "Level")
+		assert.Equal(t, 6060, cnf.Server.Port, "Port")
+		assert.Equal(t, KV, sources["graph-id"], "GraphID source")
+		assert.Equal(t, Flag, sources["server.port"], "Port source")
+	}
+
+	_, err = Resolve(Layers{
+		KV: func() (KVReader, string, error) { return nil, "", errors.New("kv") },
+	}, &cnf)
+	assert.Error(t, err, "KV error")
+
+	kv = testKV{"carisa/workers/file": `{"graphID": "${file:/etc/passwd}"}`}
+	_, err = Resolve(Layers{
+		File: "./rtest/layer.yaml",
+		KV:   func() (KVReader, string, error) { return kv, "carisa/workers/{graph-id}", nil },
+	}, &LayerConfig{})
+	assert.Error(t, err, "Secret reference in the store")
+}
+
+func TestExpandKey(t *testing.T) {
+	cnf := LayerConfig{GraphID: "gi", LayerCommon: LayerCommon{Server: LayerServer{Port: 80}}}
+
+	tests := []struct {
+		name      string
+		key       string
+		res       string
+		expectErr bool
+	}{
+		{name: "Without placeholders", key: "carisa/master", res: "carisa/master"},
+		{name: "Graph", key: "carisa/workers/{graph-id}", res: "carisa/workers/gi"},
+		{name: "Node", key: "carisa/nodes/{graph-id}/{server.port}.yaml", res: "carisa/nodes/gi/80.yaml"},
+		{name: "Unknown field", key: "carisa/{unknown}", expectErr: true},
+		{name: "Empty value", key: "carisa/{server.address}", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ExpandKey(tt.key, &cnf)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.res, res)
+			}
+		})
+	}
+}
+
+func TestResolve_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers Layers
+	}{
+		{
+			name:   "Config file not found",
+			layers: Layers{File: "./rtest/co.json"},
+		},
+		{
+			name:   "Unknown flag",
+			layers: Layers{Flags: map[string]string{"unknown": "1"}},
+		},
+		{
+			name:   "Bad flag value",
+			layers: Layers{Flags: map[string]string{"server.port": "port"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Resolve(tt.layers, &LayerConfig{})
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := Resolve(Layers{}, LayerConfig{})
+	assert.Error(t, err, "Not a pointer")
+}
+
+func TestFlags_Values(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := NewFlags(fs, &LayerConfig{})
+	err := fs.Parse([]string{"-server-port", "7070", "-graph-id", "gi"})
+	if assert.NoError(t, err, "Parse") {
+		assert.Equal(t, map[string]string{"server.port": "7070", "graph-id": "gi"}, flags.Values())
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cnf := LayerConfig{GraphID: "gi"}
+	var b bytes.Buffer
+	err := Print(&b, &cnf, Sources{"graph-id": Flag})
+	if assert.NoError(t, err, "Print") {
+		assert.Contains(t, b.String(), "graph-id")
+		assert.Contains(t, b.String(), "gi")
+		assert.Contains(t, b.String(), "flag")
+		assert.NotContains(t, b.String(), "skip")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := LayerConfig{GraphID: "a", Tags: []string{"t"}}
+	b := LayerConfig{GraphID: "b", Tags: []string{"t"}}
+	b.Server.Port = 8080
+
+	diff, err := Diff(&a, &b)
+	if assert.NoError(t, err, "Diff") {
+		assert.Equal(t, []string{"graph-id", "server.port"}, diff)
+	}
+
+	_, err = Diff(&a, &TestConfig{})
+	assert.Error(t, err, "Distinct types")
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "CARISA_DISCOVERY_HEALTH_FAILURES_BEFORE_CRITICAL",
+		EnvName("CARISA", "discovery.health.failures-before-critical"))
+}
+
+func TestKebab(t *testing.T) {
+	assert.Equal(t, "graph-id", kebab("graphID"))
+	assert.Equal(t, "id", kebab("ID"))
+	assert.Equal(t, "failures-before-critical", kebab("FailuresBeforeCritical"))
+	assert.Equal(t, "ca-file", kebab("CAFile"))
+}
@@ -20,38 +20,144 @@ package config
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	stds "strings"
 
 	"encoding/json"
 
+	"github.com/BurntSushi/toml"
 	"github.com/carisa/pkg/strings"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format of the configuration
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+	TOML Format = "toml"
 )
 
 // Read reads the config from file or environment variable.
 // The ref is the file name or the environment variable depending
 // of the file parameter.
-// The result read is assigned to the parameter confg
+// The format of the file is detected by the extension (.yaml, .yml, .toml)
+// and it is json by default. The environment variable is always json.
+// The secret references ${env:VAR} and ${file:/path} of the values are expanded.
+// The result read is assigned to the parameter confg, so the values
+// not found are kept
 func Read(file bool, ref string, confg interface{}) error {
+	res, err := read(file, ref)
+	if err != nil || len(res) == 0 {
+		return err
+	}
+
+	if err := json.Unmarshal(res, &confg); err != nil {
+		return errors.Wrap(err, strings.Concat("cannot unmarshal the configuration. Ref: ", ref))
+	}
+
+	return nil
+}
+
+// read reads the file or environment variable and returns the source in json
+func read(file bool, ref string) ([]byte, error) {
 	var res []byte
+	format := JSON
 
 	if file {
 		var err error
 		res, err = ioutil.ReadFile(ref)
 		if err != nil {
-			return errors.Wrap(err, strings.Concat("cannot read the configuration file. Ref: ", ref))
+			return nil, errors.Wrap(err, strings.Concat("cannot read the configuration file. Ref: ", ref))
 		}
+		format = FileFormat(ref)
 	} else {
 		res = []byte(os.Getenv(ref))
 	}
 
 	if len(res) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	if err := json.Unmarshal(res, &confg); err != nil {
-		return errors.Wrap(err,
-			strings.Concat("cannot unmarshal the configuration. Ref: ", ref, ", Source: ", string(res)))
+	res, err := toJSON(format, res)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			strings.Concat("cannot decode the configuration. Ref: ", ref, ", Format: ", string(format)))
 	}
 
-	return nil
+	return expandSecrets(ref, res)
+}
+
+// KVReader reads the configuration from a key/value store
+type KVReader interface {
+	// Get returns the value of the key or nil if the key does not exist
+	Get(key string) ([]byte, error)
+}
+
+// readKV reads the key of the store and returns the source in json.
+// The secret references are refused because the values of the store are
+// written remotely and they must not read the files or environment of the node
+func readKV(kv KVReader, key string) ([]byte, error) {
+	res, err := kv.Get(key)
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("cannot read the configuration key. Ref: ", key))
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	format := FileFormat(key)
+	res, err = toJSON(format, res)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			strings.Concat("cannot decode the configuration. Ref: ", key, ", Format: ", string(format)))
+	}
+
+	if secretRef.Match(res) {
+		return nil, errors.New(strings.Concat("the secret references are not allowed in the key/value store. Ref: ", key))
+	}
+	return res, nil
+}
+
+func expandSecrets(ref string, res []byte) ([]byte, error) {
+	res, err := expandJSON(res)
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("cannot expand the secrets of the configuration. Ref: ", ref))
+	}
+	return res, nil
+}
+
+// FileFormat returns the format of the file by its extension
+func FileFormat(file string) Format {
+	switch stds.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return YAML
+	case ".toml":
+		return TOML
+	default:
+		return JSON
+	}
+}
+
+// toJSON converts the yaml and toml sources to json so that every format
+// is unmarshaled with the json field names of the config
+func toJSON(format Format, res []byte) ([]byte, error) {
+	var m map[string]interface{}
+
+	switch format {
+	case YAML:
+		if err := yaml.Unmarshal(res, &m); err != nil {
+			return nil, err
+		}
+	case TOML:
+		if err := toml.Unmarshal(res, &m); err != nil {
+			return nil, err
+		}
+	default:
+		return res, nil
+	}
+
+	return json.Marshal(m)
 }
@@ -60,6 +60,48 @@ func TestConfig_Read(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name: "Read a yaml config file",
+			args: args{
+				fichero: true,
+				ref:     "./rtest/config.yaml",
+				confg: TestConfig{
+					A: 2,
+					B: 3,
+				},
+			},
+			expectCnf: TestConfig{
+				A: 1,
+				B: 3,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Read a toml config file",
+			args: args{
+				fichero: true,
+				ref:     "./rtest/config.toml",
+				confg: TestConfig{
+					A: 2,
+					B: 3,
+				},
+			},
+			expectCnf: TestConfig{
+				A: 1,
+				B: 3,
+			},
+			expectErr: false,
+		},
+		{
+			name: "Bad yaml config file",
+			args: args{
+				fichero: true,
+				ref:     "./rtest/bad.yml",
+				confg:   TestConfig{},
+			},
+			expectCnf: TestConfig{},
+			expectErr: true,
+		},
 		{
 			name: "Read a environment variable",
 			args: args{
@@ -116,3 +158,21 @@ func TestConfig_Read(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_FileFormat(t *testing.T) {
+	assert.Equal(t, YAML, FileFormat("config.yaml"), "yaml")
+	assert.Equal(t, YAML, FileFormat("config.YML"), "yml")
+	assert.Equal(t, TOML, FileFormat("config.toml"), "toml")
+	assert.Equal(t, JSON, FileFormat("config.json"), "json")
+	assert.Equal(t, JSON, FileFormat("config"), "without extension")
+}
+
+type testKV map[string]string
+
+func (kv testKV) Get(key string) ([]byte, error) {
+	v, ok := kv[key]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(v), nil
+}
@@ -0,0 +1,168 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	stds "strings"
+
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// Redacted replaces the value of the secret fields
+const Redacted = "******"
+
+// secretRef matches the secret references: ${env:VAR} and ${file:/run/secrets/token}
+var secretRef = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// Expand replaces the secret references of the value. ${env:VAR} is replaced
+// by the environment variable and ${file:/path} by the content of the file
+// without the trailing new lines
+func Expand(value string) (string, error) {
+	var rerr error
+	res := secretRef.ReplaceAllStringFunc(value, func(ref string) string {
+		m := secretRef.FindStringSubmatch(ref)
+		switch m[1] {
+		case "env":
+			v, ok := os.LookupEnv(m[2])
+			if !ok {
+				rerr = errors.New(strings.Concat("the environment variable of the secret is not defined. Ref: ", m[2]))
+			}
+			return v
+		default:
+			v, err := ioutil.ReadFile(filepath.Clean(m[2]))
+			if err != nil {
+				rerr = errors.Wrap(err, strings.Concat("cannot read the file of the secret. Ref: ", m[2]))
+			}
+			return stds.TrimRight(string(v), "\r\n")
+		}
+	})
+	if rerr != nil {
+		return "", rerr
+	}
+	return res, nil
+}
+
+// expandJSON replaces the secret references of every string of the json source
+func expandJSON(res []byte) ([]byte, error) {
+	if !bytes.Contains(res, []byte("${")) {
+		return res, nil
+	}
+
+	v, err := unmarshalJSON(res)
+	if err != nil {
+		return nil, err
+	}
+	v, err = expandValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// unmarshalJSON decodes the json keeping the numbers as json.Number,
+// so the integers are not converted to float64 and they keep their precision
+func unmarshalJSON(res []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(res))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func expandValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return Expand(t)
+	case map[string]interface{}:
+		for k, e := range t {
+			ev, err := expandValue(e)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = ev
+		}
+	case []interface{}:
+		for i, e := range t {
+			ev, err := expandValue(e)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = ev
+		}
+	}
+	return v, nil
+}
+
+// Redact returns the json of the configuration with the value of
+// the secret fields replaced. The secret fields are tagged with `secret:"true"`
+func Redact(confg interface{}) string {
+	r, err := json.Marshal(confg)
+	if err != nil {
+		return ""
+	}
+	fs, err := fields(confg)
+	if err != nil {
+		return string(r)
+	}
+
+	secrets := make(map[string]bool)
+	for _, f := range fs {
+		if f.secret {
+			secrets[f.key] = true
+		}
+	}
+	if len(secrets) == 0 {
+		return string(r)
+	}
+
+	v, err := unmarshalJSON(r)
+	if err != nil {
+		return ""
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return string(r)
+	}
+	redactKeys(m, "", secrets)
+	r, _ = json.Marshal(m)
+	return string(r)
+}
+
+func redactKeys(m map[string]interface{}, prefix string, secrets map[string]bool) {
+	for k, v := range m {
+		key := joinPath(prefix, stds.ToLower(k))
+		if secrets[key] {
+			if v != nil && v != "" {
+				m[k] = Redacted
+			}
+			continue
+		}
+		if sm, ok := v.(map[string]interface{}); ok {
+			redactKeys(sm, key, secrets)
+		}
+	}
+}
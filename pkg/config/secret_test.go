@@ -0,0 +1,134 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SecretAuth struct {
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty" secret:"true"`
+}
+
+type SecretConfig struct {
+	Token string     `json:"token,omitempty" secret:"true"`
+	Size  int64      `json:"size,omitempty"`
+	Empty string     `json:"empty" secret:"true"`
+	Auth  SecretAuth `json:"auth"`
+}
+
+func TestExpand(t *testing.T) {
+	os.Setenv("SECRET_TOKEN", "tk")
+	file := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("pwd\n"), 0600))
+
+	tests := []struct {
+		name  string
+		value string
+		res   string
+		err   bool
+	}{
+		{
+			name:  "Without references",
+			value: "value",
+			res:   "value",
+		},
+		{
+			name:  "Environment variable",
+			value: "Bearer ${env:SECRET_TOKEN}",
+			res:   "Bearer tk",
+		},
+		{
+			name:  "File",
+			value: "${file:" + file + "}",
+			res:   "pwd",
+		},
+		{
+			name:  "Environment variable not defined",
+			value: "${env:SECRET_NOT_DEFINED}",
+			err:   true,
+		},
+		{
+			name:  "File not found",
+			value: "${file:/not/found}",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Expand(tt.value)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.res, res)
+			}
+		})
+	}
+}
+
+func TestRead_Secrets(t *testing.T) {
+	os.Setenv("SECRET_CONFIG_JSON", `{"token": "${env:SECRET_TOKEN}", "auth": {"password": "${env:SECRET_TOKEN}"}}`)
+	os.Setenv("SECRET_TOKEN", "tk")
+
+	var cnf SecretConfig
+	if assert.NoError(t, Read(false, "SECRET_CONFIG_JSON", &cnf)) {
+		assert.Equal(t, "tk", cnf.Token, "Token")
+		assert.Equal(t, "tk", cnf.Auth.Password, "Password")
+	}
+
+	_, err := Resolve(Layers{Flags: map[string]string{"token": "${env:SECRET_NOT_DEFINED}"}}, &cnf)
+	assert.Error(t, err, "Flag not expanded")
+}
+
+func TestRead_Secrets_Numbers(t *testing.T) {
+	os.Setenv("SECRET_CONFIG_JSON", `{"token": "${env:SECRET_TOKEN}", "size": 9007199254740993}`)
+	os.Setenv("SECRET_TOKEN", "tk")
+
+	var cnf SecretConfig
+	if assert.NoError(t, Read(false, "SECRET_CONFIG_JSON", &cnf)) {
+		assert.Equal(t, int64(9007199254740993), cnf.Size, "Integer above 2^53")
+	}
+
+	assert.Equal(t, `{"auth":{},"empty":"","size":9007199254740993,"token":"******"}`, Redact(&cnf), "Redacted number")
+}
+
+func TestRedact(t *testing.T) {
+	cnf := SecretConfig{
+		Token: "tk",
+		Auth: SecretAuth{
+			User:     "user",
+			Password: "pwd",
+		},
+	}
+	assert.Equal(t, `{"auth":{"password":"******","user":"user"},"empty":"","token":"******"}`, Redact(&cnf))
+
+	var b bytes.Buffer
+	if assert.NoError(t, Print(&b, &cnf, Sources{})) {
+		assert.NotContains(t, b.String(), "pwd", "Password")
+		assert.Contains(t, b.String(), "user", "User")
+	}
+}
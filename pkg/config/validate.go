@@ -0,0 +1,70 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	stds "strings"
+
+	"github.com/carisa/pkg/strings"
+)
+
+// Violation is a problem found in a configuration field
+type Violation struct {
+	// Field is the field path. i.e: server.port
+	Field string
+	// Message describes the problem
+	Message string
+}
+
+// ValidationError aggregates every problem found validating a configuration
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = strings.Concat(v.Field, ": ", v.Message)
+	}
+	return strings.Concat("the configuration is not valid. ", stds.Join(msgs, "; "))
+}
+
+// Validator collects the violations of a configuration
+type Validator struct {
+	violations []Violation
+}
+
+// Check adds a violation of the field when the condition is false
+func (v *Validator) Check(cond bool, field string, message string) {
+	if !cond {
+		v.violations = append(v.violations, Violation{Field: field, Message: message})
+	}
+}
+
+// CheckPort adds a violation of the field when the port is out of range
+func (v *Validator) CheckPort(port int, field string) {
+	v.Check(port > 0 && port <= 65535, field, "the port must be between 1 and 65535")
+}
+
+// Err returns a ValidationError with every violation or nil if there are no violations
+func (v *Validator) Err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: v.violations}
+}
@@ -0,0 +1,49 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator_Err(t *testing.T) {
+	var v Validator
+	assert.NoError(t, v.Err(), "Without violations")
+
+	v.Check(true, "server.id", "the id cannot be empty")
+	v.Check(false, "server.address", "the address cannot be empty")
+	v.CheckPort(70000, "server.port")
+	v.CheckPort(8080, "discovery.health.port")
+
+	err := v.Err()
+	if assert.Error(t, err, "With violations") {
+		verr, ok := err.(*ValidationError)
+		if assert.True(t, ok, "Validation error") {
+			assert.Equal(t, []Violation{
+				{Field: "server.address", Message: "the address cannot be empty"},
+				{Field: "server.port", Message: "the port must be between 1 and 65535"},
+			}, verr.Violations, "Violations")
+		}
+		assert.Equal(t,
+			"the configuration is not valid. server.address: the address cannot be empty; "+
+				"server.port: the port must be between 1 and 65535",
+			err.Error(), "Message")
+	}
+}
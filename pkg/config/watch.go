@@ -0,0 +1,129 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Watcher notifies when the configuration must be reloaded: the config
+// file or the key/value store key is modified or the process receives a SIGHUP signal
+type Watcher struct {
+	file     string
+	kv       KVReader
+	key      string
+	interval time.Duration
+	changes  chan struct{}
+	quit     chan struct{}
+}
+
+// NewWatcher creates a watcher that checks the file modification every interval.
+// The file is not checked when it is empty
+func NewWatcher(file string, interval time.Duration) *Watcher {
+	return &Watcher{
+		file:     file,
+		interval: interval,
+		changes:  make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Changes returns the channel that receives the reload notifications
+func (w *Watcher) Changes() <-chan struct{} {
+	return w.changes
+}
+
+// WatchKV makes the watcher check the value of the key every interval.
+// It must be called before Run
+func (w *Watcher) WatchKV(kv KVReader, key string) {
+	w.kv = kv
+	w.key = key
+}
+
+// Run starts watching the file, the key and the SIGHUP signal
+func (w *Watcher) Run() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(w.interval)
+	mod := w.modTime()
+	value, _ := w.value()
+
+	go func() {
+		defer ticker.Stop()
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-w.quit:
+				return
+			case <-hup:
+				w.notify()
+			case <-ticker.C:
+				if m := w.modTime(); !m.Equal(mod) {
+					mod = m
+					w.notify()
+				}
+				// The value is kept when the store cannot be read
+				if v, ok := w.value(); ok && !bytes.Equal(v, value) {
+					value = v
+					w.notify()
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops watching
+func (w *Watcher) Stop() {
+	close(w.quit)
+}
+
+// notify does not block when there is a pending notification
+func (w *Watcher) notify() {
+	select {
+	case w.changes <- struct{}{}:
+	default:
+	}
+}
+
+func (w *Watcher) modTime() time.Time {
+	if len(w.file) == 0 {
+		return time.Time{}
+	}
+	info, err := os.Stat(w.file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// value reads the key. It returns false when there is no key or it cannot be read
+func (w *Watcher) value() ([]byte, bool) {
+	if w.kv == nil {
+		return nil, false
+	}
+	v, err := w.kv.Get(w.key)
+	if err != nil {
+		return nil, false
+	}
+	return v, true
+}
@@ -0,0 +1,102 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher_File(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`{"a": 1}`), 0600))
+
+	w := NewWatcher(file, 10*time.Millisecond)
+	w.Run()
+	defer w.Stop()
+
+	mod := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(file, mod, mod))
+
+	select {
+	case <-w.Changes():
+	case <-time.After(time.Second):
+		t.Error("The file change was not notified")
+	}
+}
+
+func TestWatcher_KV(t *testing.T) {
+	kv := &syncKV{values: testKV{"carisa/workers/gi": `{"a": 1}`}}
+
+	w := NewWatcher("", 10*time.Millisecond)
+	w.WatchKV(kv, "carisa/workers/gi")
+	w.Run()
+	defer w.Stop()
+
+	select {
+	case <-w.Changes():
+		t.Error("The key has not changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	kv.set("carisa/workers/gi", `{"a": 2}`)
+	select {
+	case <-w.Changes():
+	case <-time.After(time.Second):
+		t.Error("The key change was not notified")
+	}
+}
+
+// syncKV is a key/value store that can be changed while it is watched
+type syncKV struct {
+	mu     sync.Mutex
+	values testKV
+}
+
+func (kv *syncKV) Get(key string) ([]byte, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.values.Get(key)
+}
+
+func (kv *syncKV) set(key string, value string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.values[key] = value
+}
+
+func TestWatcher_SIGHUP(t *testing.T) {
+	w := NewWatcher("", time.Hour)
+	w.Run()
+	defer w.Stop()
+
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+	select {
+	case <-w.Changes():
+	case <-time.After(time.Second):
+		t.Error("The signal was not notified")
+	}
+}
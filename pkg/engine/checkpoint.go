@@ -0,0 +1,223 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package engine
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// ErrCheckpointMismatch is returned when the checkpoint was taken by another program or other codecs
+var ErrCheckpointMismatch = errors.New("the checkpoint does not match the program")
+
+// checkpointMagic starts the checkpoints and checkpointVersion is the version of their format
+const (
+	checkpointMagic   = "carisa-checkpoint"
+	checkpointVersion = 1
+)
+
+// EncodeCheckpoint encodes the checkpoint of the program. The header has the format version,
+// the program name and the codec names, so a checkpoint is only resumed by the same program.
+// The body has the superstep, the vertices, the aggregated values and the messages
+// sorted by name, so the same checkpoint is always encoded in the same way
+func EncodeCheckpoint(p compute.RawProgram, c Checkpoint) []byte {
+	dst := appendString(nil, checkpointMagic)
+	dst = appendInt(dst, checkpointVersion)
+	for _, name := range header(p) {
+		dst = appendString(dst, name)
+	}
+
+	dst = appendInt(dst, c.Superstep)
+	dst = appendInt(dst, len(c.Vertices))
+	for _, v := range c.Vertices {
+		dst = appendString(dst, v.ID)
+		dst = appendBytes(dst, v.Value)
+		dst = appendInt(dst, len(v.Edges))
+		for _, e := range v.Edges {
+			dst = appendString(dst, e.Target)
+			dst = appendBytes(dst, e.Value)
+		}
+		halted := 0
+		if v.Halted {
+			halted = 1
+		}
+		dst = appendInt(dst, halted)
+	}
+
+	names := make([]string, 0, len(c.Aggregated))
+	for name := range c.Aggregated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	dst = appendInt(dst, len(names))
+	for _, name := range names {
+		dst = appendString(dst, name)
+		dst = appendBytes(dst, c.Aggregated[name])
+	}
+
+	ids := make([]string, 0, len(c.Messages))
+	for id := range c.Messages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	dst = appendInt(dst, len(ids))
+	for _, id := range ids {
+		dst = appendString(dst, id)
+		dst = appendInt(dst, len(c.Messages[id]))
+		for _, m := range c.Messages[id] {
+			dst = appendBytes(dst, m)
+		}
+	}
+	return dst
+}
+
+// DecodeCheckpoint decodes the checkpoint of the program. It returns ErrCheckpointMismatch
+// when the program name or the codec names of the header are not the ones of the program
+func DecodeCheckpoint(p compute.RawProgram, src []byte) (Checkpoint, error) {
+	r := &reader{src: src}
+	if magic := r.string(); r.err == nil && magic != checkpointMagic {
+		return Checkpoint{}, errors.New("the data is not a checkpoint")
+	}
+	if version := r.int(); r.err == nil && version != checkpointVersion {
+		return Checkpoint{}, errors.New(strings.Concat("the checkpoint version is not supported. Version: ", strconv.Itoa(version)))
+	}
+	for i, name := range header(p) {
+		if found := r.string(); r.err == nil && found != name {
+			return Checkpoint{}, errors.Wrap(ErrCheckpointMismatch,
+				strings.Concat(headerFields[i], ": ", found, ". Expected: ", name))
+		}
+	}
+
+	c := Checkpoint{Superstep: r.int()}
+	for n := r.len(); n > 0; n-- {
+		v := Vertex{ID: r.string(), Value: r.bytes()}
+		for e := r.len(); e > 0; e-- {
+			v.Edges = append(v.Edges, compute.Edge[[]byte]{Target: r.string(), Value: r.bytes()})
+		}
+		v.Halted = r.int() == 1
+		c.Vertices = append(c.Vertices, v)
+	}
+	c.Aggregated = make(map[string][]byte)
+	for n := r.len(); n > 0; n-- {
+		name := r.string()
+		c.Aggregated[name] = r.bytes()
+	}
+	c.Messages = make(map[string][][]byte)
+	for n := r.len(); n > 0; n-- {
+		id := r.string()
+		for m := r.len(); m > 0; m-- {
+			c.Messages[id] = append(c.Messages[id], r.bytes())
+		}
+	}
+
+	if r.err != nil {
+		return Checkpoint{}, errors.Wrap(r.err, "cannot decode the checkpoint")
+	}
+	if len(r.src) > 0 {
+		return Checkpoint{}, errors.New(strings.Concat(
+			"the checkpoint has ", strconv.Itoa(len(r.src)), " bytes after the messages"))
+	}
+	return c, nil
+}
+
+// headerFields are the names of the header values returned by header
+var headerFields = []string{"Program", "Vertex codec", "Edge codec", "Message codec"}
+
+func header(p compute.RawProgram) []string {
+	vertex, edge, message := p.Codecs()
+	return []string{p.Name(), vertex, edge, message}
+}
+
+func appendString(dst []byte, v string) []byte {
+	dst, _ = codec.String{}.Append(dst, v)
+	return dst
+}
+
+func appendBytes(dst []byte, v []byte) []byte {
+	dst, _ = codec.Bytes{}.Append(dst, v)
+	return dst
+}
+
+func appendInt(dst []byte, v int) []byte {
+	dst, _ = codec.Int64{}.Append(dst, int64(v))
+	return dst
+}
+
+// reader decodes the values of a checkpoint. The first error is kept and
+// the values read after it are zero
+type reader struct {
+	src []byte
+	err error
+}
+
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	v, n, err := codec.String{}.Decode(r.src)
+	r.next(n, err)
+	return v
+}
+
+// bytes returns nil for the empty values, like the values of the empty codec before they are encoded
+func (r *reader) bytes() []byte {
+	if r.err != nil {
+		return nil
+	}
+	v, n, err := codec.Bytes{}.Decode(r.src)
+	r.next(n, err)
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (r *reader) int() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n, err := codec.Int64{}.Decode(r.src)
+	r.next(n, err)
+	return int(v)
+}
+
+// len reads the number of elements. It is not trusted beyond the data left,
+// because every element takes one byte at least
+func (r *reader) len() int {
+	l := r.int()
+	if r.err == nil && (l < 0 || l > len(r.src)) {
+		r.err = errors.New(strings.Concat("the number of elements is not valid. Elements: ", strconv.Itoa(l)))
+	}
+	if r.err != nil {
+		return 0
+	}
+	return l
+}
+
+func (r *reader) next(n int, err error) {
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.src = r.src[n:]
+}
@@ -0,0 +1,83 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package engine
+
+import (
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint_Encode(t *testing.T) {
+	vs := chain(t, 5)
+	vs[4].Edges = []compute.Edge[[]byte]{{Target: "0"}}
+	rec := &recorder{}
+	res, err := New(log.TestLogger(), 2, NewLoopback()).Run(make(chan struct{}), Job{Program: maxValue, Observer: rec, CheckpointInterval: 2}, vs)
+	if !assert.NoError(t, err, "Run") || !assert.NotEmpty(t, rec.checkpoints, "Checkpoints") {
+		return
+	}
+	c := rec.checkpoints[0]
+	c.Aggregated["b"] = []byte{1}
+	c.Aggregated["a"] = []byte{2}
+
+	raw := EncodeCheckpoint(maxValue, c)
+	assert.Equal(t, raw, EncodeCheckpoint(maxValue, c), "Same encoding")
+	d, err := DecodeCheckpoint(maxValue, raw)
+	if !assert.NoError(t, err, "Decode") {
+		return
+	}
+	assert.Equal(t, c.Superstep, d.Superstep, "Superstep")
+	assert.Equal(t, c.Aggregated, d.Aggregated, "Aggregated")
+	assert.Equal(t, c.Messages, d.Messages, "Messages")
+	assert.Len(t, d.Vertices, len(c.Vertices), "Vertices")
+
+	delete(d.Aggregated, "a")
+	delete(d.Aggregated, "b")
+	resumed, err := New(log.TestLogger(), 3, NewLoopback()).Resume(make(chan struct{}), Job{Program: maxValue}, d)
+	if assert.NoError(t, err, "Resume") {
+		assert.Equal(t, res, resumed, "Same result")
+	}
+}
+
+func TestCheckpoint_Decode_Errors(t *testing.T) {
+	raw := EncodeCheckpoint(maxValue, Checkpoint{Superstep: 1, Vertices: chain(t, 2)})
+
+	other := compute.Bind[int64, struct{}, int64]("other", compute.Compute[int64, struct{}, int64](
+		func(compute.Context[int64, struct{}, int64], []int64) error { return nil }),
+		compute.Codecs[int64, struct{}, int64]{Vertex: codec.Int64{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+	_, err := DecodeCheckpoint(other, raw)
+	assert.ErrorIs(t, err, ErrCheckpointMismatch, "Other program")
+
+	codecs := compute.Bind[[]byte, struct{}, int64]("max", compute.Compute[[]byte, struct{}, int64](
+		func(compute.Context[[]byte, struct{}, int64], []int64) error { return nil }),
+		compute.Codecs[[]byte, struct{}, int64]{Vertex: codec.Bytes{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+	_, err = DecodeCheckpoint(codecs, raw)
+	assert.ErrorIs(t, err, ErrCheckpointMismatch, "Other vertex codec")
+
+	_, err = DecodeCheckpoint(maxValue, []byte(`{"Superstep": 1}`))
+	assert.Error(t, err, "Not a checkpoint")
+	for i := 0; i < len(raw); i++ {
+		_, err = DecodeCheckpoint(maxValue, raw[:i])
+		assert.Error(t, err, "Partial checkpoint")
+	}
+	_, err = DecodeCheckpoint(maxValue, append(raw, 0))
+	assert.Error(t, err, "Trailing data")
+}
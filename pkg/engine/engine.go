@@ -0,0 +1,629 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+// Package engine runs the vertex programs in bulk synchronous supersteps.
+// The graph is split in partitions that compute in parallel and exchange
+// the messages and the mutations through a transport at the barrier of every superstep
+package engine
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ErrStopped is returned when the job is stopped before the end
+var ErrStopped = errors.New("the job has been stopped")
+
+// Vertex is a vertex of the graph with the encoded values
+type Vertex struct {
+	// ID identifies the vertex
+	ID string
+	// Value is the encoded vertex value
+	Value []byte
+	// Edges are the out edges with the encoded edge values
+	Edges []compute.Edge[[]byte]
+	// Halted is true when the vertex has voted to halt
+	Halted bool
+}
+
+// Job is a vertex program and the options of its run
+type Job struct {
+	// Program is the vertex program
+	Program compute.RawProgram
+	// Master is the master compute. It is optional
+	Master compute.Master
+	// Aggregators are the aggregators of the program
+	Aggregators []compute.RawAggregator
+	// Combiner combines the messages sent to the same vertex. It is optional
+	Combiner compute.RawCombiner
+	// MaxSupersteps ends the job after the supersteps. 0 is no limit
+	MaxSupersteps int
+	// Conflicts resolves the mutations of the same vertex in a superstep
+	Conflicts Conflicts
+	// Observer is notified of the progress of the job. It is optional
+	Observer Observer
+	// CheckpointInterval takes a checkpoint every the supersteps. 0 takes no checkpoint.
+	// The checkpoints are passed to the observer
+	CheckpointInterval int
+}
+
+// Observer is notified of the progress of a job
+type Observer interface {
+	// Started is called before the superstep runs
+	Started(superstep int)
+	// Completed is called after the barrier of the superstep with its counters
+	Completed(s Stats)
+	// Checkpoint is called with the checkpoint taken after a superstep. The job fails when it returns an error
+	Checkpoint(c Checkpoint) error
+}
+
+// Checkpoint is the state of a job between two supersteps. The job can be resumed from it
+type Checkpoint struct {
+	// Superstep is the next superstep to run
+	Superstep int
+	// Vertices are the vertices sorted by id
+	Vertices []Vertex
+	// Aggregated are the encoded values of the aggregators
+	Aggregated map[string][]byte
+	// Messages are the encoded messages by target vertex received in the next superstep
+	Messages map[string][][]byte
+}
+
+// Stats are the counters of a superstep
+type Stats struct {
+	// Superstep is the superstep number. The first one is 0
+	Superstep int
+	// Computed is the number of vertices computed
+	Computed int64
+	// Active is the number of vertices that have not voted to halt
+	Active int64
+	// Messages is the number of messages sent
+	Messages int64
+	// Dropped is the number of messages received by vertices that do not exist
+	Dropped int64
+	// Mutations is the number of mutations requested
+	Mutations int64
+}
+
+func (s *Stats) add(o Stats) {
+	s.Computed += o.Computed
+	s.Active += o.Active
+	s.Messages += o.Messages
+	s.Dropped += o.Dropped
+	s.Mutations += o.Mutations
+}
+
+// Result is the graph when the job ends
+type Result struct {
+	// Supersteps is the number of supersteps run
+	Supersteps int
+	// Vertices are the vertices sorted by id
+	Vertices []Vertex
+	// Aggregated are the encoded values of the aggregators reduced in the last superstep
+	Aggregated map[string][]byte
+}
+
+// Engine runs the jobs over the partitions of the process. It runs a job at a time
+type Engine struct {
+	log        *zap.Logger
+	partitions int
+	transport  Transport
+	mu         sync.Mutex
+}
+
+// New creates an engine of the number of partitions. The partitions exchange the messages through the transport
+func New(log *zap.Logger, partitions int, transport Transport) *Engine {
+	if partitions <= 0 {
+		partitions = 1
+	}
+	return &Engine{
+		log:        log,
+		partitions: partitions,
+		transport:  transport,
+	}
+}
+
+// Partitions returns the number of partitions
+func (e *Engine) Partitions() int {
+	return e.partitions
+}
+
+// Run runs the job over the vertices until every vertex has voted to halt and there are
+// no messages, the max supersteps are reached or stop is closed
+func (e *Engine) Run(stop <-chan struct{}, job Job, vertices []Vertex) (Result, error) {
+	return e.Resume(stop, job, Checkpoint{Vertices: vertices})
+}
+
+// Resume runs the job from the checkpoint like Run. The checkpoint can be
+// taken by an engine of a different number of partitions
+func (e *Engine) Resume(stop <-chan struct{}, job Job, c Checkpoint) (Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.drain()
+
+	parts, err := e.load(c.Vertices)
+	if err != nil {
+		return Result{}, err
+	}
+	for id, ms := range c.Messages {
+		p := parts[PartitionOf(id, e.partitions)]
+		if len(p.batches) == 0 {
+			p.batches = []Batch{{Messages: make(map[string][][]byte)}}
+		}
+		p.batches[0].Messages[id] = ms
+	}
+	aggs, err := aggregators(job.Aggregators)
+	if err != nil {
+		return Result{}, err
+	}
+
+	values := make(map[string][]byte, len(c.Aggregated))
+	for name, v := range c.Aggregated {
+		values[name] = v
+	}
+	step := c.Superstep
+	for ; job.MaxSupersteps == 0 || step < job.MaxSupersteps; step++ {
+		select {
+		case <-stop:
+			return Result{}, ErrStopped
+		default:
+		}
+
+		count := size(parts)
+		if job.Master != nil {
+			mctx := &masterContext{step: step, vertices: count, values: values}
+			if err := job.Master.Compute(mctx); err != nil {
+				return Result{}, errors.Wrap(err, strings.Concat("the master compute failed. Superstep: ", strconv.Itoa(step)))
+			}
+			if mctx.halted {
+				break
+			}
+		}
+		if job.Observer != nil {
+			job.Observer.Started(step)
+		}
+
+		st := superstep{step: step, vertices: count, aggregators: aggs, values: values, combiner: job.Combiner}
+		stats, partials, err := e.superstep(job, parts, st)
+		if err != nil {
+			return Result{}, err
+		}
+		if values, err = reduce(job.Aggregators, values, partials); err != nil {
+			return Result{}, err
+		}
+		e.log.Debug(
+			"Superstep completed",
+			zap.String("Program", job.Program.Name()),
+			zap.Int("Superstep", step),
+			zap.Int64("Computed", stats.Computed),
+			zap.Int64("Active", stats.Active),
+			zap.Int64("Messages", stats.Messages),
+			zap.Int64("Mutations", stats.Mutations))
+		if job.Observer != nil {
+			job.Observer.Completed(stats)
+		}
+
+		if stats.Active == 0 && stats.Messages == 0 {
+			step++
+			break
+		}
+		if job.Observer != nil && job.CheckpointInterval > 0 && (step+1)%job.CheckpointInterval == 0 {
+			if err := job.Observer.Checkpoint(checkpoint(parts, step+1, values)); err != nil {
+				return Result{}, errors.Wrap(err, strings.Concat("the checkpoint cannot be taken. Superstep: ", strconv.Itoa(step)))
+			}
+		}
+	}
+
+	return Result{Supersteps: step, Vertices: collect(parts), Aggregated: values}, nil
+}
+
+// superstep is the state shared by the partitions in a superstep. It is read only
+type superstep struct {
+	step        int
+	vertices    int64
+	aggregators map[string]compute.RawAggregator
+	values      map[string][]byte
+	combiner    compute.RawCombiner
+}
+
+func aggregators(list []compute.RawAggregator) (map[string]compute.RawAggregator, error) {
+	aggs := make(map[string]compute.RawAggregator, len(list))
+	for _, a := range list {
+		if _, ok := aggs[a.Name()]; ok {
+			return nil, errors.New(strings.Concat("the aggregator is duplicated. Aggregator: ", a.Name()))
+		}
+		aggs[a.Name()] = a
+	}
+	return aggs, nil
+}
+
+// reduce reduces the values of the partitions in partition order. The persistent
+// aggregators start from the previous value and the regular ones from nothing
+func reduce(list []compute.RawAggregator, prev map[string][]byte, partials []map[string][]byte) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(list))
+	for _, a := range list {
+		var acc []byte
+		if a.Persistent() {
+			acc = prev[a.Name()]
+		}
+		for _, partial := range partials {
+			v, ok := partial[a.Name()]
+			if !ok {
+				continue
+			}
+			if acc == nil {
+				acc = v
+				continue
+			}
+			var err error
+			if acc, err = a.Reduce(acc, v); err != nil {
+				return nil, errors.Wrap(err, strings.Concat("cannot reduce the aggregator ", a.Name()))
+			}
+		}
+		if acc != nil {
+			values[a.Name()] = acc
+		}
+	}
+	return values, nil
+}
+
+// drain removes the messages left by a job that has not ended, so the next job does not receive them
+func (e *Engine) drain() {
+	for i := 0; i < e.partitions; i++ {
+		_, _ = e.transport.Receive(i)
+	}
+}
+
+// load splits the vertices in partitions
+func (e *Engine) load(vertices []Vertex) ([]*partition, error) {
+	parts := make([]*partition, e.partitions)
+	for i := range parts {
+		parts[i] = &partition{
+			id:       i,
+			vertices: make(map[string]*vertex),
+		}
+	}
+	for _, v := range vertices {
+		p := parts[PartitionOf(v.ID, e.partitions)]
+		if _, ok := p.vertices[v.ID]; ok {
+			return nil, errors.New(strings.Concat("the vertex is duplicated. Vertex: ", v.ID))
+		}
+		p.vertices[v.ID] = &vertex{id: v.ID, value: v.Value, edges: v.Edges, halted: v.Halted}
+		p.ids = append(p.ids, v.ID)
+	}
+	for _, p := range parts {
+		sort.Strings(p.ids)
+	}
+	return parts, nil
+}
+
+// superstep computes every partition in parallel and sends the messages and the mutations
+// at the barrier, where every partition applies its mutations. It returns the values aggregated
+// by every partition. The vertices added are active
+func (e *Engine) superstep(job Job, parts []*partition, step superstep) (Stats, []map[string][]byte, error) {
+	outs := make([]output, len(parts))
+	partials := make([]map[string][]byte, len(parts))
+	stats := make([]Stats, len(parts))
+	errs := make([]error, len(parts))
+
+	var wg sync.WaitGroup
+	wg.Add(len(parts))
+	for i, p := range parts {
+		go func(i int, p *partition) {
+			defer wg.Done()
+			outs[i], stats[i], errs[i] = p.compute(job, step, len(parts))
+			partials[i] = outs[i].partial
+		}(i, p)
+	}
+	wg.Wait()
+
+	total := Stats{Superstep: step.step}
+	for i := range parts {
+		if errs[i] != nil {
+			return Stats{}, nil, errs[i]
+		}
+		total.add(stats[i])
+	}
+
+	// The barrier: every partition has computed, so the messages and the mutations can be delivered
+	for from, out := range outs {
+		for to := range parts {
+			b := Batch{From: from, Messages: out.messages[to], Mutations: out.mutations[to]}
+			if len(b.Messages) == 0 && len(b.Mutations) == 0 {
+				continue
+			}
+			if err := e.transport.Send(to, b); err != nil {
+				return Stats{}, nil, errors.Wrap(err, strings.Concat("cannot send the messages to the partition ", strconv.Itoa(to)))
+			}
+		}
+	}
+
+	added := make([]int64, len(parts))
+	wg.Add(len(parts))
+	for i, p := range parts {
+		go func(i int, p *partition) {
+			defer wg.Done()
+			added[i], errs[i] = p.receive(e.transport, job.Conflicts)
+		}(i, p)
+	}
+	wg.Wait()
+	for i := range parts {
+		if errs[i] != nil {
+			return Stats{}, nil, errs[i]
+		}
+		total.Active += added[i]
+	}
+	return total, partials, nil
+}
+
+// size returns the number of vertices of the partitions
+func size(parts []*partition) int64 {
+	n := int64(0)
+	for _, p := range parts {
+		n += int64(len(p.ids))
+	}
+	return n
+}
+
+func collect(parts []*partition) []Vertex {
+	var res []Vertex
+	for _, p := range parts {
+		for _, id := range p.ids {
+			v := p.vertices[id]
+			res = append(res, Vertex{ID: v.id, Value: v.value, Edges: v.edges, Halted: v.halted})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// checkpoint returns the state of the partitions before the superstep. The messages
+// received are kept in the order of the sender partitions
+func checkpoint(parts []*partition, step int, values map[string][]byte) Checkpoint {
+	c := Checkpoint{
+		Superstep:  step,
+		Vertices:   collect(parts),
+		Aggregated: make(map[string][]byte, len(values)),
+		Messages:   make(map[string][][]byte),
+	}
+	for name, v := range values {
+		c.Aggregated[name] = v
+	}
+	for _, p := range parts {
+		for _, b := range p.batches {
+			for id, ms := range b.Messages {
+				c.Messages[id] = append(c.Messages[id], ms...)
+			}
+		}
+	}
+	return c
+}
+
+// PartitionOf returns the partition of the vertex. It is the fnv-1a hash of the id
+func PartitionOf(id string, partitions int) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return int(h % uint32(partitions))
+}
+
+type vertex struct {
+	id     string
+	value  []byte
+	edges  []compute.Edge[[]byte]
+	halted bool
+}
+
+// partition keeps its vertices sorted by id, so the runs are repeatable
+type partition struct {
+	id       int
+	vertices map[string]*vertex
+	ids      []string
+	// batches are the batches received at the barrier. The messages are delivered in the next superstep
+	batches []Batch
+}
+
+// output are the messages and the mutations sent by target partition and the values aggregated by a partition
+type output struct {
+	messages  []map[string][][]byte
+	mutations [][]compute.Mutation
+	partial   map[string][]byte
+}
+
+// receive receives the batches sent to the partition at the barrier and applies the mutations.
+// It returns the number of vertices added
+func (p *partition) receive(t Transport, c Conflicts) (int64, error) {
+	batches, err := t.Receive(p.id)
+	if err != nil {
+		return 0, errors.Wrap(err, strings.Concat("cannot receive the messages of the partition ", strconv.Itoa(p.id)))
+	}
+	p.batches = batches
+	return p.mutate(c, batches)
+}
+
+// compute runs the vertices that are active or have messages
+func (p *partition) compute(job Job, step superstep, partitions int) (output, Stats, error) {
+	stats := Stats{Superstep: step.step}
+	batches := p.batches
+	p.batches = nil
+	inbox := make(map[string][][]byte)
+	for _, b := range batches {
+		for id, ms := range b.Messages {
+			if _, ok := p.vertices[id]; !ok {
+				stats.Dropped += int64(len(ms))
+				continue
+			}
+			if err := step.deliver(inbox, id, ms...); err != nil {
+				return output{}, stats, err
+			}
+		}
+	}
+
+	ctx := &vertexContext{
+		superstep:  step,
+		partition:  p.id,
+		partitions: partitions,
+		out:        make([]map[string][][]byte, partitions),
+		mutations:  make([][]compute.Mutation, partitions),
+		partial:    make(map[string][]byte),
+	}
+	for _, id := range p.ids {
+		v := p.vertices[id]
+		ms := inbox[id]
+		if v.halted && len(ms) == 0 {
+			continue
+		}
+		v.halted = false
+		ctx.v = v
+		if err := job.Program.Compute(ctx, ms); err != nil {
+			return output{}, stats, errors.Wrap(err, strings.Concat("the vertex program failed. Vertex: ", id))
+		}
+		if ctx.err != nil {
+			return output{}, stats, errors.Wrap(ctx.err, strings.Concat("the vertex program failed. Vertex: ", id))
+		}
+		stats.Computed++
+		if !v.halted {
+			stats.Active++
+		}
+	}
+	stats.Messages = ctx.messages
+	stats.Mutations = ctx.mutated
+	return output{messages: ctx.out, mutations: ctx.mutations, partial: ctx.partial}, stats, nil
+}
+
+// deliver appends the messages of the vertex to the box. The messages are combined into one when there is a combiner
+func (s superstep) deliver(box map[string][][]byte, id string, ms ...[]byte) error {
+	if s.combiner == nil {
+		box[id] = append(box[id], ms...)
+		return nil
+	}
+	for _, m := range ms {
+		prev, ok := box[id]
+		if !ok {
+			box[id] = [][]byte{m}
+			continue
+		}
+		r, err := s.combiner.Combine(prev[0], m)
+		if err != nil {
+			return errors.Wrap(err, strings.Concat("cannot combine the messages. Vertex: ", id))
+		}
+		prev[0] = r
+	}
+	return nil
+}
+
+// vertexContext is the raw context of the vertex being computed.
+// The values aggregated by the vertices are reduced in the partial values
+type vertexContext struct {
+	superstep
+	v          *vertex
+	partition  int
+	partitions int
+	out        []map[string][][]byte
+	messages   int64
+	mutations  [][]compute.Mutation
+	mutated    int64
+	partial    map[string][]byte
+	err        error
+}
+
+func (c *vertexContext) Superstep() int { return c.step }
+
+func (c *vertexContext) Vertices() int64 { return c.vertices }
+
+func (c *vertexContext) Partition() int { return c.partition }
+
+func (c *vertexContext) ID() string { return c.v.id }
+
+func (c *vertexContext) Value() []byte { return c.v.value }
+
+func (c *vertexContext) SetValue(v []byte) { c.v.value = v }
+
+func (c *vertexContext) Edges() []compute.Edge[[]byte] { return c.v.edges }
+
+func (c *vertexContext) Send(target string, m []byte) {
+	to := PartitionOf(target, c.partitions)
+	if c.out[to] == nil {
+		c.out[to] = make(map[string][][]byte)
+	}
+	c.messages++
+	c.fail(c.deliver(c.out[to], target, m))
+}
+
+func (c *vertexContext) VoteToHalt() { c.v.halted = true }
+
+// Mutate routes the mutation to the partition of the changed vertex. It is sent in the batch of the
+// partition, so it does not leave the process: the loopback is the only transport and there is no
+// routing to the worker of the vertex
+func (c *vertexContext) Mutate(m compute.Mutation) {
+	to := PartitionOf(m.Vertex, c.partitions)
+	c.mutations[to] = append(c.mutations[to], m)
+	c.mutated++
+}
+
+func (c *vertexContext) Aggregated(name string) []byte { return c.values[name] }
+
+func (c *vertexContext) Aggregate(name string, v []byte) {
+	a, ok := c.aggregators[name]
+	if !ok {
+		c.fail(errors.New(strings.Concat("the aggregator does not exist. Aggregator: ", name)))
+		return
+	}
+	acc, ok := c.partial[name]
+	if !ok {
+		c.partial[name] = v
+		return
+	}
+	r, err := a.Reduce(acc, v)
+	if err != nil {
+		c.fail(errors.Wrap(err, strings.Concat("cannot reduce the aggregator ", name)))
+		return
+	}
+	c.partial[name] = r
+}
+
+func (c *vertexContext) fail(err error) {
+	if c.err == nil && err != nil {
+		c.err = err
+	}
+}
+
+// masterContext is the context of the master compute. It changes the values read by the vertices
+type masterContext struct {
+	step     int
+	vertices int64
+	values   map[string][]byte
+	halted   bool
+}
+
+func (c *masterContext) Superstep() int { return c.step }
+
+func (c *masterContext) Vertices() int64 { return c.vertices }
+
+func (c *masterContext) Aggregated(name string) []byte { return c.values[name] }
+
+func (c *masterContext) SetAggregated(name string, v []byte) { c.values[name] = v }
+
+func (c *masterContext) Halt() { c.halted = true }
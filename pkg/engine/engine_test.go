@@ -0,0 +1,313 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package engine
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// maxValue propagates the maximum value of the graph
+var maxValue = compute.Bind[int64, struct{}, int64]("max", compute.Compute[int64, struct{}, int64](
+	func(ctx compute.Context[int64, struct{}, int64], messages []int64) error {
+		max := ctx.Value()
+		for _, m := range messages {
+			if m > max {
+				max = m
+			}
+		}
+		if ctx.Superstep() == 0 || max > ctx.Value() {
+			ctx.SetValue(max)
+			ctx.SendToNeighbors(max)
+		}
+		ctx.VoteToHalt()
+		return nil
+	}), compute.Codecs[int64, struct{}, int64]{Vertex: codec.Int64{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+
+// chain returns the vertices v0 -> v1 -> ... -> vn-1 with the value of the index
+func chain(t *testing.T, n int) []Vertex {
+	vs := make([]Vertex, n)
+	for i := range vs {
+		vs[i] = Vertex{ID: strconv.Itoa(i), Value: encode(t, int64(i))}
+		if i < n-1 {
+			vs[i].Edges = []compute.Edge[[]byte]{{Target: strconv.Itoa(i + 1)}}
+		}
+	}
+	return vs
+}
+
+func TestEngine_Run(t *testing.T) {
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			e := New(log.TestLogger(), partitions, NewLoopback())
+			assert.Equal(t, partitions, e.Partitions(), "Partitions")
+
+			// The last vertex has the max value and it is not propagated backwards
+			vs := chain(t, 5)
+			vs[4].Edges = []compute.Edge[[]byte]{{Target: "0"}}
+			res, err := e.Run(make(chan struct{}), Job{Program: maxValue}, vs)
+			if assert.NoError(t, err, "Run") {
+				assert.Len(t, res.Vertices, 5, "Vertices")
+				for i, v := range res.Vertices {
+					assert.Equal(t, strconv.Itoa(i), v.ID, "Sorted")
+					assert.Equal(t, int64(4), decode(t, v.Value), "Max value")
+				}
+				assert.Equal(t, 6, res.Supersteps, "Supersteps")
+			}
+		})
+	}
+}
+
+func TestEngine_Run_MaxSupersteps(t *testing.T) {
+	e := New(log.TestLogger(), 2, NewLoopback())
+	vs := chain(t, 4)
+	vs[3].Value = encode(t, 9)
+	vs[3].Edges = []compute.Edge[[]byte]{{Target: "0"}}
+
+	res, err := e.Run(make(chan struct{}), Job{Program: maxValue, MaxSupersteps: 2}, vs)
+	if assert.NoError(t, err, "Run") {
+		assert.Equal(t, 2, res.Supersteps, "Supersteps")
+		assert.Equal(t, int64(9), decode(t, res.Vertices[0].Value), "Reached")
+		assert.Equal(t, int64(1), decode(t, res.Vertices[1].Value), "Not reached")
+	}
+
+	// The messages of the stopped job are not received by the next one
+	res, err = e.Run(make(chan struct{}), Job{Program: maxValue}, chain(t, 2))
+	if assert.NoError(t, err, "Next run") {
+		assert.Equal(t, int64(1), decode(t, res.Vertices[1].Value), "Isolated")
+	}
+}
+
+func TestEngine_Run_Errors(t *testing.T) {
+	e := New(log.TestLogger(), 0, NewLoopback())
+	assert.Equal(t, 1, e.Partitions(), "Default partitions")
+
+	_, err := e.Run(make(chan struct{}), Job{Program: maxValue}, []Vertex{{ID: "a"}, {ID: "a"}})
+	assert.Error(t, err, "Duplicated vertex")
+
+	failed := compute.Bind[int64, struct{}, int64]("failed", compute.Compute[int64, struct{}, int64](
+		func(ctx compute.Context[int64, struct{}, int64], messages []int64) error {
+			return errors.New("failed")
+		}), compute.Codecs[int64, struct{}, int64]{Vertex: codec.Int64{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+	_, err = e.Run(make(chan struct{}), Job{Program: failed}, chain(t, 2))
+	assert.EqualError(t, err, "the vertex program failed. Vertex: 0: failed", "Program error")
+
+	stop := make(chan struct{})
+	close(stop)
+	_, err = e.Run(stop, Job{Program: maxValue}, chain(t, 2))
+	assert.ErrorIs(t, err, ErrStopped, "Stopped")
+}
+
+func TestEngine_Run_Dropped(t *testing.T) {
+	e := New(log.TestLogger(), 2, NewLoopback())
+	vs := chain(t, 2)
+	vs[1].Edges = []compute.Edge[[]byte]{{Target: "missing"}}
+
+	res, err := e.Run(make(chan struct{}), Job{Program: maxValue}, vs)
+	if assert.NoError(t, err, "Run") {
+		assert.Len(t, res.Vertices, 2, "The missing vertex is not created")
+	}
+}
+
+func TestEngine_Run_Aggregators(t *testing.T) {
+	count := compute.SumFloat64("count")
+	total := compute.SumFloat64("total")
+	total.Persistent = true
+	counter := compute.Bind[int64, struct{}, int64]("counter", compute.Compute[int64, struct{}, int64](
+		func(ctx compute.Context[int64, struct{}, int64], messages []int64) error {
+			if err := count.Aggregate(ctx, 1); err != nil {
+				return err
+			}
+			return total.Aggregate(ctx, 1)
+		}), compute.Codecs[int64, struct{}, int64]{Vertex: codec.Int64{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+
+	var counts []float64
+	master := compute.MasterCompute(func(ctx compute.MasterContext) error {
+		c, err := count.Value(ctx)
+		if err != nil {
+			return err
+		}
+		counts = append(counts, c)
+		if ctx.Superstep() == 3 {
+			ctx.Halt()
+		}
+		return nil
+	})
+
+	e := New(log.TestLogger(), 3, NewLoopback())
+	job := Job{Program: counter, Master: master, Aggregators: []compute.RawAggregator{count.Raw(), total.Raw()}}
+	res, err := e.Run(make(chan struct{}), job, chain(t, 4))
+	if assert.NoError(t, err, "Run") {
+		assert.Equal(t, 3, res.Supersteps, "Halted by the master")
+		assert.Equal(t, []float64{0, 4, 4, 4}, counts, "Regular aggregator")
+		v, _ := total.Value(mapAggregates(res.Aggregated))
+		assert.Equal(t, 12.0, v, "Persistent aggregator")
+	}
+
+	job.Aggregators = []compute.RawAggregator{count.Raw(), count.Raw()}
+	_, err = e.Run(make(chan struct{}), job, chain(t, 4))
+	assert.Error(t, err, "Duplicated aggregator")
+
+	job.Aggregators = []compute.RawAggregator{count.Raw()}
+	_, err = e.Run(make(chan struct{}), job, chain(t, 4))
+	assert.Error(t, err, "Unknown aggregator")
+
+	job.Aggregators = []compute.RawAggregator{count.Raw(), total.Raw()}
+	job.Master = compute.MasterCompute(func(ctx compute.MasterContext) error { return errors.New("failed") })
+	_, err = e.Run(make(chan struct{}), job, chain(t, 4))
+	assert.Error(t, err, "Master error")
+}
+
+func TestEngine_Run_Combiner(t *testing.T) {
+	// Every vertex sends its value to the vertex 0 that keeps the number of messages received
+	received := make(map[int]int)
+	fanIn := compute.Bind[int64, struct{}, int64]("fanIn", compute.Compute[int64, struct{}, int64](
+		func(ctx compute.Context[int64, struct{}, int64], messages []int64) error {
+			if ctx.Superstep() == 0 {
+				ctx.Send("0", ctx.Value())
+				return nil
+			}
+			if ctx.ID() == "0" {
+				received[len(messages)]++
+				ctx.SetValue(messages[0])
+			}
+			ctx.VoteToHalt()
+			return nil
+		}), compute.Codecs[int64, struct{}, int64]{Vertex: codec.Int64{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+	sum := compute.Combiner[int64]{Codec: codec.Int64{}, Combine: func(a, b int64) int64 { return a + b }}
+
+	e := New(log.TestLogger(), 3, NewLoopback())
+	res, err := e.Run(make(chan struct{}), Job{Program: fanIn, Combiner: sum.Raw()}, chain(t, 6))
+	if assert.NoError(t, err, "Run") {
+		assert.Equal(t, map[int]int{1: 1}, received, "A single message")
+		assert.Equal(t, int64(15), decode(t, res.Vertices[0].Value), "Sum")
+	}
+}
+
+func TestEngine_Run_Partition(t *testing.T) {
+	partition := compute.Bind[int64, struct{}, int64]("partition", compute.Compute[int64, struct{}, int64](
+		func(ctx compute.Context[int64, struct{}, int64], messages []int64) error {
+			ctx.SetValue(int64(ctx.Partition()))
+			ctx.VoteToHalt()
+			return nil
+		}), compute.Codecs[int64, struct{}, int64]{Vertex: codec.Int64{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+
+	e := New(log.TestLogger(), 3, NewLoopback())
+	res, err := e.Run(make(chan struct{}), Job{Program: partition}, chain(t, 6))
+	if assert.NoError(t, err, "Run") {
+		for _, v := range res.Vertices {
+			assert.Equal(t, int64(PartitionOf(v.ID, 3)), decode(t, v.Value), v.ID)
+		}
+	}
+}
+
+// recorder records the progress of a job
+type recorder struct {
+	started     []int
+	completed   []Stats
+	checkpoints []Checkpoint
+	err         error
+}
+
+func (r *recorder) Started(superstep int) { r.started = append(r.started, superstep) }
+
+func (r *recorder) Completed(s Stats) { r.completed = append(r.completed, s) }
+
+func (r *recorder) Checkpoint(c Checkpoint) error {
+	r.checkpoints = append(r.checkpoints, c)
+	return r.err
+}
+
+func TestEngine_Resume(t *testing.T) {
+	vs := chain(t, 5)
+	vs[4].Edges = []compute.Edge[[]byte]{{Target: "0"}}
+	rec := &recorder{}
+	res, err := New(log.TestLogger(), 2, NewLoopback()).Run(make(chan struct{}), Job{Program: maxValue, Observer: rec, CheckpointInterval: 2}, vs)
+	if !assert.NoError(t, err, "Run") {
+		return
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, rec.started, "Started")
+	if assert.Len(t, rec.completed, 6, "Completed") {
+		assert.Equal(t, 5, rec.completed[5].Superstep, "Last superstep")
+		assert.Equal(t, int64(5), rec.completed[0].Messages, "Messages")
+	}
+	if !assert.Len(t, rec.checkpoints, 2, "Checkpoints") {
+		return
+	}
+	c := rec.checkpoints[0]
+	assert.Equal(t, 2, c.Superstep, "Checkpoint superstep")
+	assert.Len(t, c.Messages["1"], 1, "Messages in flight")
+
+	// The checkpoint is resumed by another number of partitions
+	resumed, err := New(log.TestLogger(), 3, NewLoopback()).Resume(make(chan struct{}), Job{Program: maxValue}, c)
+	if assert.NoError(t, err, "Resume") {
+		assert.Equal(t, res, resumed, "Same result")
+	}
+
+	rec = &recorder{err: assert.AnError}
+	_, err = New(log.TestLogger(), 1, NewLoopback()).Run(make(chan struct{}), Job{Program: maxValue, Observer: rec, CheckpointInterval: 1}, vs)
+	assert.ErrorIs(t, err, assert.AnError, "Checkpoint error")
+}
+
+type mapAggregates map[string][]byte
+
+func (m mapAggregates) Aggregated(name string) []byte { return m[name] }
+
+func TestPartitionOf(t *testing.T) {
+	counts := make([]int, 4)
+	for i := 0; i < 1000; i++ {
+		p := PartitionOf(strconv.Itoa(i), 4)
+		assert.Equal(t, p, PartitionOf(strconv.Itoa(i), 4), "Stable")
+		counts[p]++
+	}
+	for p, c := range counts {
+		assert.Greater(t, c, 150, strconv.Itoa(p))
+	}
+	assert.Equal(t, 0, PartitionOf("a", 1), "Single partition")
+}
+
+func TestLoopback(t *testing.T) {
+	l := NewLoopback()
+	assert.NoError(t, l.Send(1, Batch{From: 2, Messages: map[string][][]byte{"a": {{2}}}}))
+	assert.NoError(t, l.Send(1, Batch{From: 0, Messages: map[string][][]byte{"a": {{0}}}}))
+
+	batches, err := l.Receive(1)
+	if assert.NoError(t, err, "Receive") && assert.Len(t, batches, 2, "Batches") {
+		assert.Equal(t, 0, batches[0].From, "Sorted by sender")
+	}
+	batches, _ = l.Receive(1)
+	assert.Empty(t, batches, "Removed")
+}
+
+func encode(t *testing.T, v int64) []byte {
+	r, err := codec.Encode[int64](codec.Int64{}, v)
+	assert.NoError(t, err, "Encode")
+	return r
+}
+
+func decode(t *testing.T, r []byte) int64 {
+	v, err := codec.Decode[int64](codec.Int64{}, r)
+	assert.NoError(t, err, "Decode")
+	return v
+}
@@ -0,0 +1,135 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package engine
+
+import (
+	"sort"
+
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/strings"
+	"github.com/pkg/errors"
+)
+
+// Conflicts resolves the mutations of the same vertex in a superstep. The mutations are applied in order:
+// the edges removed, the vertices removed, the vertices added and the edges added. The edges added
+// to a vertex that does not exist are ignored
+type Conflicts struct {
+	// RemoveWins ignores the vertices and the edges added that have been removed in the superstep.
+	// By default the removals are applied before the additions, so the additions win
+	RemoveWins bool
+	// Resolve returns the value of a vertex added several times or added when it exists. The values
+	// are sorted by the partition and the vertex that added them and the value of the existing vertex
+	// is the first one. It is optional and by default the last value wins
+	Resolve func(id string, values [][]byte) ([]byte, error)
+}
+
+func (c Conflicts) resolve(id string, values [][]byte) ([]byte, error) {
+	if len(values) == 1 {
+		return values[0], nil
+	}
+	if c.Resolve == nil {
+		return values[len(values)-1], nil
+	}
+	v, err := c.Resolve(id, values)
+	if err != nil {
+		return nil, errors.Wrap(err, strings.Concat("cannot resolve the vertices added. Vertex: ", id))
+	}
+	return v, nil
+}
+
+// mutate applies the mutations of the batches sorted by sender partition. It returns the number of vertices added
+func (p *partition) mutate(c Conflicts, batches []Batch) (int64, error) {
+	byKind := make(map[compute.MutationKind][]compute.Mutation)
+	for _, b := range batches {
+		for _, m := range b.Mutations {
+			byKind[m.Kind] = append(byKind[m.Kind], m)
+		}
+	}
+	if len(byKind) == 0 {
+		return 0, nil
+	}
+
+	removedEdges := make(map[[2]string]bool)
+	for _, m := range byKind[compute.RemoveEdge] {
+		removedEdges[[2]string{m.Vertex, m.Edge.Target}] = true
+		if v, ok := p.vertices[m.Vertex]; ok {
+			v.edges = withoutEdge(v.edges, m.Edge.Target)
+		}
+	}
+	removed := make(map[string]bool)
+	for _, m := range byKind[compute.RemoveVertex] {
+		removed[m.Vertex] = true
+		delete(p.vertices, m.Vertex)
+	}
+
+	var ids []string
+	values := make(map[string][][]byte)
+	for _, m := range byKind[compute.AddVertex] {
+		if c.RemoveWins && removed[m.Vertex] {
+			continue
+		}
+		if _, ok := values[m.Vertex]; !ok {
+			ids = append(ids, m.Vertex)
+			if v, ok := p.vertices[m.Vertex]; ok {
+				values[m.Vertex] = [][]byte{v.value}
+			}
+		}
+		values[m.Vertex] = append(values[m.Vertex], m.Value)
+	}
+	added := int64(0)
+	for _, id := range ids {
+		value, err := c.resolve(id, values[id])
+		if err != nil {
+			return 0, err
+		}
+		if v, ok := p.vertices[id]; ok {
+			v.value = value
+			continue
+		}
+		p.vertices[id] = &vertex{id: id, value: value}
+		added++
+	}
+
+	for _, m := range byKind[compute.AddEdge] {
+		if c.RemoveWins && (removed[m.Vertex] || removedEdges[[2]string{m.Vertex, m.Edge.Target}]) {
+			continue
+		}
+		if v, ok := p.vertices[m.Vertex]; ok {
+			v.edges = append(withoutEdge(v.edges, m.Edge.Target), m.Edge)
+		}
+	}
+
+	if len(removed) > 0 || added > 0 {
+		p.ids = p.ids[:0]
+		for id := range p.vertices {
+			p.ids = append(p.ids, id)
+		}
+		sort.Strings(p.ids)
+	}
+	return added, nil
+}
+
+// withoutEdge returns the edges without the edge to the target
+func withoutEdge(edges []compute.Edge[[]byte], target string) []compute.Edge[[]byte] {
+	for i, e := range edges {
+		if e.Target == target {
+			return append(edges[:i:i], edges[i+1:]...)
+		}
+	}
+	return edges
+}
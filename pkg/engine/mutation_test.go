@@ -0,0 +1,143 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package engine
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/carisa/pkg/codec"
+	"github.com/carisa/pkg/compute"
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// mutating runs the mutations of the vertices in the first superstep. The other
+// supersteps set the value of every vertex to the number of vertices of the graph
+func mutating(mutations map[string]func(ctx compute.Context[int64, struct{}, int64])) compute.RawProgram {
+	return compute.Bind[int64, struct{}, int64]("mutating", compute.Compute[int64, struct{}, int64](
+		func(ctx compute.Context[int64, struct{}, int64], messages []int64) error {
+			if ctx.Superstep() == 0 {
+				if m, ok := mutations[ctx.ID()]; ok {
+					m(ctx)
+				}
+				return nil
+			}
+			ctx.SetValue(ctx.Vertices())
+			ctx.VoteToHalt()
+			return nil
+		}), compute.Codecs[int64, struct{}, int64]{Vertex: codec.Int64{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+}
+
+func TestEngine_Run_Mutations(t *testing.T) {
+	program := mutating(map[string]func(ctx compute.Context[int64, struct{}, int64]){
+		"0": func(ctx compute.Context[int64, struct{}, int64]) {
+			ctx.AddVertex("x", 9)
+			ctx.AddEdge("x", compute.Edge[struct{}]{Target: "0"})
+			ctx.Send("x", 1)
+		},
+		"1": func(ctx compute.Context[int64, struct{}, int64]) {
+			ctx.RemoveVertex("2")
+			ctx.Send("2", 1)
+		},
+		"3": func(ctx compute.Context[int64, struct{}, int64]) {
+			ctx.RemoveEdge("3", "4")
+			ctx.AddEdge("3", compute.Edge[struct{}]{Target: "0"})
+		},
+	})
+	for _, partitions := range []int{1, 3} {
+		t.Run(strconv.Itoa(partitions), func(t *testing.T) {
+			res, err := New(log.TestLogger(), partitions, NewLoopback()).Run(make(chan struct{}), Job{Program: program}, chain(t, 5))
+			if assert.NoError(t, err, "Run") {
+				ids := make([]string, len(res.Vertices))
+				for i, v := range res.Vertices {
+					ids[i] = v.ID
+					assert.Equal(t, int64(5), decode(t, v.Value), strconv.Itoa(i))
+				}
+				assert.Equal(t, []string{"0", "1", "3", "4", "x"}, ids, "Vertices")
+				assert.Equal(t, []compute.Edge[[]byte]{{Target: "0"}}, res.Vertices[2].Edges, "Edges of 3")
+				assert.Equal(t, []compute.Edge[[]byte]{{Target: "0"}}, res.Vertices[4].Edges, "Edges of x")
+				assert.Equal(t, 2, res.Supersteps, "Supersteps")
+			}
+		})
+	}
+}
+
+// adding runs the mutations of the vertices in the first superstep and votes to halt
+func adding(mutations map[string]func(ctx compute.Context[int64, struct{}, int64])) compute.RawProgram {
+	return compute.Bind[int64, struct{}, int64]("adding", compute.Compute[int64, struct{}, int64](
+		func(ctx compute.Context[int64, struct{}, int64], messages []int64) error {
+			if m, ok := mutations[ctx.ID()]; ok && ctx.Superstep() == 0 {
+				m(ctx)
+			}
+			ctx.VoteToHalt()
+			return nil
+		}), compute.Codecs[int64, struct{}, int64]{Vertex: codec.Int64{}, Edge: codec.Empty{}, Message: codec.Int64{}})
+}
+
+func TestEngine_Run_Conflicts(t *testing.T) {
+	program := adding(map[string]func(ctx compute.Context[int64, struct{}, int64]){
+		"0": func(ctx compute.Context[int64, struct{}, int64]) {
+			ctx.AddVertex("x", 7)
+			ctx.AddVertex("1", 8)
+			ctx.RemoveVertex("2")
+		},
+		"1": func(ctx compute.Context[int64, struct{}, int64]) {
+			ctx.AddVertex("x", 3)
+			ctx.AddVertex("2", 5)
+			ctx.AddEdge("2", compute.Edge[struct{}]{Target: "1"})
+		},
+	})
+	values := func(res Result) map[string]int64 {
+		m := make(map[string]int64)
+		for _, v := range res.Vertices {
+			m[v.ID] = decode(t, v.Value)
+		}
+		return m
+	}
+
+	e := New(log.TestLogger(), 1, NewLoopback())
+	res, err := e.Run(make(chan struct{}), Job{Program: program}, chain(t, 3))
+	if assert.NoError(t, err, "Add wins") {
+		assert.Equal(t, map[string]int64{"0": 0, "1": 8, "2": 5, "x": 3}, values(res), "Last value")
+		assert.Equal(t, []compute.Edge[[]byte]{{Target: "1"}}, res.Vertices[2].Edges, "Edges added again")
+	}
+
+	res, err = e.Run(make(chan struct{}), Job{Program: program, Conflicts: Conflicts{RemoveWins: true}}, chain(t, 3))
+	if assert.NoError(t, err, "Remove wins") {
+		assert.Equal(t, map[string]int64{"0": 0, "1": 8, "x": 3}, values(res), "Removed")
+	}
+
+	min := Conflicts{Resolve: func(id string, values [][]byte) ([]byte, error) {
+		res := values[0]
+		for _, v := range values[1:] {
+			if decode(t, v) < decode(t, res) {
+				res = v
+			}
+		}
+		return res, nil
+	}}
+	res, err = New(log.TestLogger(), 3, NewLoopback()).Run(make(chan struct{}), Job{Program: program, Conflicts: min}, chain(t, 3))
+	if assert.NoError(t, err, "Resolve") {
+		assert.Equal(t, map[string]int64{"0": 0, "1": 1, "2": 5, "x": 3}, values(res), "Min value")
+	}
+
+	failed := Conflicts{Resolve: func(string, [][]byte) ([]byte, error) { return nil, assert.AnError }}
+	_, err = e.Run(make(chan struct{}), Job{Program: program, Conflicts: failed}, chain(t, 3))
+	assert.ErrorIs(t, err, assert.AnError, "Resolve error")
+}
@@ -0,0 +1,76 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package engine
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/carisa/pkg/compute"
+)
+
+// Batch are the messages and the mutations sent from a partition to another one in a superstep
+type Batch struct {
+	// From is the partition that sends the messages
+	From int
+	// Messages are the encoded messages by target vertex
+	Messages map[string][][]byte
+	// Mutations are the mutations of the vertices of the target partition in the order they were requested
+	Mutations []compute.Mutation
+}
+
+// Transport exchanges the batches of messages between the partitions
+type Transport interface {
+	// Send delivers the batch to the partition. It is received at the barrier of the superstep
+	Send(to int, b Batch) error
+	// Receive returns and removes the batches delivered to the partition sorted by sender
+	Receive(partition int) ([]Batch, error)
+}
+
+// Loopback is the transport of the partitions that run in the same process
+type Loopback struct {
+	mu    sync.Mutex
+	inbox map[int][]Batch
+}
+
+// NewLoopback creates the loopback transport
+func NewLoopback() *Loopback {
+	return &Loopback{
+		inbox: make(map[int][]Batch),
+	}
+}
+
+// Send appends the batch to the inbox of the partition
+func (l *Loopback) Send(to int, b Batch) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inbox[to] = append(l.inbox[to], b)
+	return nil
+}
+
+// Receive returns the inbox of the partition
+func (l *Loopback) Receive(partition int) ([]Batch, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	batches := l.inbox[partition]
+	delete(l.inbox, partition)
+	sort.SliceStable(batches, func(i, j int) bool { return batches[i].From < batches[j].From })
+	return batches, nil
+}
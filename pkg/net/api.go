@@ -0,0 +1,84 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// API define the interface for the http api service of a node
+type API interface {
+	// Run starts the api service
+	Run()
+	// Stop stops the api service
+	Stop()
+}
+
+// NewHTTPAPI creates a http api service listening the srv address
+func NewHTTPAPI(log *zap.Logger, srv string, handler http.Handler) API {
+	return &HTTPAPI{
+		log: log,
+		server: &http.Server{
+			Addr:              srv,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// HTTPAPI is a http api service
+type HTTPAPI struct {
+	log    *zap.Logger
+	server *http.Server
+}
+
+// Run listens the address and serves the http requests
+func (a *HTTPAPI) Run() {
+	ls, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		a.log.Panic(
+			"API service cannot listen tcp address",
+			zap.String("Address", a.server.Addr),
+			zap.String("Error", err.Error()))
+	}
+	go func() {
+		if err := a.server.Serve(ls); err != nil && err != http.ErrServerClosed {
+			a.log.Error(
+				"API service cannot serve http requests",
+				zap.String("Address", a.server.Addr),
+				zap.String("Error", err.Error()))
+		}
+	}()
+}
+
+// Stop shutdowns gracefully the api service
+func (a *HTTPAPI) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.server.Shutdown(ctx); err != nil {
+		a.log.Error(
+			"API service cannot be stopped",
+			zap.String("Address", a.server.Addr),
+			zap.String("Error", err.Error()))
+	}
+}
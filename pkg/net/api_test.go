@@ -0,0 +1,48 @@
+/*
+ *   Copyright (c) 2022 CARISA
+ *   All rights reserved.
+
+ *   Licensed under the Apache License, Version 2.0 (the "License");
+ *   you may not use this file except in compliance with the License.
+ *   You may obtain a copy of the License at
+
+ *   http://www.apache.org/licenses/LICENSE-2.0
+
+ *   Unless required by applicable law or agreed to in writing, software
+ *   distributed under the License is distributed on an "AS IS" BASIS,
+ *   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *   See the License for the specific language governing permissions and
+ *   limitations under the License.
+ */
+
+package net
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/carisa/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPAPI_Run(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	})
+	api := NewHTTPAPI(log.TestLogger(), "localhost:5051", h)
+	api.Run()
+	defer api.Stop()
+
+	res, err := http.Get("http://localhost:5051/ping")
+	if assert.NoError(t, err) {
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal(t, "pong", string(body))
+	}
+}
+
+func TestHTTPAPI_Run_Panic_Bad_Address(t *testing.T) {
+	api := NewHTTPAPI(log.TestLogger(), "5:5051", http.NotFoundHandler())
+	assert.Panics(t, func() { api.Run() })
+}